@@ -0,0 +1,295 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: signer/v1/signer.proto
+
+package signerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SignatureService_CreateDevice_FullMethodName    = "/signer.v1.SignatureService/CreateDevice"
+	SignatureService_GetDevice_FullMethodName       = "/signer.v1.SignatureService/GetDevice"
+	SignatureService_ListDevices_FullMethodName     = "/signer.v1.SignatureService/ListDevices"
+	SignatureService_SignTransaction_FullMethodName = "/signer.v1.SignatureService/SignTransaction"
+	SignatureService_WatchSignatures_FullMethodName = "/signer.v1.SignatureService/WatchSignatures"
+)
+
+// SignatureServiceClient is the client API for SignatureService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SignatureServiceClient interface {
+	// CreateDevice creates a signature device with a new key pair.
+	CreateDevice(ctx context.Context, in *CreateDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	// GetDevice retrieves a single device.
+	GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	// ListDevices returns all devices ordered by ID.
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	// SignTransaction signs data with a device and increments its signature counter.
+	SignTransaction(ctx context.Context, in *SignTransactionRequest, opts ...grpc.CallOption) (*Signature, error)
+	// WatchSignatures streams signatures as they are created.
+	WatchSignatures(ctx context.Context, in *WatchSignaturesRequest, opts ...grpc.CallOption) (SignatureService_WatchSignaturesClient, error)
+}
+
+type signatureServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignatureServiceClient(cc grpc.ClientConnInterface) SignatureServiceClient {
+	return &signatureServiceClient{cc}
+}
+
+func (c *signatureServiceClient) CreateDevice(ctx context.Context, in *CreateDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, SignatureService_CreateDevice_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureServiceClient) GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, SignatureService_GetDevice_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureServiceClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, SignatureService_ListDevices_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureServiceClient) SignTransaction(ctx context.Context, in *SignTransactionRequest, opts ...grpc.CallOption) (*Signature, error) {
+	out := new(Signature)
+	err := c.cc.Invoke(ctx, SignatureService_SignTransaction_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signatureServiceClient) WatchSignatures(ctx context.Context, in *WatchSignaturesRequest, opts ...grpc.CallOption) (SignatureService_WatchSignaturesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SignatureService_ServiceDesc.Streams[0], SignatureService_WatchSignatures_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &signatureServiceWatchSignaturesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SignatureService_WatchSignaturesClient interface {
+	Recv() (*Signature, error)
+	grpc.ClientStream
+}
+
+type signatureServiceWatchSignaturesClient struct {
+	grpc.ClientStream
+}
+
+func (x *signatureServiceWatchSignaturesClient) Recv() (*Signature, error) {
+	m := new(Signature)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SignatureServiceServer is the server API for SignatureService service.
+// All implementations must embed UnimplementedSignatureServiceServer
+// for forward compatibility
+type SignatureServiceServer interface {
+	// CreateDevice creates a signature device with a new key pair.
+	CreateDevice(context.Context, *CreateDeviceRequest) (*Device, error)
+	// GetDevice retrieves a single device.
+	GetDevice(context.Context, *GetDeviceRequest) (*Device, error)
+	// ListDevices returns all devices ordered by ID.
+	ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error)
+	// SignTransaction signs data with a device and increments its signature counter.
+	SignTransaction(context.Context, *SignTransactionRequest) (*Signature, error)
+	// WatchSignatures streams signatures as they are created.
+	WatchSignatures(*WatchSignaturesRequest, SignatureService_WatchSignaturesServer) error
+	mustEmbedUnimplementedSignatureServiceServer()
+}
+
+// UnimplementedSignatureServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSignatureServiceServer struct {
+}
+
+func (UnimplementedSignatureServiceServer) CreateDevice(context.Context, *CreateDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDevice not implemented")
+}
+func (UnimplementedSignatureServiceServer) GetDevice(context.Context, *GetDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevice not implemented")
+}
+func (UnimplementedSignatureServiceServer) ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedSignatureServiceServer) SignTransaction(context.Context, *SignTransactionRequest) (*Signature, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignTransaction not implemented")
+}
+func (UnimplementedSignatureServiceServer) WatchSignatures(*WatchSignaturesRequest, SignatureService_WatchSignaturesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSignatures not implemented")
+}
+func (UnimplementedSignatureServiceServer) mustEmbedUnimplementedSignatureServiceServer() {}
+
+// UnsafeSignatureServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignatureServiceServer will
+// result in compilation errors.
+type UnsafeSignatureServiceServer interface {
+	mustEmbedUnimplementedSignatureServiceServer()
+}
+
+func RegisterSignatureServiceServer(s grpc.ServiceRegistrar, srv SignatureServiceServer) {
+	s.RegisterService(&SignatureService_ServiceDesc, srv)
+}
+
+func _SignatureService_CreateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureServiceServer).CreateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureService_CreateDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureServiceServer).CreateDevice(ctx, req.(*CreateDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureService_GetDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureServiceServer).GetDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureService_GetDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureServiceServer).GetDevice(ctx, req.(*GetDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureService_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureServiceServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureService_ListDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureServiceServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureService_SignTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignatureServiceServer).SignTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SignatureService_SignTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignatureServiceServer).SignTransaction(ctx, req.(*SignTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SignatureService_WatchSignatures_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSignaturesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SignatureServiceServer).WatchSignatures(m, &signatureServiceWatchSignaturesServer{stream})
+}
+
+type SignatureService_WatchSignaturesServer interface {
+	Send(*Signature) error
+	grpc.ServerStream
+}
+
+type signatureServiceWatchSignaturesServer struct {
+	grpc.ServerStream
+}
+
+func (x *signatureServiceWatchSignaturesServer) Send(m *Signature) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// SignatureService_ServiceDesc is the grpc.ServiceDesc for SignatureService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SignatureService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "signer.v1.SignatureService",
+	HandlerType: (*SignatureServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateDevice",
+			Handler:    _SignatureService_CreateDevice_Handler,
+		},
+		{
+			MethodName: "GetDevice",
+			Handler:    _SignatureService_GetDevice_Handler,
+		},
+		{
+			MethodName: "ListDevices",
+			Handler:    _SignatureService_ListDevices_Handler,
+		},
+		{
+			MethodName: "SignTransaction",
+			Handler:    _SignatureService_SignTransaction_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSignatures",
+			Handler:       _SignatureService_WatchSignatures_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "signer/v1/signer.proto",
+}
@@ -0,0 +1,59 @@
+// Command auditverify checks the integrity of audit events offline. It reads the audit log
+// file of the service or the response of GET /api/v1/audit-events:
+//
+//	auditverify data/audit.log
+//	curl -H "Authorization: Bearer $KEY" localhost:8080/api/v1/audit-events | auditverify
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+)
+
+func main() {
+	var input io.Reader = os.Stdin
+	name := "stdin"
+	if len(os.Args) > 1 {
+		file, err := os.Open(os.Args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer file.Close()
+		input, name = file, os.Args[1]
+	}
+
+	events, err := readEvents(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(2)
+	}
+
+	chains, err := audit.Verify(events)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: verification failed: %v\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d events in %d tenant chains verified\n", name, len(events), chains)
+}
+
+// readEvents accepts both the JSON lines of the log file and the {"events": [...]} response of the API.
+func readEvents(input io.Reader) ([]audit.Event, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Events []audit.Event `json:"events"`
+	}
+	if err := json.Unmarshal(data, &response); err == nil && response.Events != nil {
+		return response.Events, nil
+	}
+	return audit.ReadLog(bytes.NewReader(data))
+}
@@ -0,0 +1,322 @@
+// Command chainverify checks the signature history of a device offline. It reads a device
+// bundle, see pkg/bundle, and verifies every signature against the device's public key and
+// every link to the preceding signature, without contacting the service:
+//
+//	curl -H "Authorization: Bearer $API_KEY" -o till-1.tar \
+//		http://localhost:8080/api/v1/devices/till-1/export
+//	chainverify till-1.tar
+//	chainverify -service-key service_key.pem < till-1.tar
+//
+// If the bundle has a manifest, its signature and the hashes of all entries are verified
+// too. The manifest is signed with the service key included in the bundle; pass the key the
+// operator published with -service-key to also make sure the bundle comes from the service,
+// which rejects unsigned bundles as well.
+//
+// The verdict is printed as JSON. The exit code is 0 if the history is valid, 1 if it is
+// not and 2 if the bundle cannot be read.
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/bundle"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+const (
+	verdictValid   = "valid"
+	verdictInvalid = "invalid"
+
+	manifestSigned   = "signed"
+	manifestUnsigned = "unsigned"
+)
+
+// report is the machine-readable verdict.
+type report struct {
+	Bundle       string    `json:"bundle"`
+	DeviceID     string    `json:"deviceId"`
+	TenantID     string    `json:"tenantId"`
+	Algorithm    string    `json:"algorithm"`
+	Verdict      string    `json:"verdict"`
+	Manifest     string    `json:"manifest"`             // signed or unsigned
+	ServiceKey   string    `json:"serviceKey,omitempty"` // Fingerprint of the key the manifest was verified with
+	Transactions int       `json:"transactions"`
+	Valid        int       `json:"valid"`
+	Failures     []failure `json:"failures"`
+}
+
+// failure is a problem with one transaction, or with the bundle if Counter is nil.
+type failure struct {
+	Counter *int   `json:"counter,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+func main() {
+	serviceKeyFile := flag.String("service-key", "", "PEM encoded public key the manifest must be signed with")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-service-key file] [bundle.tar]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var serviceKey []byte
+	if *serviceKeyFile != "" {
+		var err error
+		if serviceKey, err = os.ReadFile(*serviceKeyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	var input io.Reader = os.Stdin
+	name := "stdin"
+	if flag.NArg() > 0 && flag.Arg(0) != "-" {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer file.Close()
+		input, name = file, flag.Arg(0)
+	}
+
+	result, err := verifyBundle(input, serviceKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(2)
+	}
+	result.Bundle = name
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if result.Verdict != verdictValid {
+		os.Exit(1)
+	}
+}
+
+// verifyBundle reads the archive entry by entry, so histories of any length are verified
+// without holding them in memory. Unknown entries are skipped, but must be listed in the
+// manifest if there is one. With a serviceKey the manifest must be signed by it.
+func verifyBundle(input io.Reader, serviceKey []byte) (*report, error) {
+	result := &report{Failures: []failure{}}
+	var (
+		device    *bundle.Device
+		verifier  *crypto.ChainVerifier
+		manifest  []byte
+		signature []byte
+		entries   []bundle.File // Every entry as read, to compare with the manifest
+	)
+	bundledKey := serviceKey
+
+	tarReader := tar.NewReader(input)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a device bundle: %w", err)
+		}
+		digest := sha256.New()
+		var size countingWriter
+		archive := io.TeeReader(tarReader, io.MultiWriter(digest, &size))
+
+		switch header.Name {
+		case bundle.DeviceFile:
+			device = &bundle.Device{}
+			if err := json.NewDecoder(archive).Decode(device); err != nil {
+				return nil, fmt.Errorf("%s: %w", bundle.DeviceFile, err)
+			}
+			result.DeviceID, result.TenantID, result.Algorithm = device.ID, device.TenantID, device.Algorithm
+			if verifier, err = crypto.NewChainVerifier(device.ID, []byte(device.PublicKey)); err != nil {
+				return nil, fmt.Errorf("%s: %w", bundle.DeviceFile, err)
+			}
+		case bundle.PublicKeyFile:
+			if device == nil {
+				return nil, fmt.Errorf("%s precedes %s", bundle.PublicKeyFile, bundle.DeviceFile)
+			}
+			publicKey, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			if strings.TrimSpace(string(publicKey)) != strings.TrimSpace(device.PublicKey) {
+				result.Failures = append(result.Failures, failure{
+					Reason: fmt.Sprintf("%s differs from the public key in %s", bundle.PublicKeyFile, bundle.DeviceFile),
+				})
+			}
+		case bundle.TransactionsFile:
+			if device == nil {
+				return nil, fmt.Errorf("%s precedes %s", bundle.TransactionsFile, bundle.DeviceFile)
+			}
+			if err := bundle.ReadTransactions(archive, func(transaction bundle.Transaction) error {
+				result.Transactions++
+				if err := verifyTransaction(verifier, device.ID, transaction); err != nil {
+					counter := transaction.Counter
+					result.Failures = append(result.Failures, failure{Counter: &counter, Reason: err.Error()})
+					return nil
+				}
+				result.Valid++
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		case bundle.ServiceKeyFile:
+			key, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			if serviceKey == nil {
+				bundledKey = key
+			}
+		case bundle.ManifestFile:
+			if manifest, err = io.ReadAll(archive); err != nil {
+				return nil, err
+			}
+		case bundle.SignatureFile:
+			encoded, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			if signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded))); err != nil {
+				signature = []byte{}
+			}
+		}
+
+		// Hash what the cases above left unread
+		if _, err := io.Copy(io.Discard, archive); err != nil {
+			return nil, err
+		}
+		if header.Name != bundle.ManifestFile && header.Name != bundle.SignatureFile {
+			entries = append(entries, bundle.File{
+				Name: header.Name, Size: int64(size), SHA256: hex.EncodeToString(digest.Sum(nil)),
+			})
+		}
+	}
+
+	if device == nil {
+		return nil, fmt.Errorf("not a device bundle: %s is missing", bundle.DeviceFile)
+	}
+	result.Failures = append(result.Failures, verifyManifest(result, device, manifest, signature, bundledKey, serviceKey != nil, entries)...)
+	if result.Transactions != device.SignatureCounter {
+		result.Failures = append(result.Failures, failure{
+			Reason: fmt.Sprintf("the device reports %d signatures, the bundle contains %d",
+				device.SignatureCounter, result.Transactions),
+		})
+	}
+
+	result.Verdict = verdictValid
+	if len(result.Failures) > 0 {
+		result.Verdict = verdictInvalid
+	}
+	return result, nil
+}
+
+// verifyManifest checks the signature of the manifest and that it lists exactly the entries
+// of the bundle. Without a manifest the bundle is only accepted if signed is not required.
+func verifyManifest(
+	result *report, device *bundle.Device, content, signature, serviceKey []byte, required bool, entries []bundle.File,
+) []failure {
+	if content == nil {
+		result.Manifest = manifestUnsigned
+		if required {
+			return []failure{{Reason: fmt.Sprintf("the bundle has no %s", bundle.ManifestFile)}}
+		}
+		return nil
+	}
+	result.Manifest = manifestSigned
+
+	var manifest bundle.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return []failure{{Reason: fmt.Sprintf("%s: %v", bundle.ManifestFile, err)}}
+	}
+	if serviceKey == nil {
+		return []failure{{Reason: fmt.Sprintf("the bundle has no %s to verify the manifest with", bundle.ServiceKeyFile)}}
+	}
+	fingerprint, err := bundle.Fingerprint(serviceKey)
+	if err != nil {
+		return []failure{{Reason: fmt.Sprintf("service key: %v", err)}}
+	}
+	result.ServiceKey = fingerprint
+	verifier, err := crypto.NewVerifier(serviceKey)
+	if err != nil {
+		return []failure{{Reason: fmt.Sprintf("service key: %v", err)}}
+	}
+
+	var failures []failure
+	fail := func(format string, args ...any) {
+		failures = append(failures, failure{Reason: fmt.Sprintf(format, args...)})
+	}
+	if manifest.ServiceKey != fingerprint {
+		fail("the manifest names service key %s", manifest.ServiceKey)
+	}
+	if signature == nil {
+		fail("the bundle has no %s", bundle.SignatureFile)
+	} else if verifier.Verify(content, signature) != nil {
+		fail("the signature of %s is invalid", bundle.ManifestFile)
+	}
+	if manifest.DeviceID != device.ID || manifest.TenantID != device.TenantID {
+		fail("the manifest is for device %q of tenant %q", manifest.DeviceID, manifest.TenantID)
+	}
+	if manifest.Transactions != result.Transactions {
+		fail("the manifest lists %d transactions, the bundle contains %d", manifest.Transactions, result.Transactions)
+	}
+
+	read := make(map[string]bundle.File, len(entries))
+	for _, entry := range entries {
+		read[entry.Name] = entry
+	}
+	for _, file := range manifest.Files {
+		entry, ok := read[file.Name]
+		if !ok {
+			fail("%s is listed in the manifest but missing", file.Name)
+			continue
+		}
+		if entry != file {
+			fail("%s does not match the hash in the manifest", file.Name)
+		}
+		delete(read, file.Name)
+	}
+	for _, entry := range entries {
+		if _, ok := read[entry.Name]; ok {
+			fail("%s is not listed in the manifest", entry.Name)
+		}
+	}
+	return failures
+}
+
+func verifyTransaction(verifier *crypto.ChainVerifier, deviceID string, transaction bundle.Transaction) error {
+	signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+	if err != nil {
+		// Still advance the chain, the next link cannot match either
+		verifier.Verify(transaction.Counter, transaction.SignedData, nil)
+		return fmt.Errorf("signature is not base64 encoded")
+	}
+	if err := verifier.Verify(transaction.Counter, transaction.SignedData, signature); err != nil {
+		return err
+	}
+	if transaction.DeviceID != deviceID {
+		return fmt.Errorf("transaction belongs to device %q", transaction.DeviceID)
+	}
+	if securedData, _ := crypto.ParseSecuredData(transaction.SignedData); securedData.Data != transaction.Data {
+		return fmt.Errorf("data does not match the signed data")
+	}
+	return nil
+}
+
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
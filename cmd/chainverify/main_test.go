@@ -0,0 +1,290 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/ashermp9/fiskaly-test-task/pkg/bundle"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+// exportBundle signs with a device of the service and writes its history as a bundle,
+// letting tamper change the transactions first.
+func exportBundle(t *testing.T, service *app.APIService, deviceID string, tamper func([]bundle.Transaction) []bundle.Transaction) *bytes.Buffer {
+	t.Helper()
+	ctx := context.Background()
+	device, err := service.GetDevice(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := service.ListTransactions(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions := make([]bundle.Transaction, 0, len(history))
+	for _, transaction := range history {
+		transactions = append(transactions, bundle.Transaction{
+			DeviceID:   transaction.DeviceID,
+			Counter:    transaction.Counter,
+			Data:       transaction.Data,
+			SignedData: transaction.SignedData,
+			Signature:  base64.StdEncoding.EncodeToString(transaction.Signature),
+			CreatedAt:  transaction.CreatedAt,
+		})
+	}
+	if tamper != nil {
+		transactions = tamper(transactions)
+	}
+
+	var archive bytes.Buffer
+	writer := bundle.NewWriter(&archive, time.Now())
+	steps := []error{
+		writer.WriteJSON(bundle.DeviceFile, bundle.Device{
+			ID:               device.ID,
+			TenantID:         device.TenantID,
+			Algorithm:        string(device.Algorithm),
+			PublicKey:        string(device.PublicKey),
+			SignatureCounter: device.SignatureCounter,
+			Version:          device.Version,
+		}),
+		writer.WriteTransactions(func(yield func(bundle.Transaction) error) error {
+			for _, transaction := range transactions {
+				if err := yield(transaction); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		writer.Close(),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &archive
+}
+
+func TestVerifyBundle(t *testing.T) {
+	ctx := context.Background()
+	service := app.NewAPIService(storage.NewStorage())
+	// Several devices per algorithm, each must sign with its own key
+	for _, device := range []struct {
+		id        string
+		algorithm domain.Algorithm
+	}{{"ecc-1", domain.AlgorithmECC}, {"ecc-2", domain.AlgorithmECC}, {"rsa-1", domain.AlgorithmRSA}, {"rsa-2", domain.AlgorithmRSA}} {
+		if _, err := service.CreateDevice(ctx, domain.CreateDeviceRequest{ID: device.id, Algorithm: device.algorithm}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			if _, err := service.SignTransaction(ctx, domain.SignTransactionRequest{
+				DeviceID: device.id, Data: fmt.Sprintf("receipt_%d", i),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, deviceID := range []string{"ecc-1", "ecc-2", "rsa-1", "rsa-2"} {
+		result, err := verifyBundle(exportBundle(t, service, deviceID, nil), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != verdictValid || result.Valid != 4 || result.DeviceID != deviceID {
+			t.Errorf("expected the history of %s to be valid, got %+v", deviceID, result)
+		}
+	}
+
+	for name, test := range map[string]struct {
+		tamper   func([]bundle.Transaction) []bundle.Transaction
+		failures []int
+	}{
+		"changed data": {
+			tamper: func(transactions []bundle.Transaction) []bundle.Transaction {
+				transactions[1].Data = "receipt_9"
+				return transactions
+			},
+			failures: []int{1},
+		},
+		"changed signed data": {
+			tamper: func(transactions []bundle.Transaction) []bundle.Transaction {
+				transactions[2].SignedData = "2_receipt_9_" + transactions[2].SignedData[len("2_receipt_2_"):]
+				return transactions
+			},
+			failures: []int{2},
+		},
+		"removed transaction": {
+			tamper: func(transactions []bundle.Transaction) []bundle.Transaction {
+				return append(transactions[:1], transactions[2:]...)
+			},
+			failures: []int{2},
+		},
+		"swapped signature": {
+			tamper: func(transactions []bundle.Transaction) []bundle.Transaction {
+				transactions[3].Signature = transactions[2].Signature
+				return transactions
+			},
+			failures: []int{3},
+		},
+	} {
+		result, err := verifyBundle(exportBundle(t, service, "ecc-1", test.tamper), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.Verdict != verdictInvalid {
+			t.Errorf("%s: expected an invalid verdict, got %+v", name, result)
+			continue
+		}
+		var counters []int
+		for _, failure := range result.Failures {
+			if failure.Counter != nil {
+				counters = append(counters, *failure.Counter)
+			}
+		}
+		if fmt.Sprint(counters) != fmt.Sprint(test.failures) {
+			t.Errorf("%s: expected failures at %v, got %+v", name, test.failures, result.Failures)
+		}
+	}
+
+	if _, err := verifyBundle(bytes.NewBufferString("not a tar archive"), nil); err == nil {
+		t.Error("reading garbage must fail")
+	}
+}
+
+// rewriteBundle copies an archive, letting edit replace the content of entries or drop them
+// by returning nil.
+func rewriteBundle(t *testing.T, archive []byte, edit func(name string, content []byte) []byte) *bytes.Buffer {
+	t.Helper()
+	var rewritten bytes.Buffer
+	reader, writer := tar.NewReader(bytes.NewReader(archive)), tar.NewWriter(&rewritten)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(reader)
+		if content = edit(header.Name, content); content == nil {
+			continue
+		}
+		header.Size = int64(len(content))
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(content)
+	}
+	writer.Close()
+	return &rewritten
+}
+
+func TestVerifySignedExport(t *testing.T) {
+	ctx := context.Background()
+	newServiceKey := func() (crypto.Signer, []byte) {
+		_, privateKey, err := (&crypto.ECCGenerator{}).GenerateBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, publicKey, err := crypto.NewSignerFromPEM(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer, publicKey
+	}
+	signer, serviceKey := newServiceKey()
+	_, otherKey := newServiceKey()
+
+	service := app.NewAPIService(storage.NewStorage(), app.WithExportKey(signer, serviceKey))
+	if _, err := service.CreateDevice(ctx, domain.CreateDeviceRequest{ID: "till-1", Algorithm: domain.AlgorithmRSA}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := service.SignTransaction(ctx, domain.SignTransactionRequest{DeviceID: "till-1", Data: fmt.Sprintf("receipt_%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var export bytes.Buffer
+	if err := service.ExportDevice(ctx, "till-1", &export); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, _ := bundle.Fingerprint(serviceKey)
+
+	for name, pinned := range map[string][]byte{"bundled key": nil, "pinned key": serviceKey} {
+		result, err := verifyBundle(bytes.NewReader(export.Bytes()), pinned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != verdictValid || result.Manifest != manifestSigned || result.ServiceKey != fingerprint || result.Valid != 3 {
+			t.Errorf("%s: expected a valid signed export, got %+v", name, result)
+		}
+	}
+
+	for name, test := range map[string]struct {
+		bundle *bytes.Buffer
+		pinned []byte
+		reason string
+	}{
+		"other service key": {
+			bundle: bytes.NewBuffer(export.Bytes()),
+			pinned: otherKey,
+			reason: "the signature of manifest.json is invalid",
+		},
+		"changed CSV": {
+			bundle: rewriteBundle(t, export.Bytes(), func(name string, content []byte) []byte {
+				if name == bundle.CSVFile {
+					return bytes.Replace(content, []byte("receipt_1"), []byte("receipt_9"), 1)
+				}
+				return content
+			}),
+			reason: "transactions.csv does not match the hash in the manifest",
+		},
+		"removed signature": {
+			bundle: rewriteBundle(t, export.Bytes(), func(name string, content []byte) []byte {
+				if name == bundle.SignatureFile {
+					return nil
+				}
+				return content
+			}),
+			reason: "the bundle has no manifest.sig",
+		},
+		"removed manifest": {
+			bundle: rewriteBundle(t, export.Bytes(), func(name string, content []byte) []byte {
+				if name == bundle.ManifestFile {
+					return nil
+				}
+				return content
+			}),
+			pinned: serviceKey,
+			reason: "the bundle has no manifest.json",
+		},
+		"unsigned bundle": {
+			bundle: exportBundle(t, service, "till-1", nil),
+			pinned: serviceKey,
+			reason: "the bundle has no manifest.json",
+		},
+	} {
+		result, err := verifyBundle(test.bundle, test.pinned)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var reasons []string
+		for _, failure := range result.Failures {
+			reasons = append(reasons, failure.Reason)
+		}
+		if result.Verdict != verdictInvalid || !slices.Contains(reasons, test.reason) {
+			t.Errorf("%s: expected an invalid verdict because %s, got %+v", name, test.reason, result)
+		}
+	}
+}
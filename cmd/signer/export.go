@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"os"
+
+	"github.com/ashermp9/fiskaly-test-task/config"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/pkg/bundle"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.uber.org/zap"
+)
+
+// exportKey loads the key device exports are signed with. Without a key file a key is
+// generated, which auditors cannot recognize after a restart.
+func exportKey(cfg config.ExportConfig, logger *zap.SugaredLogger) (app.Option, error) {
+	var privateKey []byte
+	if cfg.KeyFile != "" {
+		var err error
+		if privateKey, err = os.ReadFile(cfg.KeyFile); err != nil {
+			return nil, err
+		}
+	} else {
+		logger.Warn("No export key file configured, device exports are signed with a key generated on start")
+		generator := crypto.ECCGenerator{Curve: elliptic.P256()}
+		var err error
+		if _, privateKey, err = generator.GenerateBytes(); err != nil {
+			return nil, err
+		}
+	}
+
+	signer, publicKey, err := crypto.NewSignerFromPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := bundle.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infow("Signing device exports", "service_key", fingerprint)
+	return app.WithExportKey(signer, publicKey), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/config"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/lease"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+// leases connects to the configured lease backend. It returns no option without a backend,
+// the closer disconnects from the backend.
+func leases(ctx context.Context, cfg config.LeasesConfig) ([]app.Option, []ports.HealthCheck, func(), error) {
+	switch cfg.Backend {
+	case config.LeasesRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Address,
+			Username: cfg.Redis.Username,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		leaser := lease.NewRedisLeaser(client, cfg.Redis.Prefix)
+		if err := leaser.Ping(ctx); err != nil {
+			client.Close()
+			return nil, nil, nil, fmt.Errorf("failed to connect to %s: %w", cfg.Redis.Address, err)
+		}
+		check := ports.HealthCheck{Component: "leases", ComponentType: "datastore", Check: leaser.Ping}
+		return []app.Option{app.WithLeases(leaser, cfg.TTL)}, []ports.HealthCheck{check}, func() { client.Close() }, nil
+	case config.LeasesPostgres:
+		poolConfig, err := postgresPool(cfg.Postgres)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		leaser, err := lease.NewAdvisoryLeaser(ctx, pool)
+		if err != nil {
+			pool.Close()
+			return nil, nil, nil, err
+		}
+		check := ports.HealthCheck{Component: "leases", ComponentType: "datastore", Check: leaser.Ping}
+		return []app.Option{app.WithLeases(leaser, cfg.TTL)}, []ports.HealthCheck{check}, pool.Close, nil
+	default:
+		return nil, nil, func() {}, nil
+	}
+}
@@ -2,23 +2,39 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ashermp9/fiskaly-test-task/config"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/crypto"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/metrics"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/tracing"
 	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
 	"github.com/ashermp9/fiskaly-test-task/internal/ports"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/rpc"
 	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/postgres"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	var configFile string
 	flag.StringVar(&configFile, "config", "config/local/config.yaml", "Path to the config file")
@@ -29,42 +45,321 @@ func main() {
 	if err != nil {
 		panic(fmt.Errorf("failed to load config: %w", err))
 	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configFile, err)
+		os.Exit(1)
+	}
 
-	zapConfig := zap.NewDevelopmentConfig()
-	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder        // Human-readable time format
-	zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // Capitalized and colored level
-	zapConfig.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder      // Short caller format
-
-	logger, err := zapConfig.Build()
+	level, err := logging.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		panic(err)
+	}
+	logger, err := logging.New(cfg.Logging.Format, level)
 	if err != nil {
 		panic(fmt.Errorf("failed to initialize logger: %w", err))
 	}
 	defer func() { _ = logger.Sync() }()
 	sugar := logger.Sugar()
+	sugar.Infow("Loaded configuration", "file", configFile, "env_overrides", cfg.Overrides())
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "signer",
+	})
+	if err != nil {
+		sugar.Fatalf("Invalid tracing configuration: %v", err)
+	}
+
 	// Initialize components
-	stor := storage.NewStorage()
-	appService := app.NewAPIService(stor)
+	var stor serviceStorage
+	compactCtx, stopCompaction := context.WithCancel(context.Background())
+	defer stopCompaction()
+	if cfg.Storage.MigrateOnStart && cfg.Storage.Backend != config.StorageMemory {
+		result, err := migrateStorage(context.Background(), cfg.Storage, migrate.Latest, false)
+		if err != nil {
+			sugar.Fatalf("Failed to migrate the storage: %v", err)
+		}
+		if result.Applied > 0 {
+			sugar.Infow("Migrated the storage schema", "from", result.From, "to", result.To)
+		}
+	}
+	switch cfg.Storage.Backend {
+	case config.StorageMemory:
+		sugar.Warn("Using the in-memory storage, devices are lost on restart")
+		stor = storage.NewStorage()
+	case config.StorageJournal:
+		journaled, recovery, err := storage.OpenStorage(cfg.Storage.Dir)
+		if err != nil {
+			sugar.Fatalf("Failed to open the storage: %v", err)
+		}
+		sugar.Infow("Loaded the journaled storage", "dir", cfg.Storage.Dir, "snapshot_sequence", recovery.SnapshotSequence,
+			"replayed_records", recovery.Records, "devices", journaled.CountDevices(context.Background()))
+		if recovery.Truncated > 0 {
+			sugar.Warnw("Discarded an incomplete journal record, the service stopped while writing it",
+				"bytes", recovery.Truncated)
+		}
+		go journaled.RunCompaction(compactCtx, cfg.Storage.CompactInterval, func(err error) {
+			sugar.Errorf("Compacting the storage journal failed: %v", err)
+		})
+		stor = journaled
+	case config.StoragePostgres:
+		poolConfig, err := postgresPool(cfg.Storage.Postgres)
+		if err != nil {
+			sugar.Fatalf("Invalid storage.postgres.url: %v", err)
+		}
+		stor, err = postgres.Open(context.Background(), poolConfig)
+		if err != nil {
+			sugar.Fatalf("Failed to open the storage: %v", err)
+		}
+		sugar.Infow("Connected to the PostgreSQL storage", "host", poolConfig.ConnConfig.Host,
+			"database", poolConfig.ConnConfig.Database, "max_conns", poolConfig.MaxConns,
+			"devices", stor.CountDevices(context.Background()))
+		if cfg.Leases.Backend == config.LeasesNone {
+			sugar.Info("No leases configured, instances sharing the database retry signatures on conflicts")
+		}
+	default:
+		sugar.Fatalf("Unknown storage backend %q", cfg.Storage.Backend)
+	}
+	defer stor.Close()
+	if err := stor.SetCryptoPolicy(cryptoPolicy(cfg.Crypto)); err != nil {
+		sugar.Fatalf("Invalid crypto configuration: %v", err)
+	}
+	auditLog := storage.NewAuditLog()
+	if cfg.Audit.Path != "" {
+		var truncated int64
+		auditLog, truncated, err = storage.OpenAuditLog(cfg.Audit.Path)
+		if err != nil {
+			sugar.Fatalf("Failed to open the audit log: %v", err)
+		}
+		if truncated > 0 {
+			sugar.Warnw("Discarded an incomplete audit log line, the service stopped while writing it",
+				"bytes", truncated)
+		}
+	} else {
+		sugar.Warn("No audit log path configured, audit events are lost on restart")
+	}
+	defer auditLog.Close()
+
+	exportKeyOption, err := exportKey(cfg.Export, sugar)
+	if err != nil {
+		sugar.Fatalf("Invalid export key: %v", err)
+	}
+
+	leaseOptions, leaseChecks, closeLeases, err := leases(context.Background(), cfg.Leases)
+	if err != nil {
+		sugar.Fatalf("Failed to set up the %s leases: %v", cfg.Leases.Backend, err)
+	}
+	defer closeLeases()
+	if cfg.Leases.Backend != config.LeasesNone {
+		sugar.Infow("Leasing devices across instances", "backend", cfg.Leases.Backend, "ttl", cfg.Leases.TTL)
+	}
+
+	serviceMetrics := metrics.New()
+	appOptions := append([]app.Option{app.WithObserver(serviceMetrics), app.WithAuditLog(auditLog), exportKeyOption}, leaseOptions...)
+	appService := app.NewAPIService(stor, appOptions...)
+	serviceMetrics.RegisterDeviceCount(func() int { return appService.CountDevices(context.Background()) })
+
+	apiKeys, err := configuredAPIKeys(cfg.APIKeys)
+	if err != nil {
+		sugar.Fatalf("Invalid API key configuration: %v", err)
+	}
+	if len(apiKeys) == 0 {
+		sugar.Warn("No API keys configured, all requests will be rejected")
+	}
+	keyService := app.NewKeyService(stor, apiKeys, app.WithKeyAuditLog(auditLog))
+
+	var backupService *app.BackupService
+	if cfg.Backup.KeyFile != "" {
+		key, err := backupKey(cfg.Backup.KeyFile)
+		if err != nil {
+			sugar.Fatalf("Invalid backup key: %v", err)
+		}
+		if backupService, err = app.NewBackupService(stor, key, app.WithBackupAuditLog(auditLog)); err != nil {
+			sugar.Fatalf("Invalid backup key: %v", err)
+		}
+	} else {
+		sugar.Warn("No backup key file configured, backups are disabled")
+	}
 
 	// Set up and start the HTTP server
-	server := ports.NewServer(sugar, appService, cfg.ServerAddress)
+	serverOptions := []ports.ServerOption{
+		ports.WithAPIKeys(keyService),
+		ports.WithHTTPOptions(ports.HTTPOptions{
+			Host:         cfg.BindHost,
+			ReadTimeout:  cfg.Timeouts.Read,
+			WriteTimeout: cfg.Timeouts.Write,
+			IdleTimeout:  cfg.Timeouts.Idle,
+		}),
+		ports.WithMetrics(serviceMetrics),
+		ports.WithHealthChecks(append([]ports.HealthCheck{
+			{Component: "storage", ComponentType: "datastore", Check: appService.Ping},
+			{Component: "auditLog", ComponentType: "component", Check: auditLog.Ping},
+		}, leaseChecks...)...),
+		ports.WithRateLimits(rateLimits(cfg.RateLimits)),
+	}
+	if backupService != nil {
+		serverOptions = append(serverOptions, ports.WithBackups(backupService))
+	}
+	if cfg.TLS.Enabled() {
+		tlsOptions, err := tlsOptions(cfg.TLS)
+		if err != nil {
+			sugar.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		serverOptions = append(serverOptions, ports.WithTLS(tlsOptions))
+	}
+	server := ports.NewServer(sugar, appService, cfg.ServerAddress, serverOptions...)
 	go func() {
-		sugar.Infof("Starting server on port %d", cfg.ServerAddress)
+		sugar.Infof("Starting server on port %d, TLS: %t", cfg.ServerAddress, cfg.TLS.Enabled())
 		if err := server.Run(); err != nil && err != http.ErrServerClosed {
 			sugar.Fatalf("Failed to listen and serve: %v", err)
 		}
 	}()
 
-	// Graceful shutdown
-	gracefulShutdown(server, sugar)
+	// Set up and start the gRPC server
+	var grpcServer *rpc.Server
+	if cfg.GRPCAddress != 0 {
+		grpcServer = rpc.NewServer(sugar, appService, cfg.GRPCAddress, rpc.WithAPIKeys(keyService), rpc.WithHost(cfg.BindHost))
+		go func() {
+			sugar.Infof("Starting gRPC server on port %d", cfg.GRPCAddress)
+			if err := grpcServer.Run(); err != nil {
+				sugar.Fatalf("Failed to serve gRPC: %v", err)
+			}
+		}()
+	}
+
+	// Reload on SIGHUP until the service is stopped, then shut down gracefully
+	reloader := &reloader{
+		configFile: configFile,
+		running:    cfg,
+		server:     server,
+		storage:    stor,
+		level:      level,
+		logger:     sugar,
+	}
+	waitForStop(reloader, sugar)
+	gracefulShutdown(server, grpcServer, cfg.Timeouts.Shutdown, sugar)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		sugar.Errorf("Flushing traces failed: %v", err)
+	}
+}
+
+func configuredAPIKeys(configured []config.APIKeyConfig) ([]domain.APIKey, error) {
+	apiKeys := make([]domain.APIKey, 0, len(configured))
+	for _, key := range configured {
+		if key.ID == "" || key.Hash == "" {
+			return nil, fmt.Errorf("API key %q needs an id and a hash", key.Name)
+		}
+		scopes := make([]domain.Scope, 0, len(key.Scopes))
+		for _, scope := range key.Scopes {
+			if !domain.Scope(scope).Valid() {
+				return nil, fmt.Errorf("API key %q has unknown scope %q", key.ID, scope)
+			}
+			scopes = append(scopes, domain.Scope(scope))
+		}
+		apiKeys = append(apiKeys, domain.APIKey{
+			ID:       key.ID,
+			Name:     key.Name,
+			TenantID: key.Tenant,
+			Hash:     key.Hash,
+			Scopes:   scopes,
+		})
+	}
+	return apiKeys, nil
+}
+
+// backupKey reads the base64 encoded AES key backups are encrypted with.
+func backupKey(path string) ([]byte, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
 }
 
-func gracefulShutdown(server *ports.Server, logger *zap.SugaredLogger) {
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
+func rateLimits(cfg config.RateLimitsConfig) ports.RateLimits {
+	return ports.RateLimits{
+		Tenant: ports.RateLimit(cfg.Tenant),
+		APIKey: ports.RateLimit(cfg.APIKey),
+		Device: ports.RateLimit(cfg.Device),
+	}
+}
 
-	<-stopChan // Wait for interrupt signal
+func cryptoPolicy(cfg config.CryptoConfig) crypto.Policy {
+	algorithms := make([]domain.Algorithm, 0, len(cfg.AllowedAlgorithms))
+	for _, algorithm := range cfg.AllowedAlgorithms {
+		algorithms = append(algorithms, domain.Algorithm(algorithm))
+	}
+	return crypto.Policy{
+		AllowedAlgorithms: algorithms,
+		RSAKeyBits:        cfg.RSAKeyBits,
+		ECCCurve:          cfg.ECCCurve,
+	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func tlsOptions(cfg config.TLSConfig) (ports.TLSOptions, error) {
+	minVersion, err := ports.ParseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return ports.TLSOptions{}, err
+	}
+	cipherSuites, err := ports.ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return ports.TLSOptions{}, err
+	}
+	if len(cfg.ClientCertificates) > 0 && cfg.ClientCAFile == "" {
+		return ports.TLSOptions{}, fmt.Errorf("client_certificates require a client_ca_file")
+	}
+
+	subjects := make(map[string]domain.Principal, len(cfg.ClientCertificates))
+	for _, client := range cfg.ClientCertificates {
+		scopes := make([]domain.Scope, 0, len(client.Scopes))
+		for _, scope := range client.Scopes {
+			if !domain.Scope(scope).Valid() {
+				return ports.TLSOptions{}, fmt.Errorf("client certificate %q has unknown scope %q", client.Subject, scope)
+			}
+			scopes = append(scopes, domain.Scope(scope))
+		}
+		tenant := client.Tenant
+		if tenant == "" {
+			tenant = domain.DefaultTenantID
+		}
+		subjects[client.Subject] = domain.Principal{TenantID: tenant, Scopes: scopes}
+	}
+
+	return ports.TLSOptions{
+		CertFile:          cfg.CertFile,
+		KeyFile:           cfg.KeyFile,
+		MinVersion:        minVersion,
+		CipherSuites:      cipherSuites,
+		ClientCAFile:      cfg.ClientCAFile,
+		RequireClientCert: cfg.RequireClientCert,
+		ClientSubjects:    subjects,
+	}, nil
+}
+
+// waitForStop reloads the configuration on SIGHUP and returns on SIGINT or SIGTERM.
+func waitForStop(reloader *reloader, logger *zap.SugaredLogger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			return
+		}
+		if err := reloader.reload(); err != nil {
+			logger.Errorf("Reloading the configuration failed, keeping the running one: %v", err)
+		}
+	}
+}
+
+func gracefulShutdown(server *ports.Server, grpcServer *rpc.Server, grace time.Duration, logger *zap.SugaredLogger) {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
 	defer cancel()
 
 	logger.Info("Shutting down server...")
@@ -73,4 +368,13 @@ func gracefulShutdown(server *ports.Server, logger *zap.SugaredLogger) {
 	} else {
 		logger.Info("Server exited properly")
 	}
+
+	if grpcServer != nil {
+		logger.Info("Shutting down gRPC server...")
+		if err := grpcServer.Shutdown(ctx); err != nil {
+			logger.Errorf("gRPC server shutdown failed: %+v", err)
+		} else {
+			logger.Info("gRPC server exited properly")
+		}
+	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/config"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/postgres"
+)
+
+// runMigrate implements `signer migrate`, which migrates the configured storage while the
+// service is stopped, e.g. to go back to an older version before downgrading.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configFile := flags.String("config", "config/local/config.yaml", "Path to the config file")
+	to := flags.Int("to", migrate.Latest, "Schema version to migrate to, the latest by default")
+	dryRun := flags.Bool("dry-run", false, "Print the steps without applying them")
+	flags.Parse(args)
+
+	cfg := &config.Config{}
+	if err := config.LoadConfig(*configFile, cfg); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", *configFile, err)
+	}
+	if cfg.Storage.Backend == config.StorageMemory {
+		fmt.Println("The memory storage persists nothing, there is nothing to migrate")
+		return nil
+	}
+
+	result, err := migrateStorage(context.Background(), cfg.Storage, *to, *dryRun)
+	if err != nil && len(result.Steps) == 0 {
+		return err
+	}
+	fmt.Printf("The %s storage has schema version %d, the latest is %d\n", cfg.Storage.Backend, result.From, result.Latest)
+	for i, step := range result.Steps {
+		status := "pending"
+		if i < result.Applied {
+			status = "applied"
+		}
+		fmt.Printf("  %-7s %s\n", status, step)
+	}
+	switch {
+	case err != nil:
+		return err
+	case len(result.Steps) == 0:
+		fmt.Println("Nothing to migrate")
+	case *dryRun:
+		fmt.Printf("Dry run, migrating would lead to version %d\n", result.To)
+	default:
+		fmt.Printf("Migrated to version %d\n", result.To)
+	}
+	return nil
+}
+
+// migrateStorage migrates the storage of a persistent backend to version to.
+func migrateStorage(ctx context.Context, cfg config.StorageConfig, to int, dryRun bool) (migrate.Result, error) {
+	switch cfg.Backend {
+	case config.StorageJournal:
+		return storage.MigrateJournal(ctx, cfg.Dir, to, dryRun)
+	case config.StoragePostgres:
+		poolConfig, err := postgresPool(cfg.Postgres)
+		if err != nil {
+			return migrate.Result{}, fmt.Errorf("invalid storage.postgres.url: %w", err)
+		}
+		return postgres.Migrate(ctx, poolConfig, to, dryRun)
+	default:
+		return migrate.Result{}, fmt.Errorf("the %s storage has no schema", cfg.Backend)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/config"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// reloader applies the rate limits, the log level and the crypto policy of the configuration
+// file to the running service. Other changes are reported, they need a restart.
+type reloader struct {
+	configFile string
+	running    *config.Config // Configuration in effect
+	server     *ports.Server
+	storage    serviceStorage
+	level      zap.AtomicLevel
+	logger     *zap.SugaredLogger
+}
+
+// reload re-reads the configuration file. An invalid file changes nothing.
+func (r *reloader) reload() error {
+	next := &config.Config{}
+	if err := config.LoadConfig(r.configFile, next); err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	level, err := zapcore.ParseLevel(next.Logging.Level)
+	if err != nil {
+		return err
+	}
+	if err := r.storage.SetCryptoPolicy(cryptoPolicy(next.Crypto)); err != nil {
+		return fmt.Errorf("invalid crypto configuration: %w", err)
+	}
+	r.server.SetRateLimits(rateLimits(next.RateLimits))
+	r.level.SetLevel(level)
+
+	restartRequired := config.RestartRequired(r.running, next)
+	r.running.RateLimits = next.RateLimits
+	r.running.Logging.Level = next.Logging.Level
+	r.running.Crypto = next.Crypto
+
+	r.logger.Infow("Reloaded configuration", "file", r.configFile,
+		"rate_limits", next.RateLimits, "log_level", next.Logging.Level, "crypto", next.Crypto)
+	if len(restartRequired) > 0 {
+		r.logger.Warnw("Changed settings take effect after a restart", "settings", restartRequired)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/ashermp9/fiskaly-test-task/config"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/crypto"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// serviceStorage is implemented by every storage backend.
+type serviceStorage interface {
+	app.APIStorage
+	app.APIKeyStorage
+	app.BackupStorage
+	SetCryptoPolicy(policy crypto.Policy) error
+	Close() error
+}
+
+// postgresPool configures a connection pool. Settings left at zero keep the ones of the URL.
+func postgresPool(cfg config.PostgresConfig) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.ConnectTimeout > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	}
+	return poolConfig, nil
+}
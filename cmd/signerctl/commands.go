@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/client"
+)
+
+// stringList collects a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// connect returns an API client for the active profile and a context bounded by --timeout.
+// It also rejects an unknown --output before any request changes something.
+func (c *cli) connect(ctx context.Context) (*client.Client, context.Context, context.CancelFunc, error) {
+	if c.output != outputTable && c.output != outputJSON {
+		return nil, nil, nil, usagef("unknown output format %q, use table or json", c.output)
+	}
+	api, err := c.client()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	return api, ctx, cancel, nil
+}
+
+func deviceRows(devices ...client.Device) [][]string {
+	rows := make([][]string, 0, len(devices))
+	for _, device := range devices {
+		rows = append(rows, []string{
+			device.ID, device.Algorithm, device.Label, strconv.Itoa(device.SignatureCounter),
+			deviceStatus(device), strconv.Itoa(device.Version),
+		})
+	}
+	return rows
+}
+
+var deviceHeader = []string{"ID", "ALGORITHM", "LABEL", "SIGNATURES", "STATUS", "VERSION"}
+
+func deviceStatus(device client.Device) string {
+	if device.Disabled {
+		return "disabled"
+	}
+	return "active"
+}
+
+func listDevices(ctx context.Context, c *cli, args []string) error {
+	args, err := parseFlags(c.flagSet(c.command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usagef("unexpected arguments %v", args)
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	devices, err := api.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(devices, deviceHeader, deviceRows(devices...))
+}
+
+func getDevice(ctx context.Context, c *cli, args []string) error {
+	args, err := parseFlags(c.flagSet(c.command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a device ID")
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	device, err := api.GetDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.printDevice(device)
+}
+
+// printDevice shows all attributes of a device, the table has one row per attribute.
+func (c *cli) printDevice(device client.Device) error {
+	rows := [][]string{
+		{"ID", device.ID},
+		{"Tenant", device.TenantID},
+		{"Algorithm", device.Algorithm},
+		{"Label", device.Label},
+		{"Signatures", strconv.Itoa(device.SignatureCounter)},
+		{"Status", deviceStatus(device)},
+		{"Version", strconv.Itoa(device.Version)},
+	}
+	keys := make([]string, 0, len(device.Metadata))
+	for key := range device.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rows = append(rows, []string{"Metadata " + key, device.Metadata[key]})
+	}
+	return c.print(device, nil, rows)
+}
+
+func createDevice(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet(c.command)
+	algorithm := flags.String("algorithm", "ECC", "Key algorithm: RSA or ECC")
+	label := flags.String("label", "", "Label of the device")
+	var metadata stringList
+	flags.Var(&metadata, "metadata", "Attribute as key=value, repeatable")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a device ID")
+	}
+
+	request := client.CreateDeviceRequest{ID: args[0], Algorithm: strings.ToUpper(*algorithm), Label: *label}
+	for _, entry := range metadata {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			return usagef("metadata %q is not key=value", entry)
+		}
+		if request.Metadata == nil {
+			request.Metadata = make(map[string]string)
+		}
+		request.Metadata[key] = value
+	}
+
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	device, err := api.CreateDevice(ctx, request)
+	if err != nil {
+		return err
+	}
+	return c.printDevice(device)
+}
+
+func disableDevice(ctx context.Context, c *cli, args []string) error {
+	return setDeviceDisabled(ctx, c, args, true)
+}
+
+func enableDevice(ctx context.Context, c *cli, args []string) error {
+	return setDeviceDisabled(ctx, c, args, false)
+}
+
+func setDeviceDisabled(ctx context.Context, c *cli, args []string, disabled bool) error {
+	args, err := parseFlags(c.flagSet(c.command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a device ID")
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	device, err := api.GetDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	device, err = api.UpdateDevice(ctx, device.ID, device.Version, client.UpdateDeviceRequest{Disabled: &disabled})
+	if err != nil {
+		return err
+	}
+	return c.printDevice(device)
+}
+
+// sign signs the --data values, every file argument, or stdin if there is neither. Each
+// input is one transaction.
+func sign(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet(c.command)
+	var data stringList
+	flags.Var(&data, "data", "Data to sign, repeatable")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usagef("expected a device ID")
+	}
+	deviceID, files := args[0], args[1:]
+
+	inputs := []string(data)
+	for _, file := range files {
+		content, err := readInput(c.stdin, file)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, content)
+	}
+	if len(inputs) == 0 {
+		content, err := readInput(c.stdin, "-")
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, content)
+	}
+
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	signatures := make([]client.Signature, 0, len(inputs))
+	rows := make([][]string, 0, len(inputs))
+	for _, input := range inputs {
+		if input == "" {
+			return fmt.Errorf("refusing to sign empty data")
+		}
+		signature, err := api.Sign(ctx, deviceID, input)
+		if err != nil {
+			return err
+		}
+		signatures = append(signatures, signature)
+		rows = append(rows, []string{signature.DeviceID, strconv.Itoa(signature.Counter), signature.Signature})
+	}
+	return c.print(signatures, []string{"DEVICE", "COUNTER", "SIGNATURE"}, rows)
+}
+
+// readInput reads a file, or stdin for "-".
+func readInput(stdin io.Reader, file string) (string, error) {
+	if file == "-" {
+		content, err := io.ReadAll(stdin)
+		return string(content), err
+	}
+	content, err := os.ReadFile(file)
+	return string(content), err
+}
+
+// verify checks the whole signature chain of a device, or a single signature and its link.
+func verify(ctx context.Context, c *cli, args []string) error {
+	args, err := parseFlags(c.flagSet(c.command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usagef("expected a device ID and optionally a counter")
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	type verification struct {
+		DeviceID string `json:"deviceId"`
+		Counter  *int   `json:"counter,omitempty"`
+		Verified int    `json:"verified"`
+	}
+	result := verification{DeviceID: args[0]}
+	if len(args) == 2 {
+		counter, err := strconv.Atoi(args[1])
+		if err != nil || counter < 0 {
+			return usagef("counter %q is not a non-negative number", args[1])
+		}
+		if _, err := api.VerifySignature(ctx, args[0], counter); err != nil {
+			return err
+		}
+		result.Counter, result.Verified = &counter, 1
+	} else {
+		if result.Verified, err = api.VerifyChain(ctx, args[0]); err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("%d signatures verified", result.Verified)
+	if result.Counter != nil {
+		message = fmt.Sprintf("signature %d verified", *result.Counter)
+	}
+	return c.print(result, nil, [][]string{{result.DeviceID + ":", message}})
+}
+
+// exportPublicKey writes the PEM encoded public key of a device to stdout or a file.
+func exportPublicKey(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet(c.command)
+	out := flags.String("out", "", "File to write the key to instead of stdout")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a device ID")
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	device, err := api.GetDevice(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		return os.WriteFile(*out, []byte(device.PublicKey), 0o644)
+	}
+	if c.output == outputJSON {
+		return c.print(map[string]string{"deviceId": device.ID, "publicKey": device.PublicKey}, nil, nil)
+	}
+	_, err = io.WriteString(c.stdout, device.PublicKey)
+	return err
+}
+
+// exportDevice downloads the export bundle of a device, see pkg/bundle, to <device>.tar,
+// another file or stdout.
+func exportDevice(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet(c.command)
+	out := flags.String("out", "", "File to write the bundle to, - for stdout, defaults to <device>.tar")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a device ID")
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if *out == "-" {
+		return api.ExportDevice(ctx, args[0], c.stdout)
+	}
+	path := *out
+	if path == "" {
+		path = args[0] + ".tar"
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = api.ExportDevice(ctx, args[0], file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Do not leave a truncated bundle behind
+		os.Remove(path)
+		return err
+	}
+	return c.print(map[string]string{"deviceId": args[0], "bundle": path}, nil, [][]string{{args[0] + ":", "exported to " + path}})
+}
+
+// createBackup downloads an encrypted backup of the whole service.
+func createBackup(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet(c.command)
+	out := flags.String("out", "", "File to write the backup to, defaults to signer-<time>.backup")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usagef("unexpected arguments %q", args)
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	path := *out
+	if path == "" {
+		path = "signer-" + time.Now().UTC().Format("20060102T150405Z") + ".backup"
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = api.Backup(ctx, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return c.print(map[string]string{"backup": path}, nil, [][]string{{"Backup written to " + path}})
+}
+
+// restoreBackup uploads a backup from a file or stdin.
+func restoreBackup(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet(c.command)
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a backup file, - for stdin")
+	}
+	api, ctx, cancel, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	backup := c.stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		backup = file
+	}
+	result, err := api.Restore(ctx, backup)
+	if err != nil {
+		return err
+	}
+	return c.print(result, []string{"DEVICES", "UNCHANGED", "SIGNATURES", "API KEYS"}, [][]string{{
+		strconv.Itoa(result.Devices), strconv.Itoa(result.SkippedDevices),
+		strconv.Itoa(result.Transactions), strconv.Itoa(result.APIKeys),
+	}})
+}
@@ -0,0 +1,198 @@
+// Command signerctl manages signature devices and signatures through the v1 API.
+//
+//	signerctl devices list
+//	signerctl devices create till-1 --algorithm ECC --label "Till 1" --metadata store=berlin
+//	signerctl devices disable till-1
+//	echo -n receipt | signerctl sign till-1
+//	signerctl verify till-1
+//	signerctl public-key till-1 --out till-1.pem
+//	signerctl export till-1
+//	signerctl backup create --out signer.backup
+//	signerctl backup restore signer.backup
+//
+// The server and API key come from --url and --api-key, the SIGNER_URL and SIGNER_API_KEY
+// environment variables or a profile of the config file, see profiles.go. Every command
+// prints a table or, with --output json, JSON.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// usageError is reported with the usage of the command and exit code 2.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// errUsageShown is returned for invalid flags, the flag set already reported them.
+var errUsageShown = errors.New("invalid flags")
+
+// command is a subcommand, name being one or two words such as "sign" or "devices list".
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = []command{
+	{"devices list", "", "List all devices", listDevices},
+	{"devices get", "<id>", "Show a device", getDevice},
+	{"devices create", "<id> --algorithm RSA|ECC [--label text] [--metadata key=value]...", "Create a device", createDevice},
+	{"devices disable", "<id>", "Stop a device from signing", disableDevice},
+	{"devices enable", "<id>", "Let a disabled device sign again", enableDevice},
+	{"sign", "<device> [--data text | file...]", "Sign data from the arguments, files or stdin", sign},
+	{"verify", "<device> [counter]", "Verify the signature chain of a device, or one signature", verify},
+	{"public-key", "<device> [--out file]", "Export the PEM encoded public key of a device", exportPublicKey},
+	{"export", "<device> [--out file]", "Download the signed export bundle of a device for auditors", exportDevice},
+	{"backup create", "[--out file]", "Download an encrypted backup of the whole service", createBackup},
+	{"backup restore", "<file>", "Restore a backup, refusing to roll back signature counters", restoreBackup},
+	{"profiles list", "", "List the profiles of the config file", listProfiles},
+	{"profiles use", "<name>", "Make a profile the default", useProfile},
+}
+
+// cli holds the global flags and the streams of an invocation.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	command    command // Command being run
+	configFile string
+	profile    string
+	url        string
+	apiKey     string
+	output     string
+	timeout    time.Duration
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit code: 0 on success, 1 if the command
+// failed and 2 if it was used wrongly.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	global := c.flagSet(command{})
+	global.Usage = c.usage
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	cmd, args, ok := findCommand(global.Args())
+	if !ok {
+		c.usage()
+		return 2
+	}
+
+	c.command = cmd
+	err := cmd.run(ctx, c, args)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsageShown):
+		return 2
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "signerctl %s: %v\nusage: signerctl %s %s\n", cmd.name, err, cmd.name, cmd.args)
+		return 2
+	default:
+		fmt.Fprintf(stderr, "signerctl %s: %v\n", cmd.name, err)
+		return 1
+	}
+}
+
+func findCommand(words []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		name := strings.Fields(cmd.name)
+		if len(words) >= len(name) && strings.Join(words[:len(name)], " ") == cmd.name {
+			return cmd, words[len(name):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "usage: signerctl [flags] <command> [arguments]\n\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(c.stderr, "\nflags:")
+	c.flagSet(command{}).PrintDefaults()
+}
+
+// flagSet returns a flag set for the command with the global flags, so they are accepted
+// before and after the command.
+func (c *cli) flagSet(cmd command) *flag.FlagSet {
+	flags := flag.NewFlagSet("signerctl "+cmd.name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: signerctl %s %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&c.configFile, "config", c.configFile, "Config file with profiles, defaults to $SIGNERCTL_CONFIG or the user config dir")
+	flags.StringVar(&c.profile, "profile", c.profile, "Profile of the config file to use instead of the current one")
+	flags.StringVar(&c.url, "url", c.url, "Base URL of the service, overrides the profile")
+	flags.StringVar(&c.apiKey, "api-key", c.apiKey, "API key, overrides the profile")
+	flags.StringVar(&c.output, "output", defaultString(c.output, outputTable), "Output format: table or json")
+	flags.StringVar(&c.output, "o", defaultString(c.output, outputTable), "Shorthand for --output")
+	flags.DurationVar(&c.timeout, "timeout", defaultDuration(c.timeout, 30*time.Second), "Timeout of the command")
+	return flags
+}
+
+// parseFlags parses flags mixed with positional arguments, e.g. `get till-1 -o json`.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsageShown
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func defaultDuration(value, fallback time.Duration) time.Duration {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
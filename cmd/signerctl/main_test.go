@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/ashermp9/fiskaly-test-task/pkg/bundle"
+	"github.com/ashermp9/fiskaly-test-task/pkg/client"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.uber.org/zap"
+)
+
+func TestSignerctl(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	stor := storage.NewStorage()
+	keys := app.NewKeyService(stor, []domain.APIKey{
+		{ID: "ops", TenantID: domain.DefaultTenantID, Hash: app.HashAPIKey("ops-key"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+	})
+	_, privateKey, err := (&crypto.ECCGenerator{}).GenerateBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, serviceKey, err := crypto.NewSignerFromPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := app.NewAPIService(stor, app.WithExportKey(signer, serviceKey))
+	backups, err := app.NewBackupService(stor, bytes.Repeat([]byte{1}, app.BackupKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(ports.NewServer(loggerZap.Sugar(), service, 0,
+		ports.WithAPIKeys(keys), ports.WithBackups(backups)).Handler())
+	t.Cleanup(server.Close)
+
+	t.Setenv("SIGNER_URL", "")
+	t.Setenv("SIGNER_API_KEY", "")
+	t.Setenv("SIGNERCTL_TEST_KEY", "ops-key")
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := "current: broken\nprofiles:\n" +
+		"  broken:\n    url: http://127.0.0.1:1\n" +
+		"  test:\n    url: " + server.URL + "\n    api_key_env: SIGNERCTL_TEST_KEY\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signerctl := func(stdin string, args ...string) (string, string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		args = append([]string{"--config", configFile, "--timeout", "5s"}, args...)
+		code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+		return stdout.String(), stderr.String(), code
+	}
+
+	if _, stderr, code := signerctl("", "profiles", "use", "test"); code != 0 {
+		t.Fatalf("profiles use failed with %d: %s", code, stderr)
+	}
+	if stdout, _, _ := signerctl("", "profiles", "list"); !strings.Contains(stdout, "*        test") {
+		t.Errorf("expected test to be the current profile:\n%s", stdout)
+	}
+
+	stdout, stderr, code := signerctl("", "devices", "create", "till-1", "--label", "Till 1", "--metadata", "store=berlin")
+	if code != 0 {
+		t.Fatalf("devices create failed with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Metadata store  berlin") || !strings.Contains(stdout, "active") {
+		t.Errorf("unexpected device table:\n%s", stdout)
+	}
+
+	stdout, _, _ = signerctl("", "devices", "list", "-o", "json")
+	var devices []client.Device
+	if err := json.Unmarshal([]byte(stdout), &devices); err != nil || len(devices) != 1 || devices[0].Algorithm != "ECC" {
+		t.Fatalf("unexpected device list %q: %v", stdout, err)
+	}
+
+	receipt := filepath.Join(t.TempDir(), "receipt.txt")
+	if err := os.WriteFile(receipt, []byte("receipt 2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code = signerctl("receipt 1", "sign", "till-1")
+	if code != 0 || !strings.Contains(stdout, "till-1  0") {
+		t.Fatalf("signing stdin failed with %d: %s%s", code, stdout, stderr)
+	}
+	if stdout, stderr, code = signerctl("", "sign", "till-1", receipt, "--data", "receipt 3"); code != 0 {
+		t.Fatalf("signing a file failed with %d: %s", code, stderr)
+	}
+	if lines := strings.Count(stdout, "till-1"); lines != 2 {
+		t.Errorf("expected two signatures:\n%s", stdout)
+	}
+
+	if stdout, stderr, code = signerctl("", "verify", "till-1"); code != 0 || !strings.Contains(stdout, "3 signatures verified") {
+		t.Errorf("verify failed with %d: %s%s", code, stdout, stderr)
+	}
+	if stdout, stderr, code = signerctl("", "verify", "till-1", "2", "-o", "json"); code != 0 || !strings.Contains(stdout, `"counter": 2`) {
+		t.Errorf("verifying one signature failed with %d: %s%s", code, stdout, stderr)
+	}
+
+	if stdout, stderr, code = signerctl("", "devices", "disable", "till-1"); code != 0 || !strings.Contains(stdout, "disabled") {
+		t.Fatalf("devices disable failed with %d: %s%s", code, stdout, stderr)
+	}
+	if _, stderr, code = signerctl("", "sign", "till-1", "--data", "receipt 4"); code != 1 || !strings.Contains(stderr, "device_disabled") {
+		t.Errorf("signing with a disabled device must fail, got %d: %s", code, stderr)
+	}
+	if _, stderr, code = signerctl("", "devices", "enable", "till-1"); code != 0 {
+		t.Errorf("devices enable failed with %d: %s", code, stderr)
+	}
+
+	publicKey := filepath.Join(t.TempDir(), "till-1.pem")
+	if _, stderr, code = signerctl("", "public-key", "till-1", "--out", publicKey); code != 0 {
+		t.Fatalf("public-key failed with %d: %s", code, stderr)
+	}
+	if pem, _ := os.ReadFile(publicKey); !bytes.HasPrefix(pem, []byte("-----BEGIN")) {
+		t.Errorf("expected a PEM public key, got %q", pem)
+	}
+
+	bundleFile := filepath.Join(t.TempDir(), "till-1.tar")
+	if stdout, stderr, code = signerctl("", "export", "till-1", "--out", bundleFile); code != 0 || !strings.Contains(stdout, "exported to") {
+		t.Fatalf("export failed with %d: %s%s", code, stdout, stderr)
+	}
+	if archive, _ := os.ReadFile(bundleFile); !bytes.Contains(archive, []byte(bundle.ManifestFile)) {
+		t.Errorf("expected a signed bundle in %s", bundleFile)
+	}
+	missingFile := filepath.Join(t.TempDir(), "missing.tar")
+	if _, _, code = signerctl("", "export", "missing", "--out", missingFile); code != 1 {
+		t.Errorf("exporting an unknown device must fail, got %d", code)
+	}
+	if _, err := os.Stat(missingFile); !os.IsNotExist(err) {
+		t.Errorf("a failed export must not leave a file behind: %v", err)
+	}
+
+	backupFile := filepath.Join(t.TempDir(), "signer.backup")
+	if stdout, stderr, code = signerctl("", "backup", "create", "--out", backupFile); code != 0 || !strings.Contains(stdout, backupFile) {
+		t.Fatalf("backup create failed with %d: %s%s", code, stdout, stderr)
+	}
+	if _, _, code = signerctl("", "backup", "create", "--out", backupFile); code != 1 {
+		t.Errorf("backup create must not overwrite a file, got %d", code)
+	}
+	// Nothing changed since the backup, restoring it leaves the device as it is
+	stdout, stderr, code = signerctl("", "backup", "restore", backupFile, "-o", "json")
+	var restored client.RestoreResult
+	if err := json.Unmarshal([]byte(stdout), &restored); code != 0 || err != nil || restored.SkippedDevices != 1 {
+		t.Errorf("backup restore failed with %d: %s%s", code, stdout, stderr)
+	}
+
+	if _, _, code = signerctl("", "devices", "get"); code != 2 {
+		t.Errorf("a missing argument must exit with 2, got %d", code)
+	}
+	if _, _, code = signerctl("", "devices", "get", "till-1", "--api-key", "wrong"); code != 1 {
+		t.Errorf("an unknown API key must fail, got %d", code)
+	}
+	if _, _, code = signerctl("", "devices", "get", "till-1", "--profile", "broken", "--timeout", "1s"); code != 1 {
+		t.Errorf("an unreachable profile must fail, got %d", code)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// print writes value as indented JSON or the rows as a table, depending on --output.
+func (c *cli) print(value any, header []string, rows [][]string) error {
+	switch c.output {
+	case outputJSON:
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case outputTable, "":
+		table := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		if header != nil {
+			fmt.Fprintln(table, strings.Join(header, "\t"))
+		}
+		for _, row := range rows {
+			fmt.Fprintln(table, strings.Join(row, "\t"))
+		}
+		return table.Flush()
+	default:
+		return usagef("unknown output format %q, use table or json", c.output)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// configFile lists the environments signerctl talks to, e.g.
+//
+//	current: local
+//	profiles:
+//	  local:
+//	    url: http://localhost:8080
+//	    api_key: dev-admin-key
+//	  production:
+//	    url: https://signer.example.com
+//	    api_key_env: SIGNER_PRODUCTION_KEY
+//	    ca_file: /etc/signer/ca.crt
+type configFile struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*profile `yaml:"profiles"`
+}
+
+// profile is the service and the credentials of one environment.
+type profile struct {
+	URL       string `yaml:"url"`
+	APIKey    string `yaml:"api_key,omitempty"`
+	APIKeyEnv string `yaml:"api_key_env,omitempty"` // Environment variable holding the API key
+	CAFile    string `yaml:"ca_file,omitempty"`     // CA verifying the server certificate
+	CertFile  string `yaml:"cert_file,omitempty"`   // Client certificate for mutual TLS
+	KeyFile   string `yaml:"key_file,omitempty"`
+}
+
+// configPath returns the config file of --config, $SIGNERCTL_CONFIG or the user config dir.
+func (c *cli) configPath() (string, error) {
+	if c.configFile != "" {
+		return c.configFile, nil
+	}
+	if path := os.Getenv("SIGNERCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "signerctl", "config.yaml"), nil
+}
+
+// loadConfig reads the config file. A missing file is an empty configuration.
+func (c *cli) loadConfig() (*configFile, string, error) {
+	path, err := c.configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	config := &configFile{Profiles: make(map[string]*profile)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]*profile)
+	}
+	return config, path, nil
+}
+
+// activeProfile merges the selected profile with the environment and the flags, which
+// take precedence in this order.
+func (c *cli) activeProfile() (profile, error) {
+	config, path, err := c.loadConfig()
+	if err != nil {
+		return profile{}, err
+	}
+
+	var active profile
+	name := defaultString(c.profile, config.Current)
+	if name != "" {
+		selected, ok := config.Profiles[name]
+		if !ok {
+			return profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+		}
+		active = *selected
+	}
+	if active.APIKeyEnv != "" {
+		active.APIKey = os.Getenv(active.APIKeyEnv)
+	}
+
+	if url := os.Getenv("SIGNER_URL"); url != "" {
+		active.URL = url
+	}
+	if apiKey := os.Getenv("SIGNER_API_KEY"); apiKey != "" {
+		active.APIKey = apiKey
+	}
+	if c.url != "" {
+		active.URL = c.url
+	}
+	if c.apiKey != "" {
+		active.APIKey = c.apiKey
+	}
+	active.URL = defaultString(active.URL, defaultURL)
+	return active, nil
+}
+
+// client returns an API client for the active profile.
+func (c *cli) client() (*client.Client, error) {
+	active, err := c.activeProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	var options []client.Option
+	if active.APIKey != "" {
+		options = append(options, client.WithHeader("Authorization", "Bearer "+active.APIKey))
+	}
+	if active.CAFile != "" || active.CertFile != "" {
+		tlsConfig, err := active.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, client.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}))
+	}
+	return client.New(active.URL, options...), nil
+}
+
+func (p profile) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s contains no PEM certificate", p.CAFile)
+		}
+	}
+	if p.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+func listProfiles(_ context.Context, c *cli, args []string) error {
+	args, err := parseFlags(c.flagSet(c.command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usagef("unexpected arguments %v", args)
+	}
+	config, _, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type profileEntry struct {
+		Name    string `json:"name"`
+		URL     string `json:"url"`
+		Current bool   `json:"current"`
+	}
+	entries := make([]profileEntry, 0, len(names))
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		current := name == config.Current
+		entries = append(entries, profileEntry{Name: name, URL: config.Profiles[name].URL, Current: current})
+		marker := ""
+		if current {
+			marker = "*"
+		}
+		rows = append(rows, []string{marker, name, config.Profiles[name].URL})
+	}
+	return c.print(entries, []string{"CURRENT", "NAME", "URL"}, rows)
+}
+
+func useProfile(_ context.Context, c *cli, args []string) error {
+	args, err := parseFlags(c.flagSet(c.command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usagef("expected a profile name")
+	}
+	config, path, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Profiles[args[0]]; !ok {
+		return fmt.Errorf("profile %q not found in %s", args[0], path)
+	}
+
+	config.Current = args[0]
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stderr, "Using profile %s\n", args[0])
+	return nil
+}
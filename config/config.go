@@ -1,15 +1,198 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Config is the configuration of the service. LoadConfig starts from Default, applies the
+// YAML file and then the environment, see EnvPrefix.
 type Config struct {
-	ServerAddress int `yaml:"server_address"`
+	ServerAddress int              `yaml:"server_address"` // HTTP port
+	GRPCAddress   int              `yaml:"grpc_address"`   // gRPC port, 0 disables the gRPC server
+	BindHost      string           `yaml:"bind_host"`      // Interface both servers listen on, empty for all
+	Timeouts      TimeoutsConfig   `yaml:"timeouts"`
+	Storage       StorageConfig    `yaml:"storage"`
+	Leases        LeasesConfig     `yaml:"leases"`
+	Crypto        CryptoConfig     `yaml:"crypto"`
+	APIKeys       []APIKeyConfig   `yaml:"api_keys"`
+	TLS           TLSConfig        `yaml:"tls"`
+	RateLimits    RateLimitsConfig `yaml:"rate_limits"`
+	Tracing       TracingConfig    `yaml:"tracing"`
+	Logging       LoggingConfig    `yaml:"logging"`
+	Audit         AuditConfig      `yaml:"audit"`
+	Export        ExportConfig     `yaml:"export"`
+	Backup        BackupConfig     `yaml:"backup"`
+
+	overrides []string
+}
+
+// TimeoutsConfig bounds how long the HTTP server waits for clients.
+type TimeoutsConfig struct {
+	Read     time.Duration `yaml:"read"`     // Reading a request including its body
+	Write    time.Duration `yaml:"write"`    // Writing the response, counted from the end of the request headers
+	Idle     time.Duration `yaml:"idle"`     // Keep-alive connections waiting for the next request
+	Shutdown time.Duration `yaml:"shutdown"` // Grace period for running requests on shutdown
+}
+
+// StorageConfig selects where devices and signatures are kept.
+type StorageConfig struct {
+	Backend string `yaml:"backend"` // memory, journal or postgres
+	// Dir holds the journal and its snapshot for the journal backend, including device private keys
+	Dir             string         `yaml:"dir"`
+	CompactInterval time.Duration  `yaml:"compact_interval"` // How often the journal is compacted into the snapshot
+	Postgres        PostgresConfig `yaml:"postgres"`         // Database of the postgres backend, shared by all instances
+	// MigrateOnStart migrates the storage schema to the latest version before opening it.
+	// Without it an outdated storage is refused until `signer migrate` ran
+	MigrateOnStart bool `yaml:"migrate_on_start"`
+}
+
+// LeasesConfig makes changes to a device exclusive across all instances sharing the storage.
+// Without a backend only the instance's own requests exclude each other.
+type LeasesConfig struct {
+	Backend string `yaml:"backend"` // none (default), redis or postgres
+	// TTL is the longest a request holds a device. Its writes are rejected once the lease was
+	// granted to another instance after expiring, it must exceed the slowest signature
+	TTL   time.Duration `yaml:"ttl"`
+	Redis RedisConfig   `yaml:"redis"`
+	// Postgres has a pool of its own, every device being changed holds one of its connections.
+	// Up to max_conns-1 devices are leased at once, the last connection serves health checks
+	Postgres PostgresConfig `yaml:"postgres"`
+}
+
+// RedisConfig connects to a Redis server, or another server speaking its protocol.
+type RedisConfig struct {
+	Address  string `yaml:"address"` // host:port
+	Username string `yaml:"username"`
+	Password string `yaml:"password"` // Better set with SIGNER_LEASES_REDIS_PASSWORD
+	DB       int    `yaml:"db"`
+	Prefix   string `yaml:"prefix"` // Prepended to all keys, so instances can share a server with others
+}
+
+// PostgresConfig connects to a PostgreSQL database through a pool of connections. Omitted
+// pool settings keep the defaults of the driver, or of the URL's pool_max_conns and friends.
+type PostgresConfig struct {
+	URL             string        `yaml:"url"`                // e.g. postgres://signer@localhost:5432/signer, better set via the environment
+	MaxConns        int32         `yaml:"max_conns"`          // Upper bound of open connections
+	MinConns        int32         `yaml:"min_conns"`          // Connections kept open while idle
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`  // Connections are replaced after this long
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"` // Idle connections above min_conns are closed after this long
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`    // Establishing a new connection
+}
+
+// CryptoConfig restricts the keys generated for new devices. Existing devices keep their keys.
+type CryptoConfig struct {
+	AllowedAlgorithms []string `yaml:"allowed_algorithms"` // RSA and ECC
+	RSAKeyBits        int      `yaml:"rsa_key_bits"`       // 2048, 3072 or 4096
+	ECCCurve          string   `yaml:"ecc_curve"`          // P-256, P-384 or P-521
+}
+
+// AuditConfig stores the audit log durably. Without a path it is kept in memory only.
+// Exports and backups fail if their event cannot be logged. Changes like device updates take
+// effect first, an event failing to log afterwards is only reported in the service log.
+type AuditConfig struct {
+	Path string `yaml:"path"` // JSON lines file, created if missing
+}
+
+// ExportConfig selects the key device exports are signed with.
+type ExportConfig struct {
+	KeyFile string `yaml:"key_file"` // PEM encoded ECDSA or RSA private key, generated on every start if empty
+}
+
+// BackupConfig enables backups of the whole service, encrypted with the key in KeyFile.
+type BackupConfig struct {
+	KeyFile string `yaml:"key_file"` // base64 encoded 32 byte AES key, e.g. from `openssl rand -base64 32`
+}
+
+// LoggingConfig selects the log encoding, console for development or json for log collectors.
+type LoggingConfig struct {
+	Format string `yaml:"format"` // console (default) or json
+	Level  string `yaml:"level"`  // debug, info (default), warn or error
 }
 
+// TracingConfig selects where OpenTelemetry spans are exported to.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`     // none (default), stdout or otlp
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector, e.g. localhost:4318
+	Insecure    bool    `yaml:"insecure"`     // Send OTLP without TLS
+	SampleRatio float64 `yaml:"sample_ratio"` // Fraction of new traces recorded, defaults to 1
+}
+
+// RateLimitsConfig limits the requests per tenant, API key and device. Omitted limits are disabled.
+type RateLimitsConfig struct {
+	Tenant RateLimitConfig `yaml:"tenant"`
+	APIKey RateLimitConfig `yaml:"api_key"`
+	Device RateLimitConfig `yaml:"device"`
+}
+
+// RateLimitConfig is a token bucket refilled with Rate tokens per second up to Burst.
+type RateLimitConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// TLSConfig enables HTTPS if a certificate is configured. Changed files are reloaded without restart.
+type TLSConfig struct {
+	CertFile          string   `yaml:"cert_file"`
+	KeyFile           string   `yaml:"key_file"`
+	MinVersion        string   `yaml:"min_version"`   // "1.2" (default) or "1.3"
+	CipherSuites      []string `yaml:"cipher_suites"` // IANA names, e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	ClientCAFile      string   `yaml:"client_ca_file"`
+	RequireClientCert bool     `yaml:"require_client_cert"`
+	// ClientCertificates authenticates requests by the subject of their verified client certificate
+	ClientCertificates []ClientCertificateConfig `yaml:"client_certificates"`
+}
+
+// ClientCertificateConfig maps a client certificate subject to a tenant and its scopes.
+type ClientCertificateConfig struct {
+	Subject string   `yaml:"subject"` // e.g. "CN=till-1,O=Acme"
+	Tenant  string   `yaml:"tenant"`
+	Scopes  []string `yaml:"scopes"`
+}
+
+// Enabled reports whether HTTPS is configured.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// APIKeyConfig is an API key provisioned at startup. Only the SHA-256 of the key is configured.
+type APIKeyConfig struct {
+	ID     string   `yaml:"id"`
+	Name   string   `yaml:"name"`
+	Tenant string   `yaml:"tenant"` // Organisation the key belongs to, defaults to "default"
+	Hash   string   `yaml:"hash"`   // Hex encoded SHA-256 of the key, e.g. from `make hash-key`
+	Scopes []string `yaml:"scopes"`
+}
+
+// Default returns the configuration used for everything the file and the environment leave out.
+func Default() Config {
+	return Config{
+		ServerAddress: 8080,
+		Timeouts: TimeoutsConfig{
+			Read:     15 * time.Second,
+			Write:    30 * time.Second,
+			Idle:     2 * time.Minute,
+			Shutdown: 5 * time.Second,
+		},
+		Storage: StorageConfig{Backend: StorageMemory, CompactInterval: 10 * time.Minute, MigrateOnStart: true},
+		Leases:  LeasesConfig{Backend: LeasesNone, TTL: 10 * time.Second, Redis: RedisConfig{Prefix: "signer:"}},
+		Crypto: CryptoConfig{
+			AllowedAlgorithms: []string{"RSA", "ECC"},
+			RSAKeyBits:        2048,
+			ECCCurve:          "P-384",
+		},
+		Tracing: TracingConfig{Exporter: "none", SampleRatio: 1},
+		Logging: LoggingConfig{Format: "console", Level: "info"},
+	}
+}
+
+// LoadConfig reads the configuration file over the defaults and applies environment
+// overrides. Unknown keys in the file are rejected, they are usually typos.
 func LoadConfig(path string, config *Config) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -17,11 +200,18 @@ func LoadConfig(path string, config *Config) error {
 	}
 	defer file.Close()
 
+	*config = Default()
 	decoder := yaml.NewDecoder(file)
-	err = decoder.Decode(config)
-	if err != nil {
-		return err
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
 	}
 
-	return nil
+	config.overrides, err = applyEnv(config, os.LookupEnv)
+	return err
+}
+
+// Overrides returns the environment variables that replaced values of the file.
+func (c *Config) Overrides() []string {
+	return c.overrides
 }
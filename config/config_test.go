@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, "server_address: 9000\ntimeouts:\n  read: 5s\n")
+	t.Setenv("SIGNER_TIMEOUTS_WRITE", "1m")
+	t.Setenv("SIGNER_CRYPTO_ALLOWED_ALGORITHMS", "ECC")
+	t.Setenv("SIGNER_LOGGING_LEVEL", "debug")
+
+	var cfg Config
+	if err := LoadConfig(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerAddress != 9000 || cfg.Timeouts.Read != 5*time.Second {
+		t.Errorf("values of the file were not applied: %+v", cfg)
+	}
+	if cfg.Timeouts.Idle != 2*time.Minute || cfg.Timeouts.Shutdown != 5*time.Second || cfg.Crypto.RSAKeyBits != 2048 {
+		t.Errorf("defaults were not applied: %+v", cfg)
+	}
+	if cfg.Timeouts.Write != time.Minute || cfg.Logging.Level != "debug" || !reflect.DeepEqual(cfg.Crypto.AllowedAlgorithms, []string{"ECC"}) {
+		t.Errorf("environment overrides were not applied: %+v", cfg)
+	}
+	want := []string{"SIGNER_TIMEOUTS_WRITE", "SIGNER_CRYPTO_ALLOWED_ALGORITHMS", "SIGNER_LOGGING_LEVEL"}
+	if !reflect.DeepEqual(cfg.Overrides(), want) {
+		t.Errorf("Overrides() = %v, want %v", cfg.Overrides(), want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("valid configuration rejected: %v", err)
+	}
+
+	t.Setenv("SIGNER_TIMEOUTS_READ", "soon")
+	if err := LoadConfig(path, &cfg); err == nil || !strings.Contains(err.Error(), "SIGNER_TIMEOUTS_READ") {
+		t.Errorf("invalid environment value must be rejected naming the variable, got %v", err)
+	}
+}
+
+func TestLoadConfigPoolSizesFromEnv(t *testing.T) {
+	path := writeConfig(t, "")
+	t.Setenv("SIGNER_STORAGE_POSTGRES_MAX_CONNS", "20")
+	t.Setenv("SIGNER_LEASES_POSTGRES_MIN_CONNS", "2")
+
+	var cfg Config
+	if err := LoadConfig(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Storage.Postgres.MaxConns != 20 || cfg.Leases.Postgres.MinConns != 2 {
+		t.Errorf("int32 environment overrides were not applied: %+v %+v", cfg.Storage.Postgres, cfg.Leases.Postgres)
+	}
+
+	t.Setenv("SIGNER_STORAGE_POSTGRES_MAX_CONNS", "3000000000")
+	if err := LoadConfig(path, &cfg); err == nil || !strings.Contains(err.Error(), "SIGNER_STORAGE_POSTGRES_MAX_CONNS") {
+		t.Errorf("values exceeding int32 must be rejected, got %v", err)
+	}
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	path := writeConfig(t, "server_adress: 9000\n")
+	var cfg Config
+	if err := LoadConfig(path, &cfg); err == nil || !strings.Contains(err.Error(), "server_adress") {
+		t.Errorf("unknown field must be rejected, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.GRPCAddress = 70000
+	cfg.Timeouts.Shutdown = 0
+	cfg.Storage.Backend = "sqlite"
+	cfg.Leases.Backend = LeasesRedis
+	cfg.Crypto.AllowedAlgorithms = []string{"DSA"}
+	cfg.Crypto.RSAKeyBits = 1024
+	cfg.APIKeys = []APIKeyConfig{{ID: "ops", Hash: "abc", Scopes: []string{"root"}}}
+	cfg.TLS.KeyFile = "server.key"
+	cfg.RateLimits.Device = RateLimitConfig{Rate: 10}
+	cfg.Logging.Format = "xml"
+
+	err := cfg.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	for _, want := range []string{
+		"grpc_address", "timeouts.shutdown", "storage.backend", "leases.redis.address", `unknown algorithm "DSA"`, "crypto.rsa_key_bits",
+		"api_keys[0] (ops) needs a hash", `unknown scope "root"`, "tls.key_file", "rate_limits.device", "logging.format",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("report does not mention %q:\n%v", want, err)
+		}
+	}
+	if len(validationErr.Problems) != 11 {
+		t.Errorf("expected 11 problems, got %d:\n%v", len(validationErr.Problems), err)
+	}
+
+	cfg = Default()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults must be valid: %v", err)
+	}
+}
+
+func TestValidatePostgres(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.Backend = StoragePostgres
+	cfg.Storage.Postgres = PostgresConfig{MaxConns: 4, MinConns: 8}
+	err := cfg.Validate()
+	for _, want := range []string{"storage.postgres.url", "storage.postgres.min_conns must not exceed max_conns"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("report does not mention %q:\n%v", want, err)
+		}
+	}
+
+	cfg.Storage.Postgres = PostgresConfig{URL: "postgres://signer@localhost:5432/signer", MaxConns: 8}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("valid postgres configuration rejected: %v", err)
+	}
+
+	cfg.Leases.Backend = LeasesPostgres
+	cfg.Leases.Postgres = PostgresConfig{URL: "postgres://signer@localhost:5432/signer", MaxConns: 1}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "leases.postgres.max_conns must be at least 2") {
+		t.Errorf("a lease pool without a connection for health checks must be rejected, got %v", err)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	running := Default()
+	next := Default()
+	next.RateLimits.Device = RateLimitConfig{Rate: 5, Burst: 10}
+	next.Logging.Level = "debug"
+	next.Crypto.AllowedAlgorithms = []string{"ECC"}
+	if changed := RestartRequired(&running, &next); len(changed) != 0 {
+		t.Errorf("only reloadable settings changed, got %v", changed)
+	}
+
+	next.Timeouts.Read = time.Second
+	next.Logging.Format = "json"
+	next.APIKeys = []APIKeyConfig{{ID: "ops"}}
+	want := []string{"timeouts.read", "api_keys", "logging.format"}
+	if changed := RestartRequired(&running, &next); !reflect.DeepEqual(changed, want) {
+		t.Errorf("RestartRequired() = %v, want %v", changed, want)
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the environment variables overriding the configuration. The rest of the
+// name is the upper-cased path of YAML keys, e.g. SIGNER_TIMEOUTS_READ=10s or
+// SIGNER_CRYPTO_ALLOWED_ALGORITHMS=ECC. Lists are comma separated, lists of objects such
+// as api_keys can only be set in the file.
+const EnvPrefix = "SIGNER_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func applyEnv(config *Config, lookup func(string) (string, bool)) ([]string, error) {
+	var applied []string
+	err := applyEnvFields(reflect.ValueOf(config).Elem(), EnvPrefix, lookup, &applied)
+	return applied, err
+}
+
+func applyEnvFields(value reflect.Value, prefix string, lookup func(string) (string, bool), applied *[]string) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := applyEnvFields(value.Field(i), name+"_", lookup, applied); err != nil {
+				return err
+			}
+			continue
+		}
+
+		text, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(value.Field(i), text); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*applied = append(*applied, name)
+	}
+	return nil
+}
+
+func setFromString(field reflect.Value, text string) error {
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.String:
+		field.SetString(text)
+	case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+		number, err := strconv.ParseInt(text, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(number)
+	case field.Kind() == reflect.Float64:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(number)
+	case field.Kind() == reflect.Bool:
+		flag, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		field.SetBool(flag)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		items := make([]string, 0)
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s values can only be configured in the file", field.Type())
+	}
+	return nil
+}
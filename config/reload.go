@@ -0,0 +1,39 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// reloadable are the settings a running service applies on reload, by YAML path. Everything
+// else is read once on startup.
+var reloadable = []string{"rate_limits", "logging.level", "crypto"}
+
+// RestartRequired returns the YAML paths of the settings that differ between the running and
+// the next configuration but are only applied on restart.
+func RestartRequired(running, next *Config) []string {
+	var changed []string
+	diffFields(reflect.ValueOf(running).Elem(), reflect.ValueOf(next).Elem(), "", &changed)
+	return changed
+}
+
+func diffFields(running, next reflect.Value, prefix string, changed *[]string) {
+	for i := 0; i < running.NumField(); i++ {
+		field := running.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		path := prefix + key
+		if contains(reloadable, path) {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			diffFields(running.Field(i), next.Field(i), path+".", changed)
+			continue
+		}
+		if !reflect.DeepEqual(running.Field(i).Interface(), next.Field(i).Interface()) {
+			*changed = append(*changed, path)
+		}
+	}
+}
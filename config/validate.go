@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+const (
+	// StorageMemory keeps all state in memory, it is lost on restart.
+	StorageMemory = "memory"
+	// StorageJournal keeps all state in memory and journals every change to disk.
+	StorageJournal = "journal"
+	// StoragePostgres keeps all state in a PostgreSQL database shared by all instances.
+	StoragePostgres = "postgres"
+
+	// LeasesNone relies on the device locks of each instance.
+	LeasesNone = "none"
+	// LeasesRedis keeps device leases in Redis.
+	LeasesRedis = "redis"
+	// LeasesPostgres holds device leases as PostgreSQL advisory locks.
+	LeasesPostgres = "postgres"
+)
+
+var (
+	storageBackends = []string{StorageMemory, StorageJournal, StoragePostgres}
+	leaseBackends   = []string{LeasesNone, LeasesRedis, LeasesPostgres}
+	logFormats      = []string{"console", "json"}
+	logLevels       = []string{"debug", "info", "warn", "error"}
+	traceExporters  = []string{"none", "stdout", "otlp"}
+	tlsVersions     = []string{"", "1.2", "1.3"}
+	rsaKeySizes     = []int{2048, 3072, 4096}
+	eccCurves       = []string{"P-256", "P-384", "P-521"}
+)
+
+// ValidationError lists every problem of a configuration, so all of them can be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration and returns a *ValidationError listing all problems.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.ServerAddress > 0 && c.ServerAddress < 65536, "server_address must be a port between 1 and 65535, got %d", c.ServerAddress)
+	check(c.GRPCAddress >= 0 && c.GRPCAddress < 65536, "grpc_address must be a port between 1 and 65535 or 0, got %d", c.GRPCAddress)
+	check(c.GRPCAddress != c.ServerAddress, "grpc_address and server_address must differ, both are %d", c.ServerAddress)
+
+	check(c.Timeouts.Read >= 0, "timeouts.read must not be negative")
+	check(c.Timeouts.Write >= 0, "timeouts.write must not be negative")
+	check(c.Timeouts.Idle >= 0, "timeouts.idle must not be negative")
+	check(c.Timeouts.Shutdown > 0, "timeouts.shutdown must be positive")
+
+	check(contains(storageBackends, c.Storage.Backend), "storage.backend must be one of %v, got %q", storageBackends, c.Storage.Backend)
+	if c.Storage.Backend == StorageJournal {
+		check(c.Storage.Dir != "", "storage.dir is required for the journal backend")
+		check(c.Storage.CompactInterval > 0, "storage.compact_interval must be positive")
+	}
+	if c.Storage.Backend == StoragePostgres {
+		check(c.Storage.Postgres.URL != "", "storage.postgres.url is required for the postgres backend")
+		checkPostgres(check, "storage.postgres", c.Storage.Postgres)
+	}
+
+	check(contains(leaseBackends, c.Leases.Backend), "leases.backend must be one of %v, got %q", leaseBackends, c.Leases.Backend)
+	if c.Leases.Backend != LeasesNone {
+		check(c.Leases.TTL > 0, "leases.ttl must be positive")
+	}
+	check(c.Leases.Backend != LeasesRedis || c.Leases.Redis.Address != "", "leases.redis.address is required for the redis backend")
+	if c.Leases.Backend == LeasesPostgres {
+		check(c.Leases.Postgres.URL != "", "leases.postgres.url is required for the postgres backend")
+		checkPostgres(check, "leases.postgres", c.Leases.Postgres)
+		check(c.Leases.Postgres.MaxConns == 0 || c.Leases.Postgres.MaxConns >= 2,
+			"leases.postgres.max_conns must be at least 2, one connection is kept for health checks")
+	}
+
+	check(len(c.Crypto.AllowedAlgorithms) > 0, "crypto.allowed_algorithms must allow at least one algorithm")
+	for _, algorithm := range c.Crypto.AllowedAlgorithms {
+		check(domain.Algorithm(algorithm) == domain.AlgorithmRSA || domain.Algorithm(algorithm) == domain.AlgorithmECC,
+			"crypto.allowed_algorithms contains unknown algorithm %q, use RSA or ECC", algorithm)
+	}
+	check(containsInt(rsaKeySizes, c.Crypto.RSAKeyBits), "crypto.rsa_key_bits must be one of %v, got %d", rsaKeySizes, c.Crypto.RSAKeyBits)
+	check(contains(eccCurves, c.Crypto.ECCCurve), "crypto.ecc_curve must be one of %v, got %q", eccCurves, c.Crypto.ECCCurve)
+
+	for i, key := range c.APIKeys {
+		check(key.ID != "", "api_keys[%d] needs an id", i)
+		decoded, err := hex.DecodeString(key.Hash)
+		check(err == nil && len(decoded) == 32, "api_keys[%d] (%s) needs a hash of 64 hex characters", i, key.ID)
+		for _, scope := range key.Scopes {
+			check(domain.Scope(scope).Valid(), "api_keys[%d] (%s) has unknown scope %q", i, key.ID, scope)
+		}
+	}
+
+	if c.TLS.Enabled() {
+		check(c.TLS.KeyFile != "", "tls.key_file is required with tls.cert_file")
+		check(contains(tlsVersions, c.TLS.MinVersion), "tls.min_version must be 1.2 or 1.3, got %q", c.TLS.MinVersion)
+		check(!c.TLS.RequireClientCert || c.TLS.ClientCAFile != "", "tls.require_client_cert needs a tls.client_ca_file")
+		check(len(c.TLS.ClientCertificates) == 0 || c.TLS.ClientCAFile != "", "tls.client_certificates need a tls.client_ca_file")
+		for i, client := range c.TLS.ClientCertificates {
+			for _, scope := range client.Scopes {
+				check(domain.Scope(scope).Valid(), "tls.client_certificates[%d] (%s) has unknown scope %q", i, client.Subject, scope)
+			}
+		}
+	} else {
+		check(c.TLS.KeyFile == "" && c.TLS.ClientCAFile == "", "tls.key_file and tls.client_ca_file need a tls.cert_file")
+	}
+
+	for _, limit := range []struct {
+		name string
+		RateLimitConfig
+	}{{"tenant", c.RateLimits.Tenant}, {"api_key", c.RateLimits.APIKey}, {"device", c.RateLimits.Device}} {
+		check(limit.Rate >= 0 && limit.Burst >= 0, "rate_limits.%s must not be negative", limit.name)
+		check(limit.Rate == 0 || limit.Burst > 0, "rate_limits.%s needs a burst of at least 1", limit.name)
+	}
+
+	check(contains(traceExporters, c.Tracing.Exporter), "tracing.exporter must be one of %v, got %q", traceExporters, c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+
+	check(contains(logFormats, c.Logging.Format), "logging.format must be one of %v, got %q", logFormats, c.Logging.Format)
+	check(contains(logLevels, c.Logging.Level), "logging.level must be one of %v, got %q", logLevels, c.Logging.Level)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// checkPostgres checks the pool settings of a database connection configured at path.
+func checkPostgres(check func(ok bool, format string, args ...any), path string, c PostgresConfig) {
+	check(c.MaxConns >= 0 && c.MinConns >= 0, "%s.max_conns and min_conns must not be negative", path)
+	check(c.MaxConns == 0 || c.MinConns <= c.MaxConns, "%s.min_conns must not exceed max_conns", path)
+	check(c.MaxConnLifetime >= 0 && c.MaxConnIdleTime >= 0 && c.ConnectTimeout >= 0,
+		"%s.max_conn_lifetime, max_conn_idle_time and connect_timeout must not be negative", path)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
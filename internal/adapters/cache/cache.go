@@ -5,12 +5,26 @@ import (
 	"github.com/ashermp9/fiskaly-test-task/pkg/cache"
 )
 
+// DeviceKey identifies a device within its tenant. Devices and their locks are keyed by it,
+// so equal device IDs of different tenants never share data or a lock.
+type DeviceKey struct {
+	TenantID string
+	DeviceID string
+}
+
 type InMemoryStorage struct {
-	DeviceCache *cache.Cache[string, domain.SignatureDevice]
+	DeviceCache      *cache.Cache[DeviceKey, domain.SignatureDevice]
+	TransactionCache *cache.Cache[DeviceKey, []domain.Transaction]
+	APIKeyCache      *cache.Cache[string, domain.APIKey]
+	// FenceCache holds the highest fencing token a device was written with
+	FenceCache *cache.Cache[DeviceKey, uint64]
 }
 
 func NewInMemoryStorage() *InMemoryStorage {
 	return &InMemoryStorage{
-		DeviceCache: cache.NewCache[string, domain.SignatureDevice](),
+		DeviceCache:      cache.NewCache[DeviceKey, domain.SignatureDevice](),
+		TransactionCache: cache.NewCache[DeviceKey, []domain.Transaction](),
+		APIKeyCache:      cache.NewCache[string, domain.APIKey](),
+		FenceCache:       cache.NewCache[DeviceKey, uint64](),
 	}
 }
@@ -1,80 +1,148 @@
 package crypto
 
 import (
+	"context"
+	"crypto/elliptic"
 	"fmt"
 	"sync"
 
 	"github.com/ashermp9/fiskaly-test-task/internal/domain"
 	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// CryptoManager manages cryptographic generators and signers.
+var tracer = otel.Tracer("github.com/ashermp9/fiskaly-test-task/internal/adapters/crypto")
+
+// Policy restricts the keys generated for new devices. Devices created before a policy
+// change keep signing with their keys.
+type Policy struct {
+	AllowedAlgorithms []domain.Algorithm // Empty allows every algorithm
+	RSAKeyBits        int                // Defaults to crypto.DefaultRSAKeyBits
+	ECCCurve          string             // P-256, P-384 (default) or P-521
+}
+
+// CryptoManager manages cryptographic generators and signers. Signers are not cached, the
+// private keys of devices are only held in memory while signing.
 type CryptoManager struct {
 	generators map[domain.Algorithm]crypto.KeyGenerator
-	signers    map[domain.Algorithm]crypto.Signer
+	policy     Policy
 	mu         sync.RWMutex
 }
 
 // NewCryptoManager creates a new instance of CryptoManager.
 func NewCryptoManager() *CryptoManager {
 	return &CryptoManager{
-		generators: make(map[domain.Algorithm]crypto.KeyGenerator),
-		signers:    make(map[domain.Algorithm]crypto.Signer),
+		generators: newGenerators(Policy{}, nil),
 	}
 }
 
-// GetGenerator retrieves a key generator based on the specified algorithm.
+// SetPolicy replaces the policy for keys generated from now on.
+func (m *CryptoManager) SetPolicy(policy Policy) error {
+	var curve elliptic.Curve
+	if policy.ECCCurve != "" {
+		var err error
+		if curve, err = crypto.CurveByName(policy.ECCCurve); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+	m.generators = newGenerators(policy, curve)
+	return nil
+}
+
+func newGenerators(policy Policy, curve elliptic.Curve) map[domain.Algorithm]crypto.KeyGenerator {
+	return map[domain.Algorithm]crypto.KeyGenerator{
+		domain.AlgorithmRSA: &crypto.RSAGenerator{Bits: policy.RSAKeyBits},
+		domain.AlgorithmECC: &crypto.ECCGenerator{Curve: curve},
+	}
+}
+
+// GetGenerator retrieves a key generator based on the specified algorithm. Algorithms the
+// policy does not allow are rejected with domain.ErrAlgorithmNotAllowed.
 func (m *CryptoManager) GetGenerator(algorithm domain.Algorithm) (crypto.KeyGenerator, error) {
 	m.mu.RLock()
-	generator, exists := m.generators[algorithm]
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
 
+	generator, exists := m.generators[algorithm]
 	if !exists {
-		switch algorithm {
-		case domain.AlgorithmRSA:
-			generator = &crypto.RSAGenerator{}
-		case domain.AlgorithmECC:
-			generator = &crypto.ECCGenerator{}
-		default:
-			return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
-		}
-
-		m.mu.Lock()
-		m.generators[algorithm] = generator
-		m.mu.Unlock()
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	if !m.policy.allows(algorithm) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrAlgorithmNotAllowed, algorithm)
 	}
-
 	return generator, nil
 }
 
-// GetSigner retrieves a signer based on the specified algorithm and private key.
-func (m *CryptoManager) GetSigner(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error) {
-	m.mu.RLock()
-	signer, exists := m.signers[algorithm]
-	m.mu.RUnlock()
+func (p Policy) allows(algorithm domain.Algorithm) bool {
+	if len(p.AllowedAlgorithms) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedAlgorithms {
+		if allowed == algorithm {
+			return true
+		}
+	}
+	return false
+}
 
-	if !exists {
-		switch algorithm {
-		case domain.AlgorithmRSA:
-			rsaKeyPair, err := crypto.NewRSAMarshaler().Unmarshal(privateKey)
-			if err != nil {
-				return nil, err
-			}
-			signer = crypto.NewRSASigner(rsaKeyPair.Private)
-		case domain.AlgorithmECC:
-			eccKeyPair, err := crypto.NewECCMarshaler().Decode(privateKey)
-			if err != nil {
-				return nil, err
-			}
-			signer = crypto.NewECDSASigner(eccKeyPair.Private)
-		default:
-			return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+// GetSigner decodes the private key of a device into its signer.
+func (m *CryptoManager) GetSigner(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error) {
+	switch algorithm {
+	case domain.AlgorithmRSA:
+		rsaKeyPair, err := crypto.NewRSAMarshaler().Unmarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.NewRSASigner(rsaKeyPair.Private), nil
+	case domain.AlgorithmECC:
+		eccKeyPair, err := crypto.NewECCMarshaler().Decode(privateKey)
+		if err != nil {
+			return nil, err
 		}
+		return crypto.NewECDSASigner(eccKeyPair.Private), nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
 
-		m.mu.Lock()
-		m.signers[algorithm] = signer
-		m.mu.Unlock()
+// GenerateKeys creates an encoded key pair for the algorithm.
+func (m *CryptoManager) GenerateKeys(ctx context.Context, algorithm domain.Algorithm) ([]byte, []byte, error) {
+	_, span := tracer.Start(ctx, "CryptoManager.GenerateKeys",
+		trace.WithAttributes(attribute.String("signer.algorithm", string(algorithm))))
+	defer span.End()
+
+	generator, err := m.GetGenerator(algorithm)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+	publicKey, privateKey, err := generator.GenerateBytes()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 	}
+	return publicKey, privateKey, err
+}
+
+// Sign signs data with the encoded private key of the algorithm.
+func (m *CryptoManager) Sign(ctx context.Context, algorithm domain.Algorithm, privateKey, data []byte) ([]byte, error) {
+	_, span := tracer.Start(ctx, "CryptoManager.Sign",
+		trace.WithAttributes(attribute.String("signer.algorithm", string(algorithm))))
+	defer span.End()
 
-	return signer, nil
+	signer, err := m.GetSigner(algorithm, privateKey)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	signature, err := signer.Sign(data)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return signature, err
 }
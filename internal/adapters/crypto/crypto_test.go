@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+// TestDevicesSignWithTheirOwnKeys signs with two devices of each algorithm. Every signature
+// must verify against the public key of its device only.
+func TestDevicesSignWithTheirOwnKeys(t *testing.T) {
+	ctx := context.Background()
+	manager := NewCryptoManager()
+	for _, algorithm := range []domain.Algorithm{domain.AlgorithmECC, domain.AlgorithmRSA} {
+		var publicKeys, signatures [][]byte
+		for i := 0; i < 2; i++ {
+			publicKey, privateKey, err := manager.GenerateKeys(ctx, algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := manager.Sign(ctx, algorithm, privateKey, []byte("receipt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			publicKeys, signatures = append(publicKeys, publicKey), append(signatures, signature)
+		}
+
+		for i, publicKey := range publicKeys {
+			verifier, err := crypto.NewVerifier(publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifier.Verify([]byte("receipt"), signatures[i]); err != nil {
+				t.Errorf("%s device %d: signature does not verify against its key: %v", algorithm, i, err)
+			}
+			if err := verifier.Verify([]byte("receipt"), signatures[1-i]); err == nil {
+				t.Errorf("%s device %d: the signature of the other device must not verify", algorithm, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package lease grants device leases across the instances of the service, see app.Leaser.
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	minPollInterval = 5 * time.Millisecond
+	maxPollInterval = 100 * time.Millisecond
+)
+
+// newOwner returns a random identity for the holder of a lease.
+func newOwner() (string, error) {
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(owner), nil
+}
+
+// poll calls try until it succeeds, fails or ctx is done, waiting longer after every attempt.
+func poll(ctx context.Context, try func() (bool, error)) error {
+	interval := minPollInterval
+	for {
+		done, err := try()
+		if done || err != nil {
+			return err
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		interval = min(2*interval, maxPollInterval)
+	}
+}
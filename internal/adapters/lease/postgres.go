@@ -0,0 +1,160 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fencesTable holds the last fencing token granted per key.
+const fencesTable = `CREATE TABLE IF NOT EXISTS lease_fences (
+	key   TEXT PRIMARY KEY,
+	token BIGINT NOT NULL
+)`
+
+// AdvisoryLeaser grants leases with PostgreSQL session advisory locks. Every lease holds a
+// connection of the pool, the lock ends with the session if the instance dies. Leases are
+// released when their TTL has passed, so a stuck request cannot block a device forever.
+//
+// The pool should be dedicated to the leaser. It holds up to MaxConns-1 leases at once, the
+// last connection is kept for Ping. Further requests wait for a lease to be released without
+// holding a connection, so waiting on busy devices cannot starve the others.
+type AdvisoryLeaser struct {
+	pool  *pgxpool.Pool
+	slots chan struct{} // One per held lease, bounded to leave a connection for Ping
+
+	mu   sync.Mutex
+	held map[string]*advisoryLease // By owner
+}
+
+type advisoryLease struct {
+	conn   *pgxpool.Conn
+	lockID int64
+	expiry *time.Timer
+}
+
+// NewAdvisoryLeaser creates a leaser on pool and the table of fencing tokens if missing. The
+// pool needs at least two connections.
+func NewAdvisoryLeaser(ctx context.Context, pool *pgxpool.Pool) (*AdvisoryLeaser, error) {
+	slots := pool.Config().MaxConns - 1
+	if slots < 1 {
+		return nil, fmt.Errorf("the lease pool needs at least 2 connections, got %d", pool.Config().MaxConns)
+	}
+	if _, err := pool.Exec(ctx, fencesTable); err != nil {
+		return nil, fmt.Errorf("failed to create the lease fences table: %w", err)
+	}
+	return &AdvisoryLeaser{pool: pool, slots: make(chan struct{}, slots), held: make(map[string]*advisoryLease)}, nil
+}
+
+// lockID maps a key to the 64 bit key space of advisory locks.
+func lockID(key string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return int64(hash.Sum64())
+}
+
+// Acquire waits until the lock of key is free and holds it for ttl.
+func (l *AdvisoryLeaser) Acquire(ctx context.Context, key string, ttl time.Duration) (domain.Lease, error) {
+	owner, err := newOwner()
+	if err != nil {
+		return domain.Lease{}, err
+	}
+	id := lockID(key)
+	var conn *pgxpool.Conn
+	err = poll(ctx, func() (bool, error) {
+		conn, err = l.tryLock(ctx, id)
+		return conn != nil, err
+	})
+	if err != nil {
+		return domain.Lease{}, fmt.Errorf("failed to acquire the lease %s: %w", key, err)
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	// Holding the lock, nobody else increments the token of key
+	var token int64
+	err = conn.QueryRow(ctx, `INSERT INTO lease_fences (key, token) VALUES ($1, 1)
+		ON CONFLICT (key) DO UPDATE SET token = lease_fences.token + 1 RETURNING token`, key).Scan(&token)
+	if err != nil {
+		l.unlock(conn, id)
+		return domain.Lease{}, fmt.Errorf("failed to increment the fencing token of %s: %w", key, err)
+	}
+
+	lease := domain.Lease{Key: key, Token: uint64(token), Owner: owner, ExpiresAt: expiresAt}
+	l.mu.Lock()
+	l.held[owner] = &advisoryLease{
+		conn:   conn,
+		lockID: id,
+		expiry: time.AfterFunc(time.Until(expiresAt), func() { l.Release(context.Background(), lease) }),
+	}
+	l.mu.Unlock()
+	return lease, nil
+}
+
+// tryLock takes a slot and a connection and tries to lock id once. It returns the connection
+// holding the lock, or nil and gives both back if the lock is taken or there is no free slot.
+func (l *AdvisoryLeaser) tryLock(ctx context.Context, id int64) (*pgxpool.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		return nil, nil
+	}
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", id).Scan(&locked); err != nil {
+		// The lock may have been taken before the error, ending the session releases it
+		conn.Conn().Close(context.Background())
+		conn.Release()
+		<-l.slots
+		return nil, err
+	}
+	if !locked {
+		conn.Release()
+		<-l.slots
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// Release unlocks the lease unless it expired already.
+func (l *AdvisoryLeaser) Release(_ context.Context, lease domain.Lease) error {
+	l.mu.Lock()
+	held, found := l.held[lease.Owner]
+	delete(l.held, lease.Owner)
+	l.mu.Unlock()
+	if !found {
+		return nil
+	}
+	held.expiry.Stop()
+	return l.unlock(held.conn, held.lockID)
+}
+
+// unlock releases the advisory lock and returns the connection to the pool and its slot. A
+// connection whose unlock failed is closed instead, ending its session releases the lock.
+func (l *AdvisoryLeaser) unlock(conn *pgxpool.Conn, id int64) error {
+	defer func() { <-l.slots }()
+	// Unlock even if the caller's request was cancelled, the connection goes back to the pool
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", id); err != nil {
+		conn.Conn().Close(ctx)
+		conn.Release()
+		return fmt.Errorf("failed to release the advisory lock: %w", err)
+	}
+	conn.Release()
+	return nil
+}
+
+// Ping checks that the database is reachable. It has a connection of its own even while
+// every other one holds a lease.
+func (l *AdvisoryLeaser) Ping(ctx context.Context) error {
+	return l.pool.Ping(ctx)
+}
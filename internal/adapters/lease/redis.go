@@ -0,0 +1,83 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript takes the lease if it is free and increments the fencing token of the key in
+// the same step, so tokens are ordered like the leases they belong to. Returns 0 if taken.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease only if it is still held by the owner, it may have expired
+// and been granted to another instance.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLeaser grants leases stored in Redis, or any server speaking its protocol and running
+// Lua scripts. A lease is a key holding the owner that expires with the lease, the fencing
+// token a counter next to it.
+type RedisLeaser struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisLeaser creates a leaser storing its keys under prefix.
+func NewRedisLeaser(client redis.UniversalClient, prefix string) *RedisLeaser {
+	return &RedisLeaser{client: client, prefix: prefix}
+}
+
+// keys returns the lease and the fencing token key. The hash tag keeps both in one slot of a
+// Redis cluster, scripts may only access keys of one slot.
+func (l *RedisLeaser) keys(key string) []string {
+	return []string{l.prefix + "lease:{" + key + "}", l.prefix + "fence:{" + key + "}"}
+}
+
+// Acquire waits until the lease on key is free and takes it for ttl.
+func (l *RedisLeaser) Acquire(ctx context.Context, key string, ttl time.Duration) (domain.Lease, error) {
+	owner, err := newOwner()
+	if err != nil {
+		return domain.Lease{}, err
+	}
+	lease := domain.Lease{Key: key, Owner: owner}
+	err = poll(ctx, func() (bool, error) {
+		start := time.Now()
+		token, err := acquireScript.Run(ctx, l.client, l.keys(key), owner, ttl.Milliseconds()).Uint64()
+		if err != nil {
+			return false, fmt.Errorf("failed to acquire the lease %s: %w", key, err)
+		}
+		// Measured from before the request, the server's clock started later
+		lease.Token, lease.ExpiresAt = token, start.Add(ttl)
+		return token != 0, nil
+	})
+	if err != nil {
+		return domain.Lease{}, err
+	}
+	return lease, nil
+}
+
+// Release gives up the lease unless it expired already.
+func (l *RedisLeaser) Release(ctx context.Context, lease domain.Lease) error {
+	if err := releaseScript.Run(ctx, l.client, l.keys(lease.Key)[:1], lease.Owner).Err(); err != nil {
+		return fmt.Errorf("failed to release the lease %s: %w", lease.Key, err)
+	}
+	return nil
+}
+
+// Ping checks that the server is reachable.
+func (l *RedisLeaser) Ping(ctx context.Context) error {
+	return l.client.Ping(ctx).Err()
+}
@@ -0,0 +1,160 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisLeaser(t *testing.T) (*RedisLeaser, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisLeaser(client, "signer:"), server
+}
+
+func acquire(t *testing.T, leaser app.Leaser, key string, ttl time.Duration) domain.Lease {
+	t.Helper()
+	lease, err := leaser.Acquire(context.Background(), key, ttl)
+	if err != nil {
+		t.Fatalf("failed to acquire %s: %v", key, err)
+	}
+	return lease
+}
+
+func TestRedisLeaseExclusive(t *testing.T) {
+	leaser, _ := newTestRedisLeaser(t)
+	first := acquire(t, leaser, "device/default/till-1", time.Minute)
+	other := acquire(t, leaser, "device/default/till-2", time.Minute)
+	if first.Token != 1 || other.Token != 1 {
+		t.Errorf("tokens are counted per key, got %d and %d", first.Token, other.Token)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := leaser.Acquire(ctx, first.Key, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("a held lease must not be granted twice, got %v", err)
+	}
+
+	// Releasing with another owner, like a holder whose lease expired, leaves the lease alone
+	if err := leaser.Release(context.Background(), domain.Lease{Key: first.Key, Owner: "someone"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := leaser.Acquire(ctx, first.Key, time.Minute); err == nil {
+		t.Fatal("the lease was released by a different owner")
+	}
+
+	if err := leaser.Release(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	if second := acquire(t, leaser, first.Key, time.Minute); second.Token <= first.Token {
+		t.Errorf("fencing tokens must increase, got %d after %d", second.Token, first.Token)
+	}
+}
+
+func TestRedisLeaseWaits(t *testing.T) {
+	leaser, _ := newTestRedisLeaser(t)
+	held := acquire(t, leaser, "device/default/till-1", time.Minute)
+
+	acquired := make(chan domain.Lease)
+	go func() {
+		lease, err := leaser.Acquire(context.Background(), held.Key, time.Minute)
+		if err != nil {
+			t.Errorf("waiting for the lease failed: %v", err)
+		}
+		acquired <- lease
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := leaser.Release(context.Background(), held); err != nil {
+		t.Fatal(err)
+	}
+	if lease := <-acquired; lease.Token != held.Token+1 {
+		t.Errorf("expected token %d for the waiting request, got %d", held.Token+1, lease.Token)
+	}
+}
+
+// TestExpiredLeaseIsFenced lets a lease expire while its holder is still working. The storage
+// must reject the holder's writes once the next lease was used.
+func TestExpiredLeaseIsFenced(t *testing.T) {
+	leaser, server := newTestRedisLeaser(t)
+	stor := storage.NewStorage()
+	request := domain.CreateDeviceRequest{ID: "till-1", Algorithm: domain.AlgorithmECC}
+	if _, err := app.NewAPIService(stor).CreateDevice(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := acquire(t, leaser, "device/default/till-1", time.Second)
+	server.FastForward(2 * time.Second)
+	current := acquire(t, leaser, stale.Key, time.Second)
+
+	transaction := domain.Transaction{TenantID: domain.DefaultTenantID, DeviceID: "till-1", Signature: []byte("first")}
+	ctx := domain.ContextWithFencingToken(context.Background(), current.Token)
+	if err := stor.CommitSignature(ctx, transaction); err != nil {
+		t.Fatal(err)
+	}
+	transaction.Counter, transaction.Signature = 1, []byte("second")
+	ctx = domain.ContextWithFencingToken(context.Background(), stale.Token)
+	if err := stor.CommitSignature(ctx, transaction); !errors.Is(err, domain.ErrLeaseExpired) {
+		t.Errorf("a write under the expired lease must be fenced, got %v", err)
+	}
+}
+
+// instance shares a storage like a separate process would: its device locks exclude nobody
+// else, only the leases do.
+type instance struct {
+	*storage.Storage
+	locks sync.Map
+}
+
+func (i *instance) LockDevice(_ context.Context, deviceID string) {
+	lock, _ := i.locks.LoadOrStore(deviceID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+}
+
+func (i *instance) UnlockDevice(_ context.Context, deviceID string) {
+	lock, _ := i.locks.Load(deviceID)
+	lock.(*sync.Mutex).Unlock()
+}
+
+func TestLeasedInstancesDoNotConflict(t *testing.T) {
+	leaser, _ := newTestRedisLeaser(t)
+	stor := storage.NewStorage()
+	request := domain.CreateDeviceRequest{ID: "till-1", Algorithm: domain.AlgorithmECC}
+	if _, err := app.NewAPIService(stor).CreateDevice(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	const instances, signatures = 4, 10
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service := app.NewAPIService(&instance{Storage: stor}, app.WithLeases(leaser, time.Minute))
+			for j := 0; j < signatures; j++ {
+				request := domain.SignTransactionRequest{DeviceID: "till-1", Data: "receipt"}
+				if _, err := service.SignTransaction(context.Background(), request); err != nil {
+					t.Errorf("signing under a lease failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	device, _ := stor.GetDevice(context.Background(), "till-1")
+	if device.SignatureCounter != instances*signatures {
+		t.Errorf("expected %d signatures, got %d", instances*signatures, device.SignatureCounter)
+	}
+}
@@ -0,0 +1,97 @@
+// Package logging builds the service logger and carries request-scoped loggers in contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// maxRequestIDLength bounds request IDs taken from clients, they end up in every log line.
+const maxRequestIDLength = 128
+
+type loggerKey struct{}
+
+// ParseLevel returns a level for New that can be changed while the logger is in use. An empty
+// level is info.
+func ParseLevel(level string) (zap.AtomicLevel, error) {
+	if level == "" {
+		return zap.NewAtomicLevel(), nil
+	}
+	parsed, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return zap.AtomicLevel{}, fmt.Errorf("invalid log level: %w", err)
+	}
+	return zap.NewAtomicLevelAt(parsed), nil
+}
+
+// New builds a logger writing human-readable console lines or JSON. Changes of the level
+// apply to the logger and everything derived from it.
+func New(format string, level zap.AtomicLevel) (*zap.Logger, error) {
+	var config zap.Config
+	switch format {
+	case "", FormatConsole:
+		config = zap.NewDevelopmentConfig()
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // Capitalized and colored level
+	case FormatJSON:
+		config = zap.NewProductionConfig()
+		config.EncoderConfig.TimeKey = "time"
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use console or json", format)
+	}
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder   // Human-readable time format
+	config.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder // Short caller format
+
+	config.Level = level
+	return config.Build()
+}
+
+// WithLogger returns a context carrying the logger of the current request.
+func WithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the current request, or a logger discarding everything.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return zap.NewNop().Sugar()
+}
+
+// RequestID returns the ID a client sent to correlate a request, or a new random one if the
+// client sent none or one that is too long or contains anything but letters, digits and -_.:
+func RequestID(sent string) string {
+	if validRequestID(sent) {
+		return sent
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Errorf("failed to generate request ID: %w", err))
+	}
+	return hex.EncodeToString(id)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+// Package metrics collects Prometheus metrics of the HTTP API and the signing service.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "signer"
+
+// Metrics owns a registry with all metrics of the service. It implements app.Observer.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests      *prometheus.CounterVec
+	httpDuration      *prometheus.HistogramVec
+	signingDuration   *prometheus.HistogramVec
+	keygenDuration    *prometheus.HistogramVec
+	lockWait          prometheus.Histogram
+	signaturesCreated *prometheus.CounterVec
+}
+
+// New creates the metrics including the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		signingDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "signing_duration_seconds",
+			Help:      "Time to sign a transaction by algorithm.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+		}, []string{"algorithm"}),
+		keygenDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Time to generate the key pair of a device by algorithm.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"algorithm"}),
+		lockWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "device_lock_wait_seconds",
+			Help:      "Time spent waiting for a device lock.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 12),
+		}),
+		signaturesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signatures_total",
+			Help:      "Signatures created by algorithm.",
+		}, []string{"algorithm"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.signingDuration,
+		m.keygenDuration,
+		m.lockWait,
+		m.signaturesCreated,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// MustRegister adds collectors owned by other components, e.g. the rate limiter.
+func (m *Metrics) MustRegister(collectors ...prometheus.Collector) {
+	m.registry.MustRegister(collectors...)
+}
+
+// RegisterDeviceCount exports the number of devices, counted on every scrape.
+func (m *Metrics) RegisterDeviceCount(count func() int) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "devices",
+		Help:      "Number of signature devices across all tenants.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// ObserveHTTPRequest records a handled HTTP request.
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, statusLabel).Inc()
+	m.httpDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveKeyGeneration(algorithm domain.Algorithm, duration time.Duration) {
+	m.keygenDuration.WithLabelValues(string(algorithm)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveSigning(algorithm domain.Algorithm, duration time.Duration) {
+	m.signingDuration.WithLabelValues(string(algorithm)).Observe(duration.Seconds())
+	m.signaturesCreated.WithLabelValues(string(algorithm)).Inc()
+}
+
+func (m *Metrics) ObserveLockWait(duration time.Duration) {
+	m.lockWait.Observe(duration.Seconds())
+}
@@ -3,85 +3,353 @@ package app
 import (
 	"context"
 	"encoding/base64"
-	"fmt"
+	"errors"
+	"strconv"
+	"time"
 
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
 	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/ashermp9/fiskaly-test-task/internal/app")
+
 type APIStorage interface {
-	AddDevice(ctx context.Context, device domain.SignatureDevice)
+	AddDevice(ctx context.Context, device domain.SignatureDevice) error
+	UpdateDevice(ctx context.Context, device domain.SignatureDevice, expectedVersion int) error
 	GetDevice(ctx context.Context, id string) (domain.SignatureDevice, error)
+	ListDevices(ctx context.Context) ([]domain.SignatureDevice, error)
+	CommitSignature(ctx context.Context, transaction domain.Transaction) error
+	ListTransactions(ctx context.Context, deviceID string) ([]domain.Transaction, error)
+	// EachTransaction calls fn for the transactions of a device with counters below upTo in
+	// counter order, without loading them all at once. It stops at the first error of fn.
+	EachTransaction(ctx context.Context, deviceID string, upTo int, fn func(domain.Transaction) error) error
+	GetTransaction(ctx context.Context, deviceID string, counter int) (domain.Transaction, error)
 	GenerateKeys(ctx context.Context, algorithm domain.Algorithm) ([]byte, []byte, error)
 	SignTransaction(ctx context.Context, deviceID string, data []byte) ([]byte, error)
 	LockDevice(ctx context.Context, deviceID string)
 	UnlockDevice(ctx context.Context, deviceID string)
+	CountDevices(ctx context.Context) int
+	Ping(ctx context.Context) error
+}
+
+// Observer receives measurements of the service, e.g. to export them as metrics.
+type Observer interface {
+	ObserveKeyGeneration(algorithm domain.Algorithm, duration time.Duration)
+	ObserveSigning(algorithm domain.Algorithm, duration time.Duration)
+	ObserveLockWait(duration time.Duration)
 }
 
 type APIService struct {
-	storage APIStorage
+	storage   APIStorage
+	watchers  *signatureWatchers
+	observer  Observer
+	audit     AuditLog
+	exportKey *exportKey
+	leases    *leases
+}
+
+// Option configures optional features of an APIService.
+type Option func(*APIService)
+
+// WithObserver reports latencies of key generation, signing and device locks to the observer.
+func WithObserver(observer Observer) Option {
+	return func(app *APIService) {
+		app.observer = observer
+	}
 }
 
-func NewAPIService(storage APIStorage) *APIService {
-	return &APIService{storage: storage}
+func NewAPIService(storage APIStorage, options ...Option) *APIService {
+	app := &APIService{
+		storage:  storage,
+		watchers: newSignatureWatchers(),
+		observer: nopObserver{},
+	}
+	for _, option := range options {
+		option(app)
+	}
+	return app
 }
 
 func (app *APIService) CreateDevice(
 	ctx context.Context, request domain.CreateDeviceRequest,
 ) (domain.SignatureDevice, error) {
+	ctx, span := tracer.Start(ctx, "APIService.CreateDevice", trace.WithAttributes(
+		attribute.String("signer.tenant_id", domain.TenantFromContext(ctx)),
+		attribute.String("signer.device_id", request.ID),
+		attribute.String("signer.algorithm", string(request.Algorithm)),
+	))
+	defer span.End()
+
+	// Hold the device lock so concurrent requests cannot both create the same ID
+	ctx, unlock, err := app.lockDevice(ctx, request.ID)
+	if err != nil {
+		return domain.SignatureDevice{}, recordError(span, err)
+	}
+	defer unlock()
+
+	_, err = app.storage.GetDevice(ctx, request.ID)
+	if err == nil {
+		return domain.SignatureDevice{}, recordError(span, domain.ErrDeviceExists)
+	}
+	if !errors.Is(err, domain.ErrDeviceNotFound) {
+		return domain.SignatureDevice{}, recordError(span, err)
+	}
+
+	start := time.Now()
 	publicKey, privateKey, err := app.storage.GenerateKeys(ctx, request.Algorithm)
 	if err != nil {
-		return domain.SignatureDevice{}, err
+		return domain.SignatureDevice{}, recordError(span, err)
 	}
+	app.observer.ObserveKeyGeneration(request.Algorithm, time.Since(start))
 
 	device := domain.SignatureDevice{
 		ID:               request.ID,
+		TenantID:         domain.TenantFromContext(ctx),
 		Algorithm:        request.Algorithm,
 		PublicKey:        publicKey,
 		PrivateKey:       privateKey,
 		Label:            request.Label,
 		SignatureCounter: 0,
 		LastSignature:    "",
+		Metadata:         copyMetadata(request.Metadata),
+		Version:          1,
+	}
+
+	if err := app.storage.AddDevice(ctx, device); err != nil {
+		return domain.SignatureDevice{}, recordError(span, err)
+	}
+	recordAudit(ctx, app.audit, audit.ActionDeviceCreate, device.ID, map[string]string{
+		"algorithm": string(device.Algorithm),
+		"label":     device.Label,
+	})
+	logging.FromContext(ctx).Infow("Created device",
+		"tenant_id", device.TenantID, "device_id", device.ID, "algorithm", device.Algorithm)
+	return device, nil
+}
+
+// GetDevice retrieves a single device.
+func (app *APIService) GetDevice(ctx context.Context, id string) (domain.SignatureDevice, error) {
+	return app.storage.GetDevice(ctx, id)
+}
+
+// ListDevices returns all devices ordered by ID.
+func (app *APIService) ListDevices(ctx context.Context) ([]domain.SignatureDevice, error) {
+	return app.storage.ListDevices(ctx)
+}
+
+// UpdateDevice changes the label, metadata and status of a device. The update is rejected with
+// domain.ErrVersionMismatch if the device changed since the client read ExpectedVersion.
+func (app *APIService) UpdateDevice(
+	ctx context.Context, request domain.UpdateDeviceRequest,
+) (domain.SignatureDevice, error) {
+	ctx, span := tracer.Start(ctx, "APIService.UpdateDevice", trace.WithAttributes(
+		attribute.String("signer.tenant_id", domain.TenantFromContext(ctx)),
+		attribute.String("signer.device_id", request.ID),
+	))
+	defer span.End()
+
+	// Hold the same lock as SignTransaction so the counter is never overwritten
+	ctx, unlock, err := app.lockDevice(ctx, request.ID)
+	if err != nil {
+		return domain.SignatureDevice{}, recordError(span, err)
+	}
+	defer unlock()
+
+	device, err := app.storage.GetDevice(ctx, request.ID)
+	if err != nil {
+		return domain.SignatureDevice{}, recordError(span, err)
+	}
+
+	if device.Version != request.ExpectedVersion {
+		return domain.SignatureDevice{}, recordError(span, domain.ErrVersionMismatch)
+	}
+
+	if request.Label != nil {
+		device.Label = *request.Label
+	}
+	if request.Disabled != nil {
+		device.Disabled = *request.Disabled
 	}
 
-	app.storage.AddDevice(ctx, device)
+	// Copy before modifying, the stored device shares the map
+	metadata := copyMetadata(device.Metadata)
+	for key, value := range request.Metadata {
+		if value == nil {
+			delete(metadata, key)
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[key] = *value
+	}
+	device.Metadata = metadata
+	device.Version++
+
+	if err := app.storage.UpdateDevice(ctx, device, request.ExpectedVersion); err != nil {
+		return domain.SignatureDevice{}, recordError(span, err)
+	}
+	recordAudit(ctx, app.audit, audit.ActionDeviceUpdate, device.ID, map[string]string{
+		"label":    device.Label,
+		"version":  strconv.Itoa(device.Version),
+		"disabled": strconv.FormatBool(device.Disabled),
+	})
+	logging.FromContext(ctx).Infow("Updated device",
+		"tenant_id", device.TenantID, "device_id", device.ID, "version", device.Version)
 	return device, nil
 }
 
+// signAttempts bounds how often SignTransaction signs again after the counter of the device
+// was advanced concurrently, e.g. by another instance sharing the storage.
+const signAttempts = 5
+
 func (app *APIService) SignTransaction(
 	ctx context.Context, request domain.SignTransactionRequest,
 ) (domain.SignatureResponse, error) {
+	ctx, span := tracer.Start(ctx, "APIService.SignTransaction", trace.WithAttributes(
+		attribute.String("signer.tenant_id", domain.TenantFromContext(ctx)),
+		attribute.String("signer.device_id", request.DeviceID),
+	))
+	defer span.End()
+
+	// The device lock avoids conflicts between requests to this instance. The storage rejects
+	// signatures chained to a counter that another instance advanced meanwhile.
+	ctx, unlock, err := app.lockDevice(ctx, request.DeviceID)
+	if err != nil {
+		return domain.SignatureResponse{}, recordError(span, err)
+	}
+	defer unlock()
 
-	app.storage.LockDevice(ctx, request.DeviceID)
-	defer app.storage.UnlockDevice(ctx, request.DeviceID)
+	for attempt := 1; ; attempt++ {
+		response, err := app.sign(ctx, span, request)
+		if errors.Is(err, domain.ErrCounterConflict) && attempt < signAttempts {
+			logging.FromContext(ctx).Debugw("Signature counter changed concurrently, signing again",
+				"device_id", request.DeviceID, "attempt", attempt)
+			continue
+		}
+		if err != nil {
+			return domain.SignatureResponse{}, recordError(span, err)
+		}
+		return response, nil
+	}
+}
 
+// sign signs the request with the current state of the device and commits the signature if
+// the device's counter is unchanged, otherwise it fails with domain.ErrCounterConflict.
+func (app *APIService) sign(
+	ctx context.Context, span trace.Span, request domain.SignTransactionRequest,
+) (domain.SignatureResponse, error) {
 	device, err := app.storage.GetDevice(ctx, request.DeviceID)
 	if err != nil {
 		return domain.SignatureResponse{}, err
 	}
-
-	// Formulate the data to be signed
-	var lastSignature string
-	if device.SignatureCounter == 0 {
-		// Use base64-encoded device ID for the first transaction
-		lastSignature = base64.StdEncoding.EncodeToString([]byte(device.ID))
-	} else {
-		lastSignature = base64.StdEncoding.EncodeToString([]byte(device.LastSignature))
+	if device.Disabled {
+		return domain.SignatureResponse{}, domain.ErrDeviceDisabled
 	}
-	dataToBeSigned := fmt.Sprintf("%d_%s_%s", device.SignatureCounter, request.Data, lastSignature)
+	span.SetAttributes(
+		attribute.String("signer.algorithm", string(device.Algorithm)),
+		attribute.Int("signer.counter", device.SignatureCounter),
+	)
+
+	// Formulate the data to be signed, the first transaction is chained to the base64-encoded device ID
+	dataToBeSigned := crypto.NewSecuredData(
+		device.ID, device.SignatureCounter, request.Data, []byte(device.LastSignature),
+	).String()
 
 	// Sign the data
+	start := time.Now()
 	signature, err := app.storage.SignTransaction(ctx, request.DeviceID, []byte(dataToBeSigned))
 	if err != nil {
 		return domain.SignatureResponse{}, err
 	}
+	app.observer.ObserveSigning(device.Algorithm, time.Since(start))
 
-	// Update the device's signature counter and last signature
-	device.SignatureCounter++
-	device.LastSignature = string(signature)
-	app.storage.AddDevice(ctx, device)
+	transaction := domain.Transaction{
+		TenantID:   device.TenantID,
+		DeviceID:   device.ID,
+		Counter:    device.SignatureCounter,
+		Data:       request.Data,
+		SignedData: dataToBeSigned,
+		Signature:  signature,
+		CreatedAt:  time.Now().UTC(),
+	}
+	// Store the transaction and advance the device's counter and last signature at once
+	persistCtx, persistSpan := tracer.Start(ctx, "APIService.persist")
+	err = app.storage.CommitSignature(persistCtx, transaction)
+	persistSpan.End()
+	if err != nil {
+		return domain.SignatureResponse{}, err
+	}
+	app.watchers.publish(transaction)
+	logging.FromContext(ctx).Infow("Signed transaction",
+		"tenant_id", device.TenantID, "device_id", device.ID, "counter", transaction.Counter)
 
 	return domain.SignatureResponse{
 		Signature:  base64.StdEncoding.EncodeToString(signature),
 		SignedData: dataToBeSigned,
+		Counter:    transaction.Counter,
 	}, nil
 }
+
+// Ping checks that the storage is reachable.
+func (app *APIService) Ping(ctx context.Context) error {
+	return app.storage.Ping(ctx)
+}
+
+// CountDevices returns the number of devices across all tenants.
+func (app *APIService) CountDevices(ctx context.Context) int {
+	return app.storage.CountDevices(ctx)
+}
+
+// WatchSignatures subscribes to signatures the caller's tenant creates from now on, optionally
+// limited to one device. The channel is closed when the returned cancel function is called
+// or when the subscriber falls too far behind.
+func (app *APIService) WatchSignatures(ctx context.Context, deviceID string) (<-chan domain.Transaction, func()) {
+	return app.watchers.subscribe(domain.TenantFromContext(ctx), deviceID)
+}
+
+// ListTransactions returns the signature history of a device ordered by counter.
+func (app *APIService) ListTransactions(ctx context.Context, deviceID string) ([]domain.Transaction, error) {
+	if _, err := app.storage.GetDevice(ctx, deviceID); err != nil {
+		return nil, err
+	}
+	return app.storage.ListTransactions(ctx, deviceID)
+}
+
+// GetTransaction retrieves the signature a device created with the given counter.
+func (app *APIService) GetTransaction(ctx context.Context, deviceID string, counter int) (domain.Transaction, error) {
+	if _, err := app.storage.GetDevice(ctx, deviceID); err != nil {
+		return domain.Transaction{}, err
+	}
+	return app.storage.GetTransaction(ctx, deviceID, counter)
+}
+
+// recordError marks the span as failed and returns the error.
+func recordError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveKeyGeneration(domain.Algorithm, time.Duration) {}
+func (nopObserver) ObserveSigning(domain.Algorithm, time.Duration)       {}
+func (nopObserver) ObserveLockWait(time.Duration)                        {}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+)
+
+// AuditLog stores audit events in one hash chain per tenant.
+type AuditLog interface {
+	Append(ctx context.Context, event audit.Event) (audit.Event, error)
+	List(ctx context.Context, tenantID string) []audit.Event
+}
+
+// WithAuditLog records device creation and updates in the audit log.
+func WithAuditLog(log AuditLog) Option {
+	return func(app *APIService) {
+		app.audit = log
+	}
+}
+
+// ListAuditEvents returns the audit chain of the caller's tenant. With a device ID only the
+// events of the device are returned, which no longer form a verifiable chain.
+func (app *APIService) ListAuditEvents(ctx context.Context, deviceID string) []audit.Event {
+	if app.audit == nil {
+		return []audit.Event{}
+	}
+	events := app.audit.List(ctx, domain.TenantFromContext(ctx))
+	if deviceID == "" {
+		return events
+	}
+	filtered := make([]audit.Event, 0)
+	for _, event := range events {
+		if event.DeviceID == deviceID {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// recordAudit appends an action of the caller to the audit log. The action already took
+// effect, so a failing log is reported but does not fail the request: the log may miss
+// changes, while actions only disclosing data use requireAudit.
+func recordAudit(ctx context.Context, log AuditLog, action, deviceID string, details map[string]string) {
+	if err := requireAudit(ctx, log, action, deviceID, details); err != nil {
+		logging.FromContext(ctx).Errorw("Failed to record audit event", "action", action, "error", err)
+	}
+}
+
+// requireAudit appends an action of the caller to the audit log before it takes effect, the
+// action must not proceed if it fails.
+func requireAudit(ctx context.Context, log AuditLog, action, deviceID string, details map[string]string) error {
+	if log == nil {
+		return nil
+	}
+	_, err := log.Append(ctx, audit.Event{
+		Time:     time.Now(),
+		Actor:    domain.ActorFromContext(ctx),
+		TenantID: domain.TenantFromContext(ctx),
+		Action:   action,
+		DeviceID: deviceID,
+		Details:  details,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the audit event: %w", err)
+	}
+	return nil
+}
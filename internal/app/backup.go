@@ -0,0 +1,205 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+// BackupKeySize is the size of the AES-256 key backups are encrypted with.
+const BackupKeySize = 32
+
+// backupHeader starts every backup. It names the format and is authenticated with the content.
+var backupHeader = []byte("signer-backup v1\n")
+
+type BackupStorage interface {
+	Snapshot(ctx context.Context) (domain.Snapshot, error)
+	Restore(ctx context.Context, snapshot domain.Snapshot) (domain.RestoreSummary, error)
+}
+
+// BackupService creates encrypted backups of all tenants and restores them. Only admins of
+// domain.DefaultTenantID may use it, other tenants must not see each other's devices.
+type BackupService struct {
+	storage BackupStorage
+	aead    cipher.AEAD
+	audit   AuditLog
+}
+
+// BackupOption configures optional features of a BackupService.
+type BackupOption func(*BackupService)
+
+// WithBackupAuditLog records created and restored backups in the audit log.
+func WithBackupAuditLog(log AuditLog) BackupOption {
+	return func(b *BackupService) {
+		b.audit = log
+	}
+}
+
+// NewBackupService creates a BackupService encrypting backups with AES-256-GCM under key.
+func NewBackupService(storage BackupStorage, key []byte, options ...BackupOption) (*BackupService, error) {
+	if len(key) != BackupKeySize {
+		return nil, fmt.Errorf("backup key must be %d bytes, got %d", BackupKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	b := &BackupService{storage: storage, aead: aead}
+	for _, option := range options {
+		option(b)
+	}
+	return b, nil
+}
+
+// backup is the encrypted content of a backup.
+type backup struct {
+	CreatedAt time.Time `json:"createdAt"`
+	domain.Snapshot
+}
+
+// Backup writes an encrypted point-in-time copy of all tenants to w. Nothing is written if
+// it fails.
+func (b *BackupService) Backup(ctx context.Context, w io.Writer) error {
+	if domain.TenantFromContext(ctx) != domain.DefaultTenantID {
+		return domain.ErrForbidden
+	}
+
+	snapshot, err := b.storage.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	content := backup{CreatedAt: time.Now().UTC(), Snapshot: snapshot}
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := append(append([]byte{}, backupHeader...), nonce...)
+	sealed = b.aead.Seal(sealed, nonce, plaintext, backupHeader)
+
+	// The backup is logged before anything is disclosed
+	err = requireAudit(ctx, b.audit, audit.ActionBackupCreate, "", map[string]string{
+		"devices":      strconv.Itoa(len(content.Devices)),
+		"transactions": strconv.Itoa(len(content.Transactions)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(sealed); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Infow("Created backup",
+		"devices", len(content.Devices), "transactions", len(content.Transactions))
+	return nil
+}
+
+// Restore decrypts a backup written by Backup, verifies the signature chain of every device
+// and adds its content to the storage. Backups that fail to decrypt or verify are rejected
+// with domain.ErrInvalidBackup, backups older than a device or forked from its history with
+// domain.ErrCounterRollback.
+func (b *BackupService) Restore(ctx context.Context, r io.Reader) (domain.RestoreSummary, error) {
+	if domain.TenantFromContext(ctx) != domain.DefaultTenantID {
+		return domain.RestoreSummary{}, domain.ErrForbidden
+	}
+
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return domain.RestoreSummary{}, err
+	}
+	if !bytes.HasPrefix(sealed, backupHeader) || len(sealed) < len(backupHeader)+b.aead.NonceSize() {
+		return domain.RestoreSummary{}, fmt.Errorf("%w: not a backup of this service", domain.ErrInvalidBackup)
+	}
+	sealed = sealed[len(backupHeader):]
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, backupHeader)
+	if err != nil {
+		return domain.RestoreSummary{}, fmt.Errorf("%w: encrypted with another key or corrupted", domain.ErrInvalidBackup)
+	}
+
+	var content backup
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return domain.RestoreSummary{}, fmt.Errorf("%w: %v", domain.ErrInvalidBackup, err)
+	}
+	if err := verifySnapshot(content.Snapshot); err != nil {
+		return domain.RestoreSummary{}, fmt.Errorf("%w: %v", domain.ErrInvalidBackup, err)
+	}
+
+	summary, err := b.storage.Restore(ctx, content.Snapshot)
+	if err != nil {
+		return domain.RestoreSummary{}, err
+	}
+	recordAudit(ctx, b.audit, audit.ActionBackupRestore, "", map[string]string{
+		"created_at":   content.CreatedAt.Format(time.RFC3339),
+		"devices":      strconv.Itoa(summary.Devices),
+		"transactions": strconv.Itoa(summary.Transactions),
+		"api_keys":     strconv.Itoa(summary.APIKeys),
+	})
+	logging.FromContext(ctx).Infow("Restored backup", "created_at", content.CreatedAt,
+		"devices", summary.Devices, "skipped_devices", summary.SkippedDevices, "transactions", summary.Transactions)
+	return summary, nil
+}
+
+// verifySnapshot checks that the history of every device is complete and that its
+// signatures and chain links verify against the device's public key, so a restored device
+// continues a valid chain. The last signature of every device is taken from its chain, the
+// raw signature bytes do not survive the JSON encoding of the device.
+func verifySnapshot(snapshot domain.Snapshot) error {
+	type deviceKey struct{ tenantID, deviceID string }
+	verifiers := make(map[deviceKey]*crypto.ChainVerifier, len(snapshot.Devices))
+	counters := make(map[deviceKey]int, len(snapshot.Devices))
+	lastSignatures := make(map[deviceKey][]byte, len(snapshot.Devices))
+	for _, device := range snapshot.Devices {
+		key := deviceKey{device.TenantID, device.ID}
+		if _, duplicate := verifiers[key]; duplicate {
+			return fmt.Errorf("device %q of tenant %q is contained twice", device.ID, device.TenantID)
+		}
+		verifier, err := crypto.NewChainVerifier(device.ID, device.PublicKey)
+		if err != nil {
+			return fmt.Errorf("device %q of tenant %q: %v", device.ID, device.TenantID, err)
+		}
+		verifiers[key] = verifier
+	}
+
+	for _, transaction := range snapshot.Transactions {
+		key := deviceKey{transaction.TenantID, transaction.DeviceID}
+		verifier, found := verifiers[key]
+		if !found {
+			return fmt.Errorf("transaction of unknown device %q of tenant %q", transaction.DeviceID, transaction.TenantID)
+		}
+		if err := verifier.Verify(transaction.Counter, transaction.SignedData, transaction.Signature); err != nil {
+			return fmt.Errorf("device %q of tenant %q: %v", transaction.DeviceID, transaction.TenantID, err)
+		}
+		counters[key]++
+		lastSignatures[key] = transaction.Signature
+	}
+
+	for i, device := range snapshot.Devices {
+		key := deviceKey{device.TenantID, device.ID}
+		if signed := counters[key]; signed != device.SignatureCounter {
+			return fmt.Errorf("device %q of tenant %q has signed %d times, the backup contains %d signatures",
+				device.ID, device.TenantID, device.SignatureCounter, signed)
+		}
+		snapshot.Devices[i].LastSignature = string(lastSignatures[key])
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+	"github.com/ashermp9/fiskaly-test-task/pkg/bundle"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNoExportKey is returned by ExportDevice if the service has no key to sign exports with.
+var ErrNoExportKey = errors.New("no export key configured")
+
+// exportKey signs the manifests of device exports.
+type exportKey struct {
+	signer    crypto.Signer
+	publicKey []byte // PEM encoded, included in every export
+}
+
+// WithExportKey signs device exports with signer. publicKey is its PEM encoded public key.
+func WithExportKey(signer crypto.Signer, publicKey []byte) Option {
+	return func(app *APIService) {
+		app.exportKey = &exportKey{signer: signer, publicKey: publicKey}
+	}
+}
+
+// ExportDevice writes the device and its complete signature history to w as a bundle, see
+// pkg/bundle. The history is streamed from the storage instead of being loaded. Errors returned before anything was written are domain errors, like
+// domain.ErrDeviceNotFound, any later error leaves a truncated archive behind.
+func (app *APIService) ExportDevice(ctx context.Context, deviceID string, w io.Writer) error {
+	ctx, span := tracer.Start(ctx, "APIService.ExportDevice", trace.WithAttributes(
+		attribute.String("signer.tenant_id", domain.TenantFromContext(ctx)),
+		attribute.String("signer.device_id", deviceID),
+	))
+	defer span.End()
+
+	if app.exportKey == nil {
+		return recordError(span, ErrNoExportKey)
+	}
+	fingerprint, err := bundle.Fingerprint(app.exportKey.publicKey)
+	if err != nil {
+		return recordError(span, fmt.Errorf("export key: %w", err))
+	}
+	device, err := app.storage.GetDevice(ctx, deviceID)
+	if err != nil {
+		return recordError(span, err)
+	}
+	span.SetAttributes(attribute.Int("signer.transactions", device.SignatureCounter))
+
+	// The export is logged before anything is disclosed
+	err = requireAudit(ctx, app.audit, audit.ActionDeviceExport, device.ID, map[string]string{
+		"transactions": strconv.Itoa(device.SignatureCounter),
+	})
+	if err != nil {
+		return recordError(span, err)
+	}
+
+	exportedAt := time.Now().UTC()
+	// The history is read from the storage for every file written. Signatures created while
+	// exporting are left out, so every pass yields the same transactions as the manifest counts
+	var exported int
+	each := func(yield func(bundle.Transaction) error) error {
+		exported = 0
+		return app.storage.EachTransaction(ctx, deviceID, device.SignatureCounter, func(transaction domain.Transaction) error {
+			exported++
+			return yield(bundle.Transaction{
+				DeviceID:   transaction.DeviceID,
+				Counter:    transaction.Counter,
+				Data:       transaction.Data,
+				SignedData: transaction.SignedData,
+				Signature:  base64.StdEncoding.EncodeToString(transaction.Signature),
+				CreatedAt:  transaction.CreatedAt,
+			})
+		})
+	}
+	writer := bundle.NewWriter(w, exportedAt)
+	steps := []func() error{
+		func() error {
+			return writer.WriteJSON(bundle.DeviceFile, bundle.Device{
+				ID:               device.ID,
+				TenantID:         device.TenantID,
+				Algorithm:        string(device.Algorithm),
+				Label:            device.Label,
+				PublicKey:        string(device.PublicKey),
+				SignatureCounter: device.SignatureCounter,
+				Metadata:         device.Metadata,
+				Version:          device.Version,
+				Disabled:         device.Disabled,
+			})
+		},
+		func() error { return writePEM(writer, bundle.PublicKeyFile, device.PublicKey) },
+		func() error { return writePEM(writer, bundle.ServiceKeyFile, app.exportKey.publicKey) },
+		func() error { return writer.WriteTransactions(each) },
+		func() error { return writer.WriteCSV(each) },
+		func() error {
+			return writer.WriteManifest(bundle.Manifest{
+				DeviceID:     device.ID,
+				TenantID:     device.TenantID,
+				ExportedAt:   exportedAt,
+				Transactions: exported,
+				ServiceKey:   fingerprint,
+			}, app.exportKey.signer)
+		},
+		writer.Close,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return recordError(span, err)
+		}
+	}
+
+	logging.FromContext(ctx).Infow("Exported device",
+		"tenant_id", device.TenantID, "device_id", device.ID, "transactions", exported)
+	return nil
+}
+
+func writePEM(writer *bundle.Writer, name string, content []byte) error {
+	return writer.WriteFile(name, func(out io.Writer) error {
+		_, err := out.Write(content)
+		return err
+	})
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+)
+
+const apiKeyPrefix = "sk_"
+
+type APIKeyStorage interface {
+	AddAPIKey(ctx context.Context, key domain.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (domain.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]domain.APIKey, error)
+	DeleteAPIKey(ctx context.Context, id string) error
+}
+
+// KeyService authenticates API keys and manages them. Only hashes of keys are stored.
+type KeyService struct {
+	storage APIKeyStorage
+	audit   AuditLog
+}
+
+// KeyOption configures optional features of a KeyService.
+type KeyOption func(*KeyService)
+
+// WithKeyAuditLog records created and revoked API keys in the audit log.
+func WithKeyAuditLog(log AuditLog) KeyOption {
+	return func(k *KeyService) {
+		k.audit = log
+	}
+}
+
+// NewKeyService creates a KeyService and registers the keys from the configuration.
+// Keys without a tenant belong to domain.DefaultTenantID. Revoking a configured key only
+// lasts until the next restart.
+func NewKeyService(storage APIKeyStorage, configured []domain.APIKey, options ...KeyOption) *KeyService {
+	for _, key := range configured {
+		if key.TenantID == "" {
+			key.TenantID = domain.DefaultTenantID
+		}
+		// Configured keys are kept in memory only, adding them cannot fail
+		key.Configured = true
+		_ = storage.AddAPIKey(context.Background(), key)
+	}
+	k := &KeyService{storage: storage}
+	for _, option := range options {
+		option(k)
+	}
+	return k
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of an API key as stored and configured.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Authenticate resolves an API key to the principal it belongs to.
+func (k *KeyService) Authenticate(ctx context.Context, key string) (domain.Principal, error) {
+	if key == "" {
+		return domain.Principal{}, domain.ErrUnauthenticated
+	}
+	apiKey, err := k.storage.GetAPIKeyByHash(ctx, HashAPIKey(key))
+	if err != nil {
+		return domain.Principal{}, domain.ErrUnauthenticated
+	}
+	return domain.Principal{KeyID: apiKey.ID, Name: apiKey.Name, TenantID: apiKey.TenantID, Scopes: apiKey.Scopes}, nil
+}
+
+// CreateAPIKey generates a new API key for the tenant of the caller. The returned secret is
+// not stored and cannot be retrieved later.
+func (k *KeyService) CreateAPIKey(ctx context.Context, name string, scopes []domain.Scope) (domain.APIKey, string, error) {
+	for _, scope := range scopes {
+		if !scope.Valid() {
+			return domain.APIKey{}, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return domain.APIKey{}, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return domain.APIKey{}, "", err
+	}
+	secret = apiKeyPrefix + secret
+
+	apiKey := domain.APIKey{
+		ID:        id,
+		Name:      name,
+		TenantID:  domain.TenantFromContext(ctx),
+		Hash:      HashAPIKey(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := k.storage.AddAPIKey(ctx, apiKey); err != nil {
+		return domain.APIKey{}, "", err
+	}
+	recordAudit(ctx, k.audit, audit.ActionAPIKeyCreate, "", map[string]string{
+		"apiKeyId": apiKey.ID,
+		"name":     apiKey.Name,
+		"scopes":   joinScopes(apiKey.Scopes),
+	})
+	return apiKey, secret, nil
+}
+
+// ListAPIKeys returns the API keys of the caller's tenant ordered by ID.
+func (k *KeyService) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	return k.storage.ListAPIKeys(ctx)
+}
+
+// RevokeAPIKey deletes an API key of the caller's tenant, requests using it are rejected from now on.
+func (k *KeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := k.storage.DeleteAPIKey(ctx, id); err != nil {
+		return err
+	}
+	recordAudit(ctx, k.audit, audit.ActionAPIKeyRevoke, "", map[string]string{"apiKeyId": id})
+	return nil
+}
+
+func joinScopes(scopes []domain.Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, " ")
+}
+
+func randomHex(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// Leaser grants exclusive, expiring leases across all instances sharing a storage. Acquire
+// waits until the key is free or ctx is done. Releasing a lease that expired and was granted
+// to someone else leaves the new lease alone.
+type Leaser interface {
+	Acquire(ctx context.Context, key string, ttl time.Duration) (domain.Lease, error)
+	Release(ctx context.Context, lease domain.Lease) error
+}
+
+type leases struct {
+	leaser Leaser
+	ttl    time.Duration
+}
+
+// WithLeases makes device changes exclusive across instances with leases on the devices. A
+// request that outlives ttl has its writes rejected with domain.ErrLeaseExpired by the storage
+// once another instance took over the device.
+func WithLeases(leaser Leaser, ttl time.Duration) Option {
+	return func(app *APIService) {
+		app.leases = &leases{leaser: leaser, ttl: ttl}
+	}
+}
+
+// lockDevice makes the device exclusive to the caller until unlock is called: within this
+// instance with the device lock of the storage, across instances with a lease if configured.
+// The returned context carries the lease's fencing token for the storage.
+func (app *APIService) lockDevice(ctx context.Context, deviceID string) (context.Context, func(), error) {
+	start := time.Now()
+	app.storage.LockDevice(ctx, deviceID)
+	if app.leases == nil {
+		app.observer.ObserveLockWait(time.Since(start))
+		return ctx, func() { app.storage.UnlockDevice(ctx, deviceID) }, nil
+	}
+
+	lease, err := app.leases.leaser.Acquire(ctx, leaseKey(ctx, deviceID), app.leases.ttl)
+	app.observer.ObserveLockWait(time.Since(start))
+	if err != nil {
+		app.storage.UnlockDevice(ctx, deviceID)
+		return ctx, nil, err
+	}
+	unlock := func() {
+		// Release even if the request was cancelled, otherwise the device waits for the TTL
+		if err := app.leases.leaser.Release(context.WithoutCancel(ctx), lease); err != nil {
+			logging.FromContext(ctx).Warnw("Releasing the device lease failed, it expires with its TTL",
+				"device_id", deviceID, "error", err)
+		}
+		app.storage.UnlockDevice(ctx, deviceID)
+	}
+	return domain.ContextWithFencingToken(ctx, lease.Token), unlock, nil
+}
+
+// leaseKey names the lease of a device of the request's tenant.
+func leaseKey(ctx context.Context, deviceID string) string {
+	return "device/" + domain.TenantFromContext(ctx) + "/" + deviceID
+}
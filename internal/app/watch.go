@@ -0,0 +1,72 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// watcherBufferSize is the number of signatures a watcher may lag behind before it is dropped.
+const watcherBufferSize = 64
+
+// signatureWatchers fans out created signatures to subscribers. A subscriber that does
+// not keep up is dropped by closing its channel, so signing is never blocked by a watcher.
+type signatureWatchers struct {
+	mu       sync.Mutex
+	nextID   int
+	watchers map[int]*signatureWatcher
+}
+
+type signatureWatcher struct {
+	tenantID     string
+	deviceID     string
+	transactions chan domain.Transaction
+}
+
+func newSignatureWatchers() *signatureWatchers {
+	return &signatureWatchers{watchers: make(map[int]*signatureWatcher)}
+}
+
+func (w *signatureWatchers) subscribe(tenantID, deviceID string) (<-chan domain.Transaction, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	watcher := &signatureWatcher{
+		tenantID:     tenantID,
+		deviceID:     deviceID,
+		transactions: make(chan domain.Transaction, watcherBufferSize),
+	}
+	w.watchers[id] = watcher
+
+	unsubscribe := func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if _, ok := w.watchers[id]; ok {
+			delete(w.watchers, id)
+			close(watcher.transactions)
+		}
+	}
+	return watcher.transactions, unsubscribe
+}
+
+func (w *signatureWatchers) publish(transaction domain.Transaction) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, watcher := range w.watchers {
+		if watcher.tenantID != transaction.TenantID {
+			continue
+		}
+		if watcher.deviceID != "" && watcher.deviceID != transaction.DeviceID {
+			continue
+		}
+		select {
+		case watcher.transactions <- transaction:
+		default:
+			delete(w.watchers, id)
+			close(watcher.transactions)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTenantID is the tenant of API keys configured without one and of all requests
+// while authentication is disabled.
+const DefaultTenantID = "default"
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+const (
+	ScopeDevicesRead  Scope = "devices:read"
+	ScopeDevicesWrite Scope = "devices:write"
+	ScopeSign         Scope = "sign"
+	ScopeAdmin        Scope = "admin" // Grants every other scope
+)
+
+// Scopes lists all known scopes.
+var Scopes = []Scope{ScopeDevicesRead, ScopeDevicesWrite, ScopeSign, ScopeAdmin}
+
+// Valid reports whether the scope is known.
+func (s Scope) Valid() bool {
+	for _, scope := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKey struct {
+	ID        string    // Public identifier used to manage the key
+	Name      string    // Human readable name, e.g. the owning service
+	TenantID  string    // Organisation whose devices the key may access
+	Hash      string    // Hex encoded SHA-256 of the secret key, the key itself is never stored
+	Scopes    []Scope   // Permissions granted to the key
+	CreatedAt time.Time // Time of creation
+	// Configured keys are provisioned from the configuration on every start, storages keep
+	// them in memory only so removing a key from the configuration revokes it
+	Configured bool
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	KeyID    string
+	Name     string
+	TenantID string
+	Scopes   []Scope
+}
+
+// HasScope reports whether the principal was granted the scope, either directly or through admin.
+func (p Principal) HasScope(scope Scope) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal attaches the authenticated principal to a context.
+func ContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal attached to a context.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// TenantFromContext returns the tenant of the principal attached to a context, or
+// DefaultTenantID for unauthenticated contexts.
+func TenantFromContext(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok && principal.TenantID != "" {
+		return principal.TenantID
+	}
+	return DefaultTenantID
+}
+
+// ActorFromContext identifies the caller for the audit log: the API key ID, the client
+// certificate, or "anonymous" while authentication is disabled.
+func ActorFromContext(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok && principal.KeyID != "" {
+		return principal.KeyID
+	}
+	return "anonymous"
+}
@@ -8,25 +8,38 @@ const (
 )
 
 type SignatureDevice struct {
-	ID               string    // Unique identifier, e.g., UUID
-	Algorithm        Algorithm // 'RSA' or 'ECC'
-	PublicKey        []byte    // Encoded public key
-	PrivateKey       []byte    // Encoded private key, should be securely stored
-	Label            string    // User-provided label for the device
-	SignatureCounter int       // Counts the number of signatures made
-	LastSignature    string    // Last signed message
+	ID               string            // Identifier, e.g., UUID, unique within the tenant
+	TenantID         string            // Organisation owning the device
+	Algorithm        Algorithm         // 'RSA' or 'ECC'
+	PublicKey        []byte            // Encoded public key
+	PrivateKey       []byte            // Encoded private key, should be securely stored
+	Label            string            // User-provided label for the device
+	SignatureCounter int               // Counts the number of signatures made
+	LastSignature    string            // Last signed message
+	Metadata         map[string]string // Free-form attributes, e.g. store ID or till number
+	Version          int               // Incremented on every label, metadata or status change
+	Disabled         bool              // Disabled devices refuse to sign, e.g. once a till is decommissioned
 }
 
 type CreateDeviceRequest struct {
 	ID        string
-	Algorithm Algorithm // 'RSA' or 'ECC'
-	Label     string    // Optional label for the device
+	Algorithm Algorithm         // 'RSA' or 'ECC'
+	Label     string            // Optional label for the device
+	Metadata  map[string]string // Optional free-form attributes
 }
 
 type CreateDeviceResponse struct {
 	Device SignatureDevice // The newly created device
 }
 
+type UpdateDeviceRequest struct {
+	ID              string             // The ID of the device to update
+	Label           *string            // New label, nil leaves the label unchanged
+	Metadata        map[string]*string // Metadata changes, a nil value removes the key
+	Disabled        *bool              // New status, nil leaves the status unchanged
+	ExpectedVersion int                // The version the changes are based on
+}
+
 type SignTransactionRequest struct {
 	DeviceID string // The ID of the signature device to use
 	Data     string // The data to be signed
@@ -35,4 +48,5 @@ type SignTransactionRequest struct {
 type SignatureResponse struct {
 	Signature  string // The base64 encoded signature
 	SignedData string // The original data with signature counter and last signature
+	Counter    int    // The signature counter used in the signed data
 }
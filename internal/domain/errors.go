@@ -0,0 +1,34 @@
+package domain
+
+import "errors"
+
+var (
+	// ErrDeviceNotFound is returned when no device exists for the requested ID.
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceExists is returned when a device is created with an ID that is already in use.
+	ErrDeviceExists = errors.New("device already exists")
+	// ErrVersionMismatch is returned when a conditional update was based on a stale device version.
+	ErrVersionMismatch = errors.New("device version mismatch")
+	// ErrCounterConflict is returned when a signature is committed for a counter that another
+	// signature of the same device already advanced.
+	ErrCounterConflict = errors.New("signature counter changed concurrently")
+	// ErrLeaseExpired is returned when a write carries the fencing token of a device lease that
+	// has expired and was granted to another instance since.
+	ErrLeaseExpired = errors.New("device lease expired")
+	// ErrDeviceDisabled is returned when a disabled device is asked to sign.
+	ErrDeviceDisabled = errors.New("device is disabled")
+	// ErrTransactionNotFound is returned when a device has no signature with the requested counter.
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrUnauthenticated is returned when an API key is missing or unknown.
+	ErrUnauthenticated = errors.New("invalid or missing API key")
+	// ErrAPIKeyNotFound is returned when no API key exists for the requested ID.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrAlgorithmNotAllowed is returned when a device is created with an algorithm the crypto policy forbids.
+	ErrAlgorithmNotAllowed = errors.New("algorithm not allowed by the crypto policy")
+	// ErrForbidden is returned when the caller's tenant may not perform an operation on the whole service.
+	ErrForbidden = errors.New("only admins of the default tenant may access the whole service")
+	// ErrInvalidBackup is returned when a backup cannot be decrypted or does not verify.
+	ErrInvalidBackup = errors.New("invalid backup")
+	// ErrCounterRollback is returned when a restore would reset the signature counter of a device.
+	ErrCounterRollback = errors.New("restore would roll back a signature counter")
+)
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Lease makes a key exclusive to its holder across instances until it is released or expires.
+type Lease struct {
+	Key       string
+	Token     uint64 // Fencing token, greater than the token of every lease granted on Key before
+	Owner     string // Random identity of the holder, only the holder can release the lease
+	ExpiresAt time.Time
+}
+
+type fencingTokenKey struct{}
+
+// ContextWithFencingToken attaches the fencing token of the lease a request holds on a device.
+// Storages reject writes to the device carrying a lower token than one they have seen, the
+// lease was granted to another instance since.
+func ContextWithFencingToken(ctx context.Context, token uint64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingTokenFromContext returns the fencing token attached to a context.
+func FencingTokenFromContext(ctx context.Context) (uint64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(uint64)
+	return token, ok
+}
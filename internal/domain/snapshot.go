@@ -0,0 +1,16 @@
+package domain
+
+// Snapshot is the state of all tenants at one point in time, as backed up and restored.
+type Snapshot struct {
+	Devices      []SignatureDevice
+	Transactions []Transaction // Ordered by device and counter
+	APIKeys      []APIKey
+}
+
+// RestoreSummary counts what a restore changed.
+type RestoreSummary struct {
+	Devices        int // Devices created or brought forward to the state of the backup
+	SkippedDevices int // Devices already at the state of the backup
+	Transactions   int // Transactions added
+	APIKeys        int // API keys added, existing keys are kept
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// Transaction is a single signature created by a device.
+type Transaction struct {
+	TenantID   string    // Organisation owning the device
+	DeviceID   string    // The ID of the device that created the signature
+	Counter    int       // The signature counter used in the signed data
+	Data       string    // The data provided by the client
+	SignedData string    // The secured data that was signed
+	Signature  []byte    // The raw signature
+	CreatedAt  time.Time // Time of signing
+}
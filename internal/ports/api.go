@@ -3,42 +3,153 @@ package ports
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/metrics"
 	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
 	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
 	"go.uber.org/zap"
 )
 
+const requestIDHeader = "X-Request-ID"
+
 type Server struct {
 	logger        *zap.SugaredLogger
 	APIService    *app.APIService
 	server        *http.Server
 	listenAddress int
+	idempotency   *idempotencyStore
+	keys          *app.KeyService
+	backups       *app.BackupService
+	tls           *TLSOptions
+	certificates  atomic.Pointer[certificateReloader] // Set by Serve, closed by Shutdown
+	rateLimiter   *rateLimiter
+	metrics       *metrics.Metrics
+	healthChecks  []HealthCheck
+	started       time.Time
+	shuttingDown  atomic.Bool
+}
+
+// ServerOption configures optional features of a Server.
+type ServerOption func(*Server)
+
+// WithAPIKeys enables API key authentication. Without it every request is allowed.
+func WithAPIKeys(keys *app.KeyService) ServerOption {
+	return func(s *Server) {
+		s.keys = keys
+	}
+}
+
+// WithBackups enables the admin routes creating and restoring backups.
+func WithBackups(backups *app.BackupService) ServerOption {
+	return func(s *Server) {
+		s.backups = backups
+	}
+}
+
+// HTTPOptions configures the listener and the timeouts of the HTTP server.
+type HTTPOptions struct {
+	Host         string // Interface to listen on, empty for all
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
 }
 
-func NewServer(logger *zap.SugaredLogger, appService *app.APIService, listenAddress int) *Server {
-	return &Server{
+// WithHTTPOptions sets the interface and the timeouts of the HTTP server. Zero timeouts are disabled.
+func WithHTTPOptions(options HTTPOptions) ServerOption {
+	return func(s *Server) {
+		s.server.Addr = net.JoinHostPort(options.Host, strconv.Itoa(s.listenAddress))
+		s.server.ReadTimeout = options.ReadTimeout
+		s.server.ReadHeaderTimeout = options.ReadTimeout
+		s.server.WriteTimeout = options.WriteTimeout
+		s.server.IdleTimeout = options.IdleTimeout
+	}
+}
+
+func NewServer(logger *zap.SugaredLogger, appService *app.APIService, listenAddress int, options ...ServerOption) *Server {
+	server := &Server{
 		APIService:    appService,
 		listenAddress: listenAddress,
 		server: &http.Server{
 			Addr: fmt.Sprintf(":%d", listenAddress),
 		},
-		logger: logger,
+		logger:      logger,
+		idempotency: newIdempotencyStore(),
+		rateLimiter: newRateLimiter(RateLimits{}),
+		started:     time.Now(),
+	}
+	for _, option := range options {
+		option(server)
+	}
+	if server.metrics != nil {
+		server.metrics.MustRegister(newRateLimitCollector(server.rateLimiter))
 	}
+	return server
 }
 
 func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on an existing listener, using TLS if configured.
+func (s *Server) Serve(listener net.Listener) error {
+	s.server.Handler = s.Handler()
+	if s.tls == nil {
+		return s.server.Serve(listener)
+	}
+
+	certificates, err := newCertificateReloader(*s.tls, s.logger)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	s.certificates.Store(certificates)
+	if s.shuttingDown.Load() {
+		// Shutdown ran before the reloader was stored
+		s.closeCertificates()
+	}
+	s.server.TLSConfig = certificates.tlsConfig()
+	return s.server.ServeTLS(listener, "", "")
+}
+
+// Handler returns the HTTP handler serving all API versions.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.Handle("/api/v0/create-device", s.LoggingMiddleware(http.HandlerFunc(s.CreateSignatureDeviceHandler)))
-	mux.Handle("/api/v0/sign-transaction", s.LoggingMiddleware(http.HandlerFunc(s.SignTransactionHandler)))
-	mux.Handle("/api/v0/health", s.LoggingMiddleware(http.HandlerFunc(s.HealthCheckHandler)))
+	// v0 is kept as a compatibility shim for existing RPC-style clients
+	mux.Handle("/api/v0/create-device", s.AuthenticationMiddleware(
+		s.requireScope(domain.ScopeDevicesWrite, s.rateLimit(nil, s.CreateSignatureDeviceHandler))))
+	mux.Handle("/api/v0/sign-transaction", s.AuthenticationMiddleware(
+		s.requireScope(domain.ScopeSign, s.rateLimit(v0DeviceBody, s.SignTransactionHandler))))
+	mux.Handle("/api/v0/devices/", s.AuthenticationMiddleware(
+		s.requireScope(domain.ScopeDevicesWrite, s.rateLimit(v0DevicePath, s.UpdateDeviceHandler))))
+	mux.HandleFunc("/api/v0/health", s.HealthCheckHandler)
+	mux.HandleFunc("/livez", s.LivenessHandler)
+	mux.HandleFunc("/readyz", s.ReadinessHandler)
+
+	document := openapi.MustLoad()
+	mux.Handle(apiV1Prefix+"/", s.AuthenticationMiddleware(
+		s.IdempotencyMiddleware(s.ValidationMiddleware(document, s.v1Router()))))
+	mux.HandleFunc("/api/openapi.json", s.OpenAPIHandler)
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics.Handler())
+	}
 
-	s.server.Handler = mux // Set the mux as the server's handler
-	return s.server.ListenAndServe()
+	return routeMiddleware(mux, s.LoggingMiddleware(s.TracingMiddleware(s.MetricsMiddleware(mux))))
 }
 
 func (s *Server) SignTransactionHandler(w http.ResponseWriter, r *http.Request) {
@@ -48,14 +159,20 @@ func (s *Server) SignTransactionHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := signRequest.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
 	domainRequest := types.ConvertToDomainSignTransactionRequest(signRequest)
 	signature, err := s.APIService.SignTransaction(ctx, domainRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), statusFromError(err))
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(signature)
 }
 
@@ -75,13 +192,67 @@ func (s *Server) CreateSignatureDeviceHandler(w http.ResponseWriter, r *http.Req
 	domainRequest := types.ConvertToDomainCreateDeviceRequest(createDeviceRequest)
 	device, err := s.APIService.CreateDevice(ctx, domainRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), statusFromError(err))
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(device.Version))
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(device)
 }
 
+// UpdateDeviceHandler handles PATCH /api/v0/devices/{id}. The expected version is taken from
+// the If-Match header or, if absent, from the version field of the body.
+func (s *Server) UpdateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", http.MethodPatch)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v0/devices/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var updateDeviceRequest types.UpdateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&updateDeviceRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := updateDeviceRequest.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, ok, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		if updateDeviceRequest.Version == nil {
+			http.Error(w, "If-Match header or version is required", http.StatusPreconditionRequired)
+			return
+		}
+		version = *updateDeviceRequest.Version
+	}
+
+	ctx := r.Context()
+	domainRequest := types.ConvertToDomainUpdateDeviceRequest(id, version, updateDeviceRequest)
+	device, err := s.APIService.UpdateDevice(ctx, domainRequest)
+	if err != nil {
+		http.Error(w, err.Error(), statusFromError(err))
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(device.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.ConvertFromDomainDevice(device))
+}
+
 func (s *Server) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -90,20 +261,88 @@ func (s *Server) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 
 	healthStatus := map[string]string{"status": "pass", "version": "v0"}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(healthStatus)
 }
 
+// Shutdown stops the server after running requests completed. Readiness fails from now on.
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	s.closeCertificates()
 	return s.server.Shutdown(ctx)
 }
 
-// LoggingMiddleware logs each request's method, URL, and duration.
+// closeCertificates stops reloading the certificate, once even if Serve and Shutdown race.
+func (s *Server) closeCertificates() {
+	if certificates := s.certificates.Swap(nil); certificates != nil {
+		certificates.Close()
+	}
+}
+
+// LoggingMiddleware correlates each request by the X-Request-ID header, generating an ID if
+// the client sent none, and writes an access log line once the request is handled. Handlers
+// and the APIService log with the request's logger from logging.FromContext.
 func (s *Server) LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		duration := time.Since(start)
-		s.logger.Infof("Handled request: %s %s, Duration: %s", r.Method, r.URL.Path, duration)
+		requestID := logging.RequestID(r.Header.Get(requestIDHeader))
+		w.Header().Set(requestIDHeader, requestID)
+		logger := s.logger.With("request_id", requestID)
+		r = r.WithContext(logging.WithLogger(r.Context(), logger))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		fields := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", routePattern(r),
+			"status", recorder.status,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		}
+		if deviceID := requestDevice(r); deviceID != "" {
+			fields = append(fields, "device_id", deviceID)
+		}
+		logger.Infow("Handled request", fields...)
 	})
 }
+
+// statusFromError maps domain errors to HTTP status codes.
+func statusFromError(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrDeviceExists), errors.Is(err, domain.ErrDeviceDisabled), errors.Is(err, domain.ErrCounterConflict),
+		errors.Is(err, domain.ErrLeaseExpired):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, domain.ErrAlgorithmNotAllowed):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func formatETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseIfMatch extracts the device version from an If-Match header. The boolean is false if the header is empty.
+func parseIfMatch(header string) (int, bool, error) {
+	if header == "" {
+		return 0, false, nil
+	}
+	tag := strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid If-Match header: %q", header)
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid If-Match header: %q", header)
+	}
+	return version, true, nil
+}
@@ -0,0 +1,56 @@
+package ports
+
+import (
+	"net/http"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+// apiKeyRoutes returns the admin routes managing API keys.
+func (s *Server) apiKeyRoutes() []route {
+	return []route{
+		{http.MethodGet, apiV1Prefix + "/api-keys", domain.ScopeAdmin, s.ListAPIKeysHandler},
+		{http.MethodPost, apiV1Prefix + "/api-keys", domain.ScopeAdmin, s.CreateAPIKeyHandler},
+		{http.MethodDelete, apiV1Prefix + "/api-keys/{id}", domain.ScopeAdmin, s.RevokeAPIKeyHandler},
+	}
+}
+
+// ListAPIKeysHandler handles GET /api/v1/api-keys.
+func (s *Server) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeys, err := s.keys.ListAPIKeys(r.Context())
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainAPIKeys(apiKeys))
+}
+
+// CreateAPIKeyHandler handles POST /api/v1/api-keys. The response is the only time the key is revealed.
+func (s *Server) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var createAPIKeyRequest types.CreateAPIKeyRequest
+	if !decodeRequest(w, r, &createAPIKeyRequest) {
+		return
+	}
+
+	apiKey, secret, err := s.keys.CreateAPIKey(r.Context(), createAPIKeyRequest.Name,
+		types.ConvertToDomainScopes(createAPIKeyRequest.Scopes))
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	response := types.ConvertFromDomainAPIKey(apiKey)
+	response.Key = secret
+	w.Header().Set("Location", apiV1Prefix+"/api-keys/"+apiKey.ID)
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// RevokeAPIKeyHandler handles DELETE /api/v1/api-keys/{id}.
+func (s *Server) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.keys.RevokeAPIKey(r.Context(), pathParam(r, "id")); err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/ashermp9/fiskaly-test-task/internal/app"
 	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
 	"github.com/ashermp9/fiskaly-test-task/internal/storage"
 	"go.uber.org/zap"
 )
@@ -27,6 +28,7 @@ func TestServer(t *testing.T) {
 
 	t.Run("CreateDevice", func(t *testing.T) { testCreateDevice(t, server) })
 	t.Run("SignTransaction", func(t *testing.T) { testSignTransaction(t, server) })
+	t.Run("UpdateDevice", func(t *testing.T) { testUpdateDevice(t, server) })
 	t.Run("HealthCheck", func(t *testing.T) { testHealthCheckHandler(t, server) })
 
 }
@@ -76,6 +78,67 @@ func testCreateDevice(t *testing.T, server *Server) {
 	}
 }
 
+func testUpdateDevice(t *testing.T, server *Server) {
+	sendUpdate := func(path, ifMatch, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPatch, path, bytes.NewBufferString(body))
+		if ifMatch != "" {
+			request.Header.Set("If-Match", ifMatch)
+		}
+		responseRecorder := httptest.NewRecorder()
+		server.UpdateDeviceHandler(responseRecorder, request)
+		return responseRecorder
+	}
+
+	responseRecorder := sendUpdate("/api/v0/devices/test-device-id", `"1"`,
+		`{"label": "Till 3", "metadata": {"storeId": "berlin-01", "till": "3"}}`)
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, responseRecorder.Body)
+	}
+	if etag := responseRecorder.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("expected ETag %q, got %q", `"2"`, etag)
+	}
+
+	var updatedDevice types.DeviceResponse
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &updatedDevice); err != nil {
+		t.Fatalf("error unmarshalling response body: %v", err)
+	}
+	if updatedDevice.Label != "Till 3" || updatedDevice.Metadata["storeId"] != "berlin-01" {
+		t.Errorf("update was not applied: got %+v", updatedDevice)
+	}
+	if updatedDevice.SignatureCounter != 2 {
+		t.Errorf("expected SignatureCounter to stay 2, got %v", updatedDevice.SignatureCounter)
+	}
+
+	// Remove a metadata key using the version from the body
+	responseRecorder = sendUpdate("/api/v0/devices/test-device-id", "", `{"metadata": {"till": null}, "version": 2}`)
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, responseRecorder.Body)
+	}
+	updatedDevice = types.DeviceResponse{}
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &updatedDevice); err != nil {
+		t.Fatalf("error unmarshalling response body: %v", err)
+	}
+	if _, found := updatedDevice.Metadata["till"]; found || updatedDevice.Version != 3 {
+		t.Errorf("expected till to be removed at version 3, got %+v", updatedDevice)
+	}
+
+	// A concurrent edit based on an old version must not clobber the newer one
+	responseRecorder = sendUpdate("/api/v0/devices/test-device-id", `"2"`, `{"label": "stale"}`)
+	if status := responseRecorder.Code; status != http.StatusPreconditionFailed {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusPreconditionFailed)
+	}
+
+	responseRecorder = sendUpdate("/api/v0/devices/test-device-id", "", `{"label": "unconditional"}`)
+	if status := responseRecorder.Code; status != http.StatusPreconditionRequired {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusPreconditionRequired)
+	}
+
+	responseRecorder = sendUpdate("/api/v0/devices/unknown-device", `"1"`, `{"label": "missing"}`)
+	if status := responseRecorder.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
 func testHealthCheckHandler(t *testing.T, server *Server) {
 	request := httptest.NewRequest(http.MethodGet, "/api/v0/health", nil)
 	responseRecorder := httptest.NewRecorder()
@@ -0,0 +1,288 @@
+package ports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+const apiV1Prefix = "/api/v1"
+
+// v1Routes returns the resource-oriented routes of the v1 API.
+func (s *Server) v1Routes() []route {
+	return []route{
+		{http.MethodGet, apiV1Prefix + "/devices", domain.ScopeDevicesRead, s.ListDevicesV1Handler},
+		{http.MethodPost, apiV1Prefix + "/devices", domain.ScopeDevicesWrite, s.CreateDeviceV1Handler},
+		{http.MethodGet, apiV1Prefix + "/devices/{id}", domain.ScopeDevicesRead, s.GetDeviceV1Handler},
+		{http.MethodPatch, apiV1Prefix + "/devices/{id}", domain.ScopeDevicesWrite, s.UpdateDeviceV1Handler},
+		{http.MethodGet, apiV1Prefix + "/devices/{id}/signatures", domain.ScopeDevicesRead, s.ListSignaturesV1Handler},
+		{http.MethodPost, apiV1Prefix + "/devices/{id}/signatures", domain.ScopeSign, s.CreateSignatureV1Handler},
+		{http.MethodGet, apiV1Prefix + "/devices/{id}/signatures/{counter}", domain.ScopeDevicesRead, s.GetSignatureV1Handler},
+		{http.MethodGet, apiV1Prefix + "/devices/{id}/export", domain.ScopeDevicesRead, s.ExportDeviceV1Handler},
+		{http.MethodGet, apiV1Prefix + "/audit-events", domain.ScopeAdmin, s.ListAuditEventsHandler},
+	}
+}
+
+func (s *Server) v1Router() *router {
+	routes := s.v1Routes()
+	if s.keys != nil {
+		routes = append(routes, s.apiKeyRoutes()...)
+	}
+	if s.backups != nil {
+		routes = append(routes, s.backupRoutes()...)
+	}
+	for i, rte := range routes {
+		var deviceID func(*http.Request) string
+		if strings.HasPrefix(rte.pattern, apiV1Prefix+"/devices/{id}") {
+			deviceID = devicePathParam
+		}
+		routes[i].handler = s.requireScope(rte.scope, s.rateLimit(deviceID, rte.handler))
+	}
+
+	return &router{
+		routes: routes,
+		notFound: func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound, types.ErrorCodeNotFound, "resource not found")
+		},
+		methodNotAllowed: func(w http.ResponseWriter, r *http.Request, allowed []string) {
+			writeError(w, http.StatusMethodNotAllowed, types.ErrorCodeMethodNotAllowed,
+				fmt.Sprintf("method %s not allowed, use %s", r.Method, strings.Join(allowed, ", ")))
+		},
+	}
+}
+
+// ListDevicesV1Handler handles GET /api/v1/devices.
+func (s *Server) ListDevicesV1Handler(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.APIService.ListDevices(r.Context())
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainDevices(devices))
+}
+
+// CreateDeviceV1Handler handles POST /api/v1/devices.
+func (s *Server) CreateDeviceV1Handler(w http.ResponseWriter, r *http.Request) {
+	var createDeviceRequest types.CreateDeviceRequest
+	if !decodeRequest(w, r, &createDeviceRequest) {
+		return
+	}
+
+	domainRequest := types.ConvertToDomainCreateDeviceRequest(createDeviceRequest)
+	device, err := s.APIService.CreateDevice(r.Context(), domainRequest)
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", deviceLocation(device.ID))
+	w.Header().Set("ETag", formatETag(device.Version))
+	writeJSON(w, http.StatusCreated, types.ConvertFromDomainDevice(device))
+}
+
+// GetDeviceV1Handler handles GET /api/v1/devices/{id}.
+func (s *Server) GetDeviceV1Handler(w http.ResponseWriter, r *http.Request) {
+	device, err := s.APIService.GetDevice(r.Context(), pathParam(r, "id"))
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(device.Version))
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainDevice(device))
+}
+
+// UpdateDeviceV1Handler handles PATCH /api/v1/devices/{id}.
+func (s *Server) UpdateDeviceV1Handler(w http.ResponseWriter, r *http.Request) {
+	var updateDeviceRequest types.UpdateDeviceRequest
+	if !decodeRequest(w, r, &updateDeviceRequest) {
+		return
+	}
+
+	version, ok, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err.Error())
+		return
+	}
+	if !ok {
+		if updateDeviceRequest.Version == nil {
+			writeError(w, http.StatusPreconditionRequired, types.ErrorCodePreconditionRequired,
+				"If-Match header or version is required")
+			return
+		}
+		version = *updateDeviceRequest.Version
+	}
+
+	domainRequest := types.ConvertToDomainUpdateDeviceRequest(pathParam(r, "id"), version, updateDeviceRequest)
+	device, err := s.APIService.UpdateDevice(r.Context(), domainRequest)
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(device.Version))
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainDevice(device))
+}
+
+// ListSignaturesV1Handler handles GET /api/v1/devices/{id}/signatures.
+func (s *Server) ListSignaturesV1Handler(w http.ResponseWriter, r *http.Request) {
+	transactions, err := s.APIService.ListTransactions(r.Context(), pathParam(r, "id"))
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainTransactions(transactions))
+}
+
+// CreateSignatureV1Handler handles POST /api/v1/devices/{id}/signatures.
+func (s *Server) CreateSignatureV1Handler(w http.ResponseWriter, r *http.Request) {
+	var createSignatureRequest types.CreateSignatureRequest
+	if !decodeRequest(w, r, &createSignatureRequest) {
+		return
+	}
+
+	deviceID := pathParam(r, "id")
+	domainRequest := types.ConvertToDomainCreateSignatureRequest(deviceID, createSignatureRequest)
+	signature, err := s.APIService.SignTransaction(r.Context(), domainRequest)
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", signatureLocation(deviceID, signature.Counter))
+	writeJSON(w, http.StatusCreated, types.ConvertFromDomainSignature(deviceID, signature))
+}
+
+// GetSignatureV1Handler handles GET /api/v1/devices/{id}/signatures/{counter}.
+func (s *Server) GetSignatureV1Handler(w http.ResponseWriter, r *http.Request) {
+	counter, err := strconv.Atoi(pathParam(r, "counter"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, types.ErrorCodeSignatureNotFound, "signature counter must be a number")
+		return
+	}
+
+	transaction, err := s.APIService.GetTransaction(r.Context(), pathParam(r, "id"), counter)
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainTransaction(transaction))
+}
+
+// exportTimeout replaces the write timeout of the server for exports, which stream the whole
+// history of a device.
+const exportTimeout = 10 * time.Minute
+
+// ExportDeviceV1Handler handles GET /api/v1/devices/{id}/export.
+func (s *Server) ExportDeviceV1Handler(w http.ResponseWriter, r *http.Request) {
+	deviceID := pathParam(r, "id")
+	// Not supported by every ResponseWriter, e.g. in tests, the server timeout applies then
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportTimeout))
+
+	archive := &downloadWriter{ResponseWriter: w, contentType: "application/x-tar", filename: deviceID + ".tar"}
+	if err := s.APIService.ExportDevice(r.Context(), deviceID, archive); err != nil {
+		if !archive.started {
+			s.writeDomainError(w, r, err)
+			return
+		}
+		// The status is sent already, the client notices the archive is truncated: it lacks
+		// the manifest and the end of archive marker
+		logging.FromContext(r.Context()).Errorw("Export failed", "device_id", deviceID, "error", err)
+	}
+}
+
+// downloadWriter sends the headers of a file download with its first bytes, so errors that
+// occur before are still reported as JSON.
+type downloadWriter struct {
+	http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": w.filename}))
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// writeDomainError maps domain errors to v1 error responses. Unknown errors are logged
+// and reported without details.
+func (s *Server) writeDomainError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrDeviceNotFound):
+		writeError(w, http.StatusNotFound, types.ErrorCodeDeviceNotFound, err.Error())
+	case errors.Is(err, domain.ErrDeviceExists):
+		writeError(w, http.StatusConflict, types.ErrorCodeDeviceExists, err.Error())
+	case errors.Is(err, domain.ErrDeviceDisabled):
+		writeError(w, http.StatusConflict, types.ErrorCodeDeviceDisabled, err.Error())
+	case errors.Is(err, domain.ErrVersionMismatch):
+		writeError(w, http.StatusPreconditionFailed, types.ErrorCodeVersionMismatch, err.Error())
+	case errors.Is(err, domain.ErrCounterConflict):
+		writeError(w, http.StatusConflict, types.ErrorCodeCounterConflict, err.Error())
+	case errors.Is(err, domain.ErrLeaseExpired):
+		writeError(w, http.StatusConflict, types.ErrorCodeLeaseExpired, err.Error())
+	case errors.Is(err, domain.ErrTransactionNotFound):
+		writeError(w, http.StatusNotFound, types.ErrorCodeSignatureNotFound, err.Error())
+	case errors.Is(err, domain.ErrAPIKeyNotFound):
+		writeError(w, http.StatusNotFound, types.ErrorCodeAPIKeyNotFound, err.Error())
+	case errors.Is(err, domain.ErrAlgorithmNotAllowed):
+		writeError(w, http.StatusBadRequest, types.ErrorCodeAlgorithmNotAllowed, err.Error())
+	case errors.Is(err, domain.ErrForbidden):
+		writeError(w, http.StatusForbidden, types.ErrorCodeForbidden, err.Error())
+	case errors.Is(err, domain.ErrInvalidBackup):
+		writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidBackup, err.Error())
+	case errors.Is(err, domain.ErrCounterRollback):
+		writeError(w, http.StatusConflict, types.ErrorCodeCounterRollback, err.Error())
+	default:
+		logging.FromContext(r.Context()).Errorw("Request failed", "error", err)
+		writeError(w, http.StatusInternalServerError, types.ErrorCodeInternal, "internal error")
+	}
+}
+
+// decodeRequest decodes and validates a JSON body, writing the error response if either fails.
+func decodeRequest(w http.ResponseWriter, r *http.Request, request types.Validator) bool {
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err.Error())
+		return false
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, types.ErrorResponse{Error: types.ErrorBody{Code: code, Message: message}})
+}
+
+func deviceLocation(deviceID string) string {
+	return apiV1Prefix + "/devices/" + url.PathEscape(deviceID)
+}
+
+func signatureLocation(deviceID string, counter int) string {
+	return fmt.Sprintf("%s/signatures/%d", deviceLocation(deviceID), counter)
+}
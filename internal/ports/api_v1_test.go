@@ -0,0 +1,318 @@
+package ports
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/crypto"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	signing "github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.uber.org/zap"
+)
+
+func newTestHandler() http.Handler {
+	loggerZap, _ := zap.NewDevelopment()
+	appService := app.NewAPIService(storage.NewStorage())
+	return NewServer(loggerZap.Sugar(), appService, 8080).Handler()
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+func decodeBody[T any](t *testing.T, responseRecorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var body T
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error unmarshalling response body %q: %v", responseRecorder.Body, err)
+	}
+	return body
+}
+
+func TestV1Devices(t *testing.T) {
+	handler := newTestHandler()
+
+	responseRecorder := serve(handler, http.MethodPost, "/api/v1/devices",
+		`{"id": "v1-device", "algorithm": "ECC", "label": "Till 1"}`)
+	if status := responseRecorder.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	if location := responseRecorder.Header().Get("Location"); location != "/api/v1/devices/v1-device" {
+		t.Errorf("unexpected Location header: %q", location)
+	}
+	if responseRecorder.Body.String() == "" || bytes.Contains(responseRecorder.Body.Bytes(), []byte("PRIVATE")) {
+		t.Errorf("response must contain the device without its private key: %s", responseRecorder.Body)
+	}
+
+	responseRecorder = serve(handler, http.MethodPost, "/api/v1/devices",
+		`{"id": "v1-device", "algorithm": "ECC"}`)
+	if status := responseRecorder.Code; status != http.StatusConflict {
+		t.Errorf("creating a duplicate device returned %v, want %v", status, http.StatusConflict)
+	}
+	if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != types.ErrorCodeDeviceExists {
+		t.Errorf("unexpected error code: %q", body.Error.Code)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/devices/v1-device", "")
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	device := decodeBody[types.DeviceResponse](t, responseRecorder)
+	if device.ID != "v1-device" || device.Algorithm != "ECC" || device.PublicKey == "" {
+		t.Errorf("unexpected device: %+v", device)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/devices", "")
+	if devices := decodeBody[types.DeviceListResponse](t, responseRecorder); len(devices.Devices) != 1 {
+		t.Errorf("expected 1 device, got %+v", devices)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/devices/unknown", "")
+	if status := responseRecorder.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+	if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != types.ErrorCodeDeviceNotFound {
+		t.Errorf("unexpected error code: %q", body.Error.Code)
+	}
+}
+
+func TestV1Signatures(t *testing.T) {
+	handler := newTestHandler()
+	serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "v1-device", "algorithm": "ECC"}`)
+
+	var lastSignature string
+	for counter := 0; counter < 3; counter++ {
+		data := fmt.Sprintf("receipt %d", counter)
+		responseRecorder := serve(handler, http.MethodPost, "/api/v1/devices/v1-device/signatures",
+			fmt.Sprintf(`{"data": %q}`, data))
+		if status := responseRecorder.Code; status != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		}
+		expectedLocation := fmt.Sprintf("/api/v1/devices/v1-device/signatures/%d", counter)
+		if location := responseRecorder.Header().Get("Location"); location != expectedLocation {
+			t.Errorf("expected Location %q, got %q", expectedLocation, location)
+		}
+
+		signature := decodeBody[types.SignatureResponse](t, responseRecorder)
+		expectedLastSignature := base64.StdEncoding.EncodeToString([]byte("v1-device"))
+		if counter > 0 {
+			expectedLastSignature = lastSignature
+		}
+		expectedSignedData := fmt.Sprintf("%d_%s_%s", counter, data, expectedLastSignature)
+		if signature.Counter != counter || signature.SignedData != expectedSignedData {
+			t.Errorf("unexpected signature: %+v", signature)
+		}
+		lastSignature = signature.Signature
+	}
+
+	responseRecorder := serve(handler, http.MethodGet, "/api/v1/devices/v1-device/signatures", "")
+	signatures := decodeBody[types.SignatureListResponse](t, responseRecorder)
+	if len(signatures.Signatures) != 3 || signatures.Signatures[2].Signature != lastSignature {
+		t.Errorf("unexpected signature history: %+v", signatures)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/devices/v1-device/signatures/2", "")
+	if signature := decodeBody[types.SignatureResponse](t, responseRecorder); signature.Signature != lastSignature {
+		t.Errorf("unexpected signature: %+v", signature)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/devices/v1-device/signatures/3", "")
+	if status := responseRecorder.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+
+	responseRecorder = serve(handler, http.MethodPost, "/api/v1/devices/unknown/signatures", `{"data": "x"}`)
+	if status := responseRecorder.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestV1MethodEnforcement(t *testing.T) {
+	handler := newTestHandler()
+
+	responseRecorder := serve(handler, http.MethodDelete, "/api/v1/devices", "")
+	if status := responseRecorder.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
+	}
+	if allow := responseRecorder.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("unexpected Allow header: %q", allow)
+	}
+
+	responseRecorder = serve(handler, http.MethodPut, "/api/v1/devices/some-device/signatures/0", "")
+	if status := responseRecorder.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/unknown", "")
+	if status := responseRecorder.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestV1IdempotencyKey(t *testing.T) {
+	handler := newTestHandler()
+	serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "v1-device", "algorithm": "ECC"}`)
+
+	sign := func(key, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/devices/v1-device/signatures", bytes.NewBufferString(body))
+		request.Header.Set("Idempotency-Key", key)
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+		return responseRecorder
+	}
+
+	first := sign("key-1", `{"data": "receipt"}`)
+	retried := sign("key-1", `{"data": "receipt"}`)
+	if first.Code != http.StatusCreated || retried.Code != http.StatusCreated {
+		t.Fatalf("unexpected status codes: %d, %d", first.Code, retried.Code)
+	}
+	if retried.Header().Get("Idempotent-Replayed") != "true" || retried.Body.String() != first.Body.String() {
+		t.Errorf("retry was not replayed: %s", retried.Body)
+	}
+	if retried.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("replayed Location %q differs from %q", retried.Header().Get("Location"), first.Header().Get("Location"))
+	}
+
+	if second := decodeBody[types.SignatureResponse](t, sign("key-2", `{"data": "receipt"}`)); second.Counter != 1 {
+		t.Errorf("expected a new key to sign again with counter 1, got %d", second.Counter)
+	}
+
+	responseRecorder := sign("key-1", `{"data": "other receipt"}`)
+	if status := responseRecorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+	if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != types.ErrorCodeIdempotencyKeyReused {
+		t.Errorf("unexpected error code: %q", body.Error.Code)
+	}
+}
+
+func TestV1CryptoPolicy(t *testing.T) {
+	stor := storage.NewStorage()
+	if err := stor.SetCryptoPolicy(crypto.Policy{AllowedAlgorithms: []domain.Algorithm{domain.AlgorithmECC}, ECCCurve: "P-256"}); err != nil {
+		t.Fatal(err)
+	}
+	loggerZap, _ := zap.NewDevelopment()
+	handler := NewServer(loggerZap.Sugar(), app.NewAPIService(stor), 8080).Handler()
+
+	responseRecorder := serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "rsa-device", "algorithm": "RSA"}`)
+	if status := responseRecorder.Code; status != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != types.ErrorCodeAlgorithmNotAllowed {
+		t.Errorf("unexpected error code: %q", body.Error.Code)
+	}
+
+	responseRecorder = serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "ecc-device", "algorithm": "ECC"}`)
+	if status := responseRecorder.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	device := decodeBody[types.DeviceResponse](t, responseRecorder)
+	block, _ := pem.Decode([]byte(device.PublicKey))
+	if block == nil {
+		t.Fatalf("public key is not PEM encoded: %q", device.PublicKey)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := publicKey.(*ecdsa.PublicKey); !ok || key.Curve.Params().Name != "P-256" {
+		t.Errorf("expected a P-256 key, got %T", publicKey)
+	}
+}
+
+func TestV1ExportDevice(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	generator := signing.ECCGenerator{}
+	_, privateKey, err := generator.GenerateBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, publicKey, err := signing.NewSignerFromPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appService := app.NewAPIService(storage.NewStorage(), app.WithExportKey(signer, publicKey))
+	handler := NewServer(loggerZap.Sugar(), appService, 8080).Handler()
+
+	serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "till 1", "algorithm": "ECC"}`)
+	serve(handler, http.MethodPost, "/api/v1/devices/till%201/signatures", `{"data": "receipt, 1"}`)
+	serve(handler, http.MethodPost, "/api/v1/devices/till%201/signatures", `{"data": "receipt 2"}`)
+
+	responseRecorder := serve(handler, http.MethodGet, "/api/v1/devices/till%201/export", "")
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, responseRecorder.Body)
+	}
+	if contentType := responseRecorder.Header().Get("Content-Type"); contentType != "application/x-tar" {
+		t.Errorf("unexpected Content-Type %q", contentType)
+	}
+	if disposition := responseRecorder.Header().Get("Content-Disposition"); disposition != `attachment; filename="till 1.tar"` {
+		t.Errorf("unexpected Content-Disposition %q", disposition)
+	}
+
+	entries := make(map[string][]byte)
+	var names []string
+	archive := tar.NewReader(responseRecorder.Body)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(archive)
+		entries[header.Name] = content
+		names = append(names, header.Name)
+	}
+	if fmt.Sprint(names) != "[device.json public_key.pem service_key.pem transactions.jsonl transactions.csv manifest.json manifest.sig]" {
+		t.Fatalf("unexpected entries %v", names)
+	}
+	if !bytes.Equal(entries["service_key.pem"], publicKey) {
+		t.Errorf("expected the service key in the bundle, got %s", entries["service_key.pem"])
+	}
+	records, err := csv.NewReader(bytes.NewReader(entries["transactions.csv"])).ReadAll()
+	if err != nil || len(records) != 3 || records[1][0] != "till 1" || records[1][2] != "receipt, 1" {
+		t.Errorf("unexpected CSV %q: %v", entries["transactions.csv"], err)
+	}
+
+	verifier, _ := signing.NewVerifier(publicKey)
+	signature, _ := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(entries["manifest.sig"])))
+	if err := verifier.Verify(entries["manifest.json"], signature); err != nil {
+		t.Errorf("manifest signature: %v", err)
+	}
+	var manifest struct {
+		Transactions int `json:"transactions"`
+		Files        []struct {
+			Name string `json:"name"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(entries["manifest.json"], &manifest); err != nil || manifest.Transactions != 2 || len(manifest.Files) != 5 {
+		t.Errorf("unexpected manifest %s: %v", entries["manifest.json"], err)
+	}
+
+	responseRecorder = serve(handler, http.MethodGet, "/api/v1/devices/unknown/export", "")
+	if status := responseRecorder.Code; status != http.StatusNotFound {
+		t.Errorf("exporting an unknown device returned %v, want %v", status, http.StatusNotFound)
+	}
+	if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != types.ErrorCodeDeviceNotFound {
+		t.Errorf("unexpected error code: %q", body.Error.Code)
+	}
+}
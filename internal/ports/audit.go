@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"net/http"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+// ListAuditEventsHandler handles GET /api/v1/audit-events. Without the deviceId filter the
+// response is the tenant's complete chain and can be verified offline with cmd/auditverify.
+func (s *Server) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	events := s.APIService.ListAuditEvents(r.Context(), r.URL.Query().Get("deviceId"))
+	writeJSON(w, http.StatusOK, types.AuditEventListResponse{Events: events})
+}
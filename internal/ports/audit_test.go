@@ -0,0 +1,181 @@
+package ports
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+	signing "github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.uber.org/zap"
+)
+
+func newAuditTestHandler(auditLog *storage.AuditLog) http.Handler {
+	loggerZap, _ := zap.NewDevelopment()
+	stor := storage.NewStorage()
+	keys := app.NewKeyService(stor, []domain.APIKey{
+		{ID: "a", TenantID: "tenant-a", Hash: app.HashAPIKey("key-a"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+		{ID: "b", TenantID: "tenant-b", Hash: app.HashAPIKey("key-b"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+		{ID: "writer", TenantID: "tenant-a", Hash: app.HashAPIKey("key-writer"), Scopes: []domain.Scope{domain.ScopeDevicesWrite}},
+	}, app.WithKeyAuditLog(auditLog))
+	appService := app.NewAPIService(stor, app.WithAuditLog(auditLog))
+	return NewServer(loggerZap.Sugar(), appService, 8080, WithAPIKeys(keys)).Handler()
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	auditLog, _, err := storage.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newAuditTestHandler(auditLog)
+	document := openapi.MustLoad()
+
+	for _, step := range []struct {
+		key, method, path, body string
+		status                  int
+	}{
+		{"key-writer", http.MethodPost, "/api/v1/devices", `{"id": "till", "algorithm": "ECC", "label": "Till"}`, http.StatusCreated},
+		{"key-writer", http.MethodPatch, "/api/v1/devices/till", `{"label": "Front till"}`, http.StatusOK},
+		{"key-a", http.MethodPost, "/api/v1/devices/till/signatures", `{"data": "receipt"}`, http.StatusCreated},
+		{"key-a", http.MethodPost, "/api/v1/api-keys", `{"name": "till-service", "scopes": ["sign"]}`, http.StatusCreated},
+		{"key-b", http.MethodPost, "/api/v1/devices", `{"id": "other", "algorithm": "ECC"}`, http.StatusCreated},
+	} {
+		request := httptest.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+		request.Header.Set("Authorization", "Bearer "+step.key)
+		request.Header.Set("If-Match", `"1"`)
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+		if responseRecorder.Code != step.status {
+			t.Fatalf("%s %s: got status %d want %d: %s", step.method, step.path, responseRecorder.Code, step.status, responseRecorder.Body)
+		}
+	}
+
+	if responseRecorder := serveWithKey(handler, "key-writer", http.MethodGet, "/api/v1/audit-events", ""); responseRecorder.Code != http.StatusForbidden {
+		t.Errorf("listing audit events requires the admin scope, got %d", responseRecorder.Code)
+	}
+
+	responseRecorder := serveWithKey(handler, "key-a", http.MethodGet, "/api/v1/audit-events", "")
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("listing audit events returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	_, operation, _ := document.FindOperation(http.MethodGet, "/api/v1/audit-events")
+	if err := document.ValidateResponse(operation, responseRecorder.Code, responseRecorder.Header(), responseRecorder.Body.Bytes()); err != nil {
+		t.Errorf("response does not match the specification: %v", err)
+	}
+
+	// Signing is not an administrative action, the other tenant's device is not visible
+	events := decodeBody[types.AuditEventListResponse](t, responseRecorder).Events
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.Actor+" "+event.Action+" "+event.DeviceID)
+	}
+	expected := []string{"writer device.create till", "writer device.update till", "a api_key.create "}
+	if strings.Join(actions, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("unexpected audit events %q, want %q", actions, expected)
+	}
+	if events[1].Details["label"] != "Front till" || events[1].Details["version"] != "2" {
+		t.Errorf("unexpected details of the update %v", events[1].Details)
+	}
+	if chains, err := audit.Verify(events); err != nil || chains != 1 {
+		t.Errorf("the tenant's events must verify as one chain, got %d, %v", chains, err)
+	}
+
+	filtered := decodeBody[types.AuditEventListResponse](t,
+		serveWithKey(handler, "key-a", http.MethodGet, "/api/v1/audit-events?deviceId=till", "")).Events
+	if len(filtered) != 2 {
+		t.Errorf("expected the two events of the device, got %d", len(filtered))
+	}
+
+	// The log file holds the chains of both tenants and survives a restart
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, _, err := storage.OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("reopening the audit log: %v", err)
+	}
+	handler = newAuditTestHandler(reopened)
+	serveWithKey(handler, "key-a", http.MethodDelete, "/api/v1/api-keys/writer", "")
+	reopened.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged, err := audit.ReadLog(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chains, err := audit.Verify(logged); err != nil || chains != 2 || len(logged) != 5 {
+		t.Fatalf("expected 5 verified events in 2 chains, got %d events, %d chains, %v", len(logged), chains, err)
+	}
+	if last := logged[4]; last.Action != audit.ActionAPIKeyRevoke || last.Sequence != 4 || last.PreviousHash != events[2].Hash {
+		t.Errorf("the revocation must continue the chain of tenant-a, got %+v", last)
+	}
+
+	// Any modification of the file is detected
+	content, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(content), `"label":"Front till"`, `"label":"Back till"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := storage.OpenAuditLog(path); err == nil {
+		t.Error("a tampered audit log must be refused")
+	}
+	tamperedEvents, _ := audit.ReadLog(strings.NewReader(tampered))
+	if _, err := audit.Verify(tamperedEvents); err == nil || !strings.Contains(err.Error(), "event 2 of tenant \"tenant-a\"") {
+		t.Errorf("expected the modified event to be reported, got %v", err)
+	}
+	if _, err := audit.Verify(append(logged[:1:1], logged[2:]...)); err == nil {
+		t.Error("a removed event must be detected")
+	}
+}
+
+// failingAuditLog refuses every event, as a full disk would.
+type failingAuditLog struct{}
+
+func (failingAuditLog) Append(context.Context, audit.Event) (audit.Event, error) {
+	return audit.Event{}, errors.New("no space left on device")
+}
+
+func (failingAuditLog) List(context.Context, string) []audit.Event {
+	return nil
+}
+
+// TestExportRequiresAudit checks that an export is refused without disclosing anything when
+// its audit event cannot be written.
+func TestExportRequiresAudit(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	_, privateKey, err := (&signing.ECCGenerator{}).GenerateBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, publicKey, err := signing.NewSignerFromPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appService := app.NewAPIService(storage.NewStorage(), app.WithExportKey(signer, publicKey), app.WithAuditLog(failingAuditLog{}))
+	handler := NewServer(loggerZap.Sugar(), appService, 8080).Handler()
+
+	// Changes took effect before they are logged and still succeed
+	if responseRecorder := serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "till", "algorithm": "ECC"}`); responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("creating a device returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	responseRecorder := serve(handler, http.MethodGet, "/api/v1/devices/till/export", "")
+	if responseRecorder.Code != http.StatusInternalServerError || strings.Contains(responseRecorder.Body.String(), "BEGIN PUBLIC KEY") {
+		t.Errorf("an unlogged export must fail before writing the bundle, got %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+}
@@ -0,0 +1,84 @@
+package ports
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// AuthenticationMiddleware resolves the API key of a request, sent either as bearer token
+// or in the X-API-Key header, and attaches the principal to the request context. Requests
+// without an API key may authenticate with a client certificate mapped in TLSOptions.
+// Authentication is disabled if the server was created without WithAPIKeys and client subjects.
+func (s *Server) AuthenticationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticationEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := apiKeyFromRequest(r)
+		if key == "" {
+			if principal, ok := s.certificatePrincipal(r); ok {
+				next.ServeHTTP(w, r.WithContext(domain.ContextWithPrincipal(r.Context(), principal)))
+				return
+			}
+		}
+
+		principal, err := s.authenticateAPIKey(r, key)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="signer"`)
+			writeError(w, http.StatusUnauthorized, types.ErrorCodeUnauthenticated, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(domain.ContextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// requireScope rejects requests whose principal was not granted the scope.
+func (s *Server) requireScope(scope domain.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticationEnabled() {
+			next(w, r)
+			return
+		}
+
+		principal, ok := domain.PrincipalFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, types.ErrorCodeUnauthenticated, domain.ErrUnauthenticated.Error())
+			return
+		}
+		if !principal.HasScope(scope) {
+			writeError(w, http.StatusForbidden, types.ErrorCodeForbidden, "API key lacks the "+string(scope)+" scope")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) authenticationEnabled() bool {
+	return s.keys != nil || (s.tls != nil && len(s.tls.ClientSubjects) > 0)
+}
+
+func (s *Server) authenticateAPIKey(r *http.Request, key string) (domain.Principal, error) {
+	if s.keys == nil {
+		return domain.Principal{}, domain.ErrUnauthenticated
+	}
+	return s.keys.Authenticate(r.Context(), key)
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.Header.Get(apiKeyHeader)
+}
@@ -0,0 +1,170 @@
+package ports
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+const testAdminKey = "test-admin-key"
+
+func newAuthenticatedTestHandler() http.Handler {
+	loggerZap, _ := zap.NewDevelopment()
+	stor := storage.NewStorage()
+	keys := app.NewKeyService(stor, []domain.APIKey{
+		{ID: "admin", Name: "Test admin", Hash: app.HashAPIKey(testAdminKey), Scopes: []domain.Scope{domain.ScopeAdmin}},
+	})
+	return NewServer(loggerZap.Sugar(), app.NewAPIService(stor), 8080, WithAPIKeys(keys)).Handler()
+}
+
+func serveWithKey(handler http.Handler, key, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+func TestAuthentication(t *testing.T) {
+	document := openapi.MustLoad()
+	handler := newAuthenticatedTestHandler()
+
+	checkResponse := func(method, path string, responseRecorder *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		if responseRecorder.Code != status {
+			t.Fatalf("%s %s: got status %d want %d: %s", method, path, responseRecorder.Code, status, responseRecorder.Body)
+		}
+		if code != "" {
+			if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != code {
+				t.Errorf("%s %s: unexpected error code %q", method, path, body.Error.Code)
+			}
+		}
+		_, operation, ok := document.FindOperation(method, path)
+		if !ok {
+			return
+		}
+		if err := document.ValidateResponse(operation, responseRecorder.Code, responseRecorder.Header(),
+			responseRecorder.Body.Bytes()); err != nil {
+			t.Errorf("%s %s: response does not match the specification: %v", method, path, err)
+		}
+	}
+
+	responseRecorder := serveWithKey(handler, "", http.MethodGet, "/api/v1/devices", "")
+	checkResponse(http.MethodGet, "/api/v1/devices", responseRecorder, http.StatusUnauthorized, types.ErrorCodeUnauthenticated)
+	if responseRecorder.Header().Get("WWW-Authenticate") == "" {
+		t.Error("401 responses must carry a WWW-Authenticate header")
+	}
+	responseRecorder = serveWithKey(handler, "wrong", http.MethodGet, "/api/v1/devices", "")
+	checkResponse(http.MethodGet, "/api/v1/devices", responseRecorder, http.StatusUnauthorized, types.ErrorCodeUnauthenticated)
+	responseRecorder = serveWithKey(handler, "", http.MethodPost, "/api/v0/create-device", `{"id": "v0", "algorithm": "ECC"}`)
+	checkResponse(http.MethodPost, "/api/v0/create-device", responseRecorder, http.StatusUnauthorized, types.ErrorCodeUnauthenticated)
+	responseRecorder = serveWithKey(handler, "", http.MethodGet, "/api/v0/health", "")
+	checkResponse(http.MethodGet, "/api/v0/health", responseRecorder, http.StatusOK, "")
+
+	responseRecorder = serveWithKey(handler, testAdminKey, http.MethodPost, "/api/v1/devices", `{"id": "device", "algorithm": "ECC"}`)
+	checkResponse(http.MethodPost, "/api/v1/devices", responseRecorder, http.StatusCreated, "")
+
+	// A key limited to reading may list devices and signatures but not sign
+	responseRecorder = serveWithKey(handler, testAdminKey, http.MethodPost, "/api/v1/api-keys",
+		`{"name": "auditor", "scopes": ["devices:read"]}`)
+	checkResponse(http.MethodPost, "/api/v1/api-keys", responseRecorder, http.StatusCreated, "")
+	created := decodeBody[types.APIKeyResponse](t, responseRecorder)
+	if created.Key == "" || responseRecorder.Header().Get("Location") != "/api/v1/api-keys/"+created.ID {
+		t.Fatalf("unexpected created key: %+v, Location %q", created, responseRecorder.Header().Get("Location"))
+	}
+
+	responseRecorder = serveWithKey(handler, created.Key, http.MethodGet, "/api/v1/devices/device/signatures", "")
+	checkResponse(http.MethodGet, "/api/v1/devices/device/signatures", responseRecorder, http.StatusOK, "")
+	responseRecorder = serveWithKey(handler, created.Key, http.MethodPost, "/api/v1/devices/device/signatures", `{"data": "receipt"}`)
+	checkResponse(http.MethodPost, "/api/v1/devices/device/signatures", responseRecorder, http.StatusForbidden, types.ErrorCodeForbidden)
+	responseRecorder = serveWithKey(handler, created.Key, http.MethodGet, "/api/v1/api-keys", "")
+	checkResponse(http.MethodGet, "/api/v1/api-keys", responseRecorder, http.StatusForbidden, types.ErrorCodeForbidden)
+
+	responseRecorder = serveWithKey(handler, testAdminKey, http.MethodGet, "/api/v1/api-keys", "")
+	checkResponse(http.MethodGet, "/api/v1/api-keys", responseRecorder, http.StatusOK, "")
+	list := decodeBody[types.APIKeyListResponse](t, responseRecorder)
+	if len(list.APIKeys) != 2 || bytes.Contains(responseRecorder.Body.Bytes(), []byte(created.Key)) {
+		t.Errorf("listing must return both keys without secrets: %s", responseRecorder.Body)
+	}
+
+	responseRecorder = serveWithKey(handler, testAdminKey, http.MethodDelete, "/api/v1/api-keys/"+created.ID, "")
+	checkResponse(http.MethodDelete, "/api/v1/api-keys/"+created.ID, responseRecorder, http.StatusNoContent, "")
+	responseRecorder = serveWithKey(handler, testAdminKey, http.MethodDelete, "/api/v1/api-keys/"+created.ID, "")
+	checkResponse(http.MethodDelete, "/api/v1/api-keys/"+created.ID, responseRecorder, http.StatusNotFound, types.ErrorCodeAPIKeyNotFound)
+	responseRecorder = serveWithKey(handler, created.Key, http.MethodGet, "/api/v1/devices", "")
+	checkResponse(http.MethodGet, "/api/v1/devices", responseRecorder, http.StatusUnauthorized, types.ErrorCodeUnauthenticated)
+
+	responseRecorder = serveWithKey(handler, testAdminKey, http.MethodPost, "/api/v1/api-keys",
+		`{"name": "bad", "scopes": ["everything"]}`)
+	checkResponse(http.MethodPost, "/api/v1/api-keys", responseRecorder, http.StatusBadRequest, types.ErrorCodeInvalidRequest)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	stor := storage.NewStorage()
+	keys := app.NewKeyService(stor, []domain.APIKey{
+		{ID: "a", TenantID: "tenant-a", Hash: app.HashAPIKey("key-a"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+		{ID: "b", TenantID: "tenant-b", Hash: app.HashAPIKey("key-b"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+	})
+	handler := NewServer(loggerZap.Sugar(), app.NewAPIService(stor), 8080, WithAPIKeys(keys)).Handler()
+
+	// Both tenants may use the same device ID
+	for _, key := range []string{"key-a", "key-b"} {
+		responseRecorder := serveWithKey(handler, key, http.MethodPost, "/api/v1/devices", `{"id": "till", "algorithm": "ECC"}`)
+		if responseRecorder.Code != http.StatusCreated {
+			t.Fatalf("creating the device with %s returned %d: %s", key, responseRecorder.Code, responseRecorder.Body)
+		}
+	}
+	responseRecorder := serveWithKey(handler, "key-a", http.MethodPost, "/api/v1/devices", `{"id": "only-a", "algorithm": "ECC"}`)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("creating the device returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	responseRecorder = serveWithKey(handler, "key-a", http.MethodPost, "/api/v1/devices/till/signatures", `{"data": "receipt"}`)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("signing returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	for _, step := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/api/v1/devices/only-a", ""},
+		{http.MethodPatch, "/api/v1/devices/only-a", `{"label": "mine", "version": 1}`},
+		{http.MethodPost, "/api/v1/devices/only-a/signatures", `{"data": "receipt"}`},
+		{http.MethodGet, "/api/v1/devices/only-a/signatures", ""},
+		{http.MethodPost, "/api/v0/sign-transaction", `{"deviceId": "only-a", "data": "receipt"}`},
+	} {
+		if responseRecorder := serveWithKey(handler, "key-b", step.method, step.path, step.body); responseRecorder.Code != http.StatusNotFound {
+			t.Errorf("%s %s by another tenant returned %d, want %d", step.method, step.path, responseRecorder.Code, http.StatusNotFound)
+		}
+	}
+
+	responseRecorder = serveWithKey(handler, "key-b", http.MethodGet, "/api/v1/devices", "")
+	devices := decodeBody[types.DeviceListResponse](t, responseRecorder)
+	if len(devices.Devices) != 1 || devices.Devices[0].TenantID != "tenant-b" || devices.Devices[0].SignatureCounter != 0 {
+		t.Errorf("tenant-b must only see its own device: %+v", devices)
+	}
+	responseRecorder = serveWithKey(handler, "key-b", http.MethodGet, "/api/v1/devices/till/signatures/0", "")
+	if responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("reading the signature of another tenant's device returned %d", responseRecorder.Code)
+	}
+
+	responseRecorder = serveWithKey(handler, "key-b", http.MethodGet, "/api/v1/api-keys", "")
+	if list := decodeBody[types.APIKeyListResponse](t, responseRecorder); len(list.APIKeys) != 1 || list.APIKeys[0].ID != "b" {
+		t.Errorf("tenant-b must only see its own API keys: %+v", list)
+	}
+	if responseRecorder := serveWithKey(handler, "key-b", http.MethodDelete, "/api/v1/api-keys/a", ""); responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("revoking another tenant's key returned %d", responseRecorder.Code)
+	}
+}
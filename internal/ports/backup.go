@@ -0,0 +1,51 @@
+package ports
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+// maxBackupSize bounds the body of a restore. Backups are far larger than other requests.
+const maxBackupSize = 1 << 30
+
+// backupRoutes returns the admin routes backing up and restoring the whole service.
+func (s *Server) backupRoutes() []route {
+	return []route{
+		{http.MethodGet, apiV1Prefix + "/backup", domain.ScopeAdmin, s.BackupHandler},
+		{http.MethodPut, apiV1Prefix + "/backup", domain.ScopeAdmin, s.RestoreHandler},
+	}
+}
+
+// BackupHandler handles GET /api/v1/backup.
+func (s *Server) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	filename := "signer-" + time.Now().UTC().Format("20060102T150405Z") + ".backup"
+	download := &downloadWriter{ResponseWriter: w, contentType: "application/octet-stream", filename: filename}
+	if err := s.backups.Backup(r.Context(), download); err != nil {
+		if !download.started {
+			s.writeDomainError(w, r, err)
+			return
+		}
+		logging.FromContext(r.Context()).Errorw("Backup failed", "error", err)
+	}
+}
+
+// RestoreHandler handles PUT /api/v1/backup.
+func (s *Server) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.backups.Restore(r.Context(), http.MaxBytesReader(w, r.Body, maxBackupSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, types.ErrorCodeInvalidRequest, "backup too large")
+		return
+	}
+	if err != nil {
+		s.writeDomainError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, types.ConvertFromDomainRestoreSummary(summary))
+}
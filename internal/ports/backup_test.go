@@ -0,0 +1,163 @@
+package ports
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+const testTenantAdminKey = "test-acme-admin-key"
+
+// newBackupTestHandler serves an empty instance with an admin of the default tenant and one
+// of the tenant acme, encrypting backups with key.
+func newBackupTestHandler(t *testing.T, key []byte) http.Handler {
+	t.Helper()
+	loggerZap, _ := zap.NewDevelopment()
+	stor := storage.NewStorage()
+	keys := app.NewKeyService(stor, []domain.APIKey{
+		{ID: "admin", Hash: app.HashAPIKey(testAdminKey), Scopes: []domain.Scope{domain.ScopeAdmin}},
+		{ID: "acme-admin", TenantID: "acme", Hash: app.HashAPIKey(testTenantAdminKey), Scopes: []domain.Scope{domain.ScopeAdmin}},
+	})
+	backups, err := app.NewBackupService(stor, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(loggerZap.Sugar(), app.NewAPIService(stor), 8080, WithAPIKeys(keys), WithBackups(backups)).Handler()
+}
+
+func TestBackupRestore(t *testing.T) {
+	document := openapi.MustLoad()
+	key := bytes.Repeat([]byte{1}, app.BackupKeySize)
+	source := newBackupTestHandler(t, key)
+
+	check := func(step string, responseRecorder interface {
+		Result() *http.Response
+	}, status int, code string) {
+		t.Helper()
+		response := responseRecorder.Result()
+		body := new(bytes.Buffer)
+		body.ReadFrom(response.Body)
+		if response.StatusCode != status {
+			t.Fatalf("%s: got status %d want %d: %s", step, response.StatusCode, status, body)
+		}
+		if code != "" && !strings.Contains(body.String(), `"code":"`+code+`"`) {
+			t.Errorf("%s: expected error code %q, got %s", step, code, body)
+		}
+		path, method := apiV1Prefix+"/backup", http.MethodGet
+		if strings.HasPrefix(step, "restore") {
+			method = http.MethodPut
+		}
+		_, operation, _ := document.FindOperation(method, path)
+		if err := document.ValidateResponse(operation, response.StatusCode, response.Header, body.Bytes()); err != nil {
+			t.Errorf("%s: response does not match the specification: %v", step, err)
+		}
+	}
+
+	for _, device := range []struct{ key, id, algorithm string }{
+		{testAdminKey, "till-1", "ECC"}, {testAdminKey, "till-2", "RSA"}, {testTenantAdminKey, "till-1", "ECC"},
+	} {
+		serveWithKey(source, device.key, http.MethodPost, "/api/v1/devices",
+			fmt.Sprintf(`{"id": %q, "algorithm": %q}`, device.id, device.algorithm))
+		for i := 0; i < 3; i++ {
+			serveWithKey(source, device.key, http.MethodPost, "/api/v1/devices/"+device.id+"/signatures",
+				fmt.Sprintf(`{"data": "receipt %d"}`, i))
+		}
+	}
+	serveWithKey(source, testAdminKey, http.MethodPost, "/api/v1/api-keys", `{"name": "till", "scopes": ["sign"]}`)
+
+	check("backup by another tenant", serveWithKey(source, testTenantAdminKey, http.MethodGet, "/api/v1/backup", ""),
+		http.StatusForbidden, types.ErrorCodeForbidden)
+	responseRecorder := serveWithKey(source, testAdminKey, http.MethodGet, "/api/v1/backup", "")
+	if responseRecorder.Code != http.StatusOK || responseRecorder.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("backup failed with %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	backup := responseRecorder.Body.String()
+	if strings.Contains(backup, "PRIVATE") || strings.Contains(backup, "receipt") {
+		t.Error("the backup must be encrypted")
+	}
+
+	target := newBackupTestHandler(t, key)
+	check("restore by another tenant", serveWithKey(target, testTenantAdminKey, http.MethodPut, "/api/v1/backup", backup),
+		http.StatusForbidden, types.ErrorCodeForbidden)
+	responseRecorder = serveWithKey(target, testAdminKey, http.MethodPut, "/api/v1/backup", backup)
+	check("restore", responseRecorder, http.StatusOK, "")
+	if summary := decodeBody[types.RestoreResponse](t, responseRecorder); summary != (types.RestoreResponse{
+		Devices: 3, Transactions: 9, APIKeys: 1,
+	}) {
+		t.Errorf("unexpected restore summary %+v", summary)
+	}
+
+	// Restored devices continue their chains in their tenants
+	responseRecorder = serveWithKey(target, testTenantAdminKey, http.MethodPost, "/api/v1/devices/till-1/signatures", `{"data": "receipt 3"}`)
+	if signature := decodeBody[types.SignatureResponse](t, responseRecorder); signature.Counter != 3 {
+		t.Errorf("expected the restored device to sign with counter 3, got %+v", signature)
+	}
+	responseRecorder = serveWithKey(target, testAdminKey, http.MethodGet, "/api/v1/devices/till-2/signatures", "")
+	if signatures := decodeBody[types.SignatureListResponse](t, responseRecorder); len(signatures.Signatures) != 3 {
+		t.Errorf("expected 3 restored signatures, got %+v", signatures)
+	}
+
+	check("restore after signing", serveWithKey(target, testAdminKey, http.MethodPut, "/api/v1/backup", backup),
+		http.StatusConflict, types.ErrorCodeCounterRollback)
+	responseRecorder = serveWithKey(source, testAdminKey, http.MethodPut, "/api/v1/backup", backup)
+	check("restore into the source", responseRecorder, http.StatusOK, "")
+	if summary := decodeBody[types.RestoreResponse](t, responseRecorder); summary.SkippedDevices != 3 || summary.Devices != 0 {
+		t.Errorf("expected the unchanged devices to be skipped, got %+v", summary)
+	}
+
+	tampered := []byte(backup)
+	tampered[len(tampered)/2] ^= 1
+	check("restore tampered", serveWithKey(newBackupTestHandler(t, key), testAdminKey, http.MethodPut, "/api/v1/backup", string(tampered)),
+		http.StatusBadRequest, types.ErrorCodeInvalidBackup)
+	otherKey := bytes.Repeat([]byte{2}, app.BackupKeySize)
+	check("restore other key", serveWithKey(newBackupTestHandler(t, otherKey), testAdminKey, http.MethodPut, "/api/v1/backup", backup),
+		http.StatusBadRequest, types.ErrorCodeInvalidBackup)
+}
+
+// TestBackupWhileSigning takes backups while devices sign. Every backup must restore, which
+// verifies that its chains are complete.
+func TestBackupWhileSigning(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, app.BackupKeySize)
+	handler := newBackupTestHandler(t, key)
+	devices := []string{"till-1", "till-2", "till-3"}
+	for _, id := range devices {
+		serveWithKey(handler, testAdminKey, http.MethodPost, "/api/v1/devices", fmt.Sprintf(`{"id": %q, "algorithm": "ECC"}`, id))
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range devices {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				serveWithKey(handler, testAdminKey, http.MethodPost, "/api/v1/devices/"+id+"/signatures", `{"data": "receipt"}`)
+			}
+		}(id)
+	}
+	var backups []string
+	for i := 0; i < 5; i++ {
+		responseRecorder := serveWithKey(handler, testAdminKey, http.MethodGet, "/api/v1/backup", "")
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("backup failed with %d: %s", responseRecorder.Code, responseRecorder.Body)
+		}
+		backups = append(backups, responseRecorder.Body.String())
+	}
+	wg.Wait()
+
+	for i, backup := range backups {
+		responseRecorder := serveWithKey(newBackupTestHandler(t, key), testAdminKey, http.MethodPut, "/api/v1/backup", backup)
+		if responseRecorder.Code != http.StatusOK {
+			t.Errorf("backup %d does not restore: %s", i, responseRecorder.Body)
+		}
+	}
+}
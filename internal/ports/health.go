@@ -0,0 +1,164 @@
+package ports
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+const (
+	healthPass = "pass"
+	healthWarn = "warn"
+	healthFail = "fail"
+
+	healthContentType = "application/health+json"
+
+	// healthCheckTimeout bounds each readiness check, a hanging dependency must not hang the probe.
+	healthCheckTimeout = 2 * time.Second
+	// certificateExpiryWarning is how long before expiry the certificate degrades readiness to warn.
+	certificateExpiryWarning = 14 * 24 * time.Hour
+)
+
+// HealthCheck probes a dependency for readiness, e.g. the storage backend.
+type HealthCheck struct {
+	Component     string // Name of the dependency, e.g. storage
+	ComponentType string // Kind of the dependency, e.g. datastore
+	Check         func(ctx context.Context) error
+}
+
+// WithHealthChecks adds dependencies that must be available for the server to be ready.
+func WithHealthChecks(checks ...HealthCheck) ServerOption {
+	return func(s *Server) {
+		s.healthChecks = append(s.healthChecks, checks...)
+	}
+}
+
+// LivenessHandler handles GET /livez. The process serves requests, nothing else is checked
+// so that a failing dependency does not get the service restarted.
+func (s *Server) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeHealth(w, types.HealthResponse{
+		Status:      healthPass,
+		ServiceID:   "signer",
+		Description: "liveness of the signature service",
+		Checks: map[string][]types.HealthCheckResult{
+			"uptime": {{
+				ComponentType: "system",
+				ObservedValue: time.Since(s.started).Seconds(),
+				ObservedUnit:  "s",
+				Status:        healthPass,
+				Time:          time.Now().UTC(),
+			}},
+		},
+	})
+}
+
+// ReadinessHandler handles GET /readyz. It reports every dependency and fails while the
+// server shuts down, so load balancers stop routing requests to it.
+func (s *Server) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	checks := make(map[string][]types.HealthCheckResult)
+
+	shutdown := types.HealthCheckResult{ComponentType: "system", Status: healthPass, Time: time.Now().UTC()}
+	if s.shuttingDown.Load() {
+		shutdown.Status, shutdown.Output = healthFail, "server is shutting down"
+	}
+	checks["server:shutdown"] = []types.HealthCheckResult{shutdown}
+
+	for _, check := range s.healthChecks {
+		checks[check.Component+":responseTime"] = []types.HealthCheckResult{runHealthCheck(r.Context(), check)}
+	}
+	if certificates := s.certificates.Load(); certificates != nil {
+		checks["tls:certificate"] = []types.HealthCheckResult{certificates.health()}
+	}
+
+	writeHealth(w, types.HealthResponse{
+		Status:      worstHealthStatus(checks),
+		ServiceID:   "signer",
+		Description: "readiness of the signature service",
+		Checks:      checks,
+	})
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) types.HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := types.HealthCheckResult{
+		ComponentType: check.ComponentType,
+		ObservedValue: float64(time.Since(start).Microseconds()) / 1000,
+		ObservedUnit:  "ms",
+		Status:        healthPass,
+		Time:          start.UTC(),
+	}
+	if err != nil {
+		result.Status, result.Output = healthFail, err.Error()
+	}
+	return result
+}
+
+// health reports the expiry of the served certificate.
+func (c *certificateReloader) health() types.HealthCheckResult {
+	c.mu.RLock()
+	leaf := c.certificate.Leaf
+	c.mu.RUnlock()
+
+	now := time.Now().UTC()
+	result := types.HealthCheckResult{ComponentType: "component", Status: healthPass, Time: now}
+	if leaf == nil {
+		return result
+	}
+	result.ObservedValue = leaf.NotAfter.UTC().Format(time.RFC3339)
+	switch {
+	case now.After(leaf.NotAfter):
+		result.Status, result.Output = healthFail, "certificate expired"
+	case now.Add(certificateExpiryWarning).After(leaf.NotAfter):
+		result.Status, result.Output = healthWarn, "certificate expires soon"
+	}
+	return result
+}
+
+func worstHealthStatus(checks map[string][]types.HealthCheckResult) string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := healthPass
+	for _, name := range names {
+		for _, result := range checks[name] {
+			switch {
+			case result.Status == healthFail:
+				return healthFail
+			case result.Status == healthWarn:
+				status = healthWarn
+			}
+		}
+	}
+	return status
+}
+
+// writeHealth answers 503 if the status is fail, a warning still counts as healthy.
+func writeHealth(w http.ResponseWriter, health types.HealthResponse) {
+	status := http.StatusOK
+	if health.Status == healthFail {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", healthContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,74 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestHealthProbes(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	appService := app.NewAPIService(storage.NewStorage())
+	var auditErr error
+	server := NewServer(loggerZap.Sugar(), appService, 8080, WithHealthChecks(
+		HealthCheck{Component: "storage", ComponentType: "datastore", Check: appService.Ping},
+		HealthCheck{Component: "auditLog", ComponentType: "component", Check: func(context.Context) error { return auditErr }},
+	))
+	handler := server.Handler()
+	document := openapi.MustLoad()
+
+	probe := func(path string, status int) types.HealthResponse {
+		t.Helper()
+		responseRecorder := serve(handler, http.MethodGet, path, "")
+		if responseRecorder.Code != status {
+			t.Fatalf("%s: got status %d want %d: %s", path, responseRecorder.Code, status, responseRecorder.Body)
+		}
+		if contentType := responseRecorder.Header().Get("Content-Type"); contentType != "application/health+json" {
+			t.Errorf("%s: unexpected content type %q", path, contentType)
+		}
+		_, operation, _ := document.FindOperation(http.MethodGet, path)
+		if err := document.ValidateResponse(operation, responseRecorder.Code, responseRecorder.Header(),
+			responseRecorder.Body.Bytes()); err != nil {
+			t.Errorf("%s: response does not match the specification: %v", path, err)
+		}
+		return decodeBody[types.HealthResponse](t, responseRecorder)
+	}
+
+	if health := probe("/livez", http.StatusOK); health.Status != "pass" {
+		t.Errorf("unexpected liveness %+v", health)
+	}
+
+	health := probe("/readyz", http.StatusOK)
+	for _, name := range []string{"server:shutdown", "storage:responseTime", "auditLog:responseTime"} {
+		if results := health.Checks[name]; len(results) != 1 || results[0].Status != "pass" {
+			t.Errorf("expected a passing check %s, got %+v", name, health.Checks)
+		}
+	}
+	if result := health.Checks["storage:responseTime"][0]; result.ComponentType != "datastore" || result.ObservedUnit != "ms" {
+		t.Errorf("unexpected storage check %+v", result)
+	}
+
+	// A failing dependency makes the service unready but keeps it alive
+	auditErr = errors.New("disk full")
+	health = probe("/readyz", http.StatusServiceUnavailable)
+	if result := health.Checks["auditLog:responseTime"][0]; health.Status != "fail" || result.Output != "disk full" {
+		t.Errorf("expected the audit log to fail readiness, got %+v", health)
+	}
+	probe("/livez", http.StatusOK)
+	auditErr = nil
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	health = probe("/readyz", http.StatusServiceUnavailable)
+	if result := health.Checks["server:shutdown"][0]; result.Status != "fail" {
+		t.Errorf("expected readiness to fail during shutdown, got %+v", result)
+	}
+}
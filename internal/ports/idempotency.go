@@ -0,0 +1,210 @@
+package ports
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotencyKeyTTL    = 24 * time.Hour
+	// maxIdempotencyKeys bounds the responses recorded per caller, the oldest is forgotten
+	// once a caller exceeds it
+	maxIdempotencyKeys = 10000
+)
+
+// idempotencyStore remembers responses of requests carrying an Idempotency-Key so that
+// clients can safely retry non-idempotent requests after a timeout or connection error.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	// Recorded entries in the order they expire, all are kept for idempotencyKeyTTL
+	expiries list.List
+	// Recorded entries of each caller, oldest first
+	byPrincipal map[string]*list.List
+}
+
+type idempotencyEntry struct {
+	key         string
+	principal   string
+	fingerprint [sha256.Size]byte
+	done        chan struct{} // closed once the response is recorded
+	response    *recordedResponse
+	expiresAt   time.Time
+	// Positions in expiries and byPrincipal once the response is recorded
+	expiry, recorded *list.Element
+}
+
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: make(map[string]*idempotencyEntry), byPrincipal: make(map[string]*list.List)}
+}
+
+// begin returns the entry for the key of principal and whether the caller is responsible
+// for executing the request. Expired entries are dropped on the way.
+func (s *idempotencyStore) begin(principal, key string, fingerprint [sha256.Size]byte) (*idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for oldest := s.expiries.Front(); oldest != nil; oldest = s.expiries.Front() {
+		entry := oldest.Value.(*idempotencyEntry)
+		if !now.After(entry.expiresAt) {
+			break
+		}
+		s.forget(entry)
+	}
+
+	if entry, ok := s.entries[key]; ok {
+		return entry, false
+	}
+	entry := &idempotencyEntry{key: key, principal: principal, fingerprint: fingerprint, done: make(chan struct{})}
+	s.entries[key] = entry
+	return entry, true
+}
+
+// finish records the response of an executed request. Server errors are not recorded so
+// that a retry executes the request again.
+func (s *idempotencyStore) finish(key string, entry *idempotencyEntry, response *recordedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response.status >= http.StatusInternalServerError {
+		delete(s.entries, key)
+		close(entry.done)
+		return
+	}
+	entry.response = response
+	entry.expiresAt = time.Now().Add(idempotencyKeyTTL)
+	entry.expiry = s.expiries.PushBack(entry)
+	recorded, ok := s.byPrincipal[entry.principal]
+	if !ok {
+		recorded = list.New()
+		s.byPrincipal[entry.principal] = recorded
+	}
+	entry.recorded = recorded.PushBack(entry)
+	if recorded.Len() > maxIdempotencyKeys {
+		s.forget(recorded.Front().Value.(*idempotencyEntry))
+	}
+	close(entry.done)
+}
+
+// forget drops a recorded entry, a later request with its key is executed again.
+func (s *idempotencyStore) forget(entry *idempotencyEntry) {
+	delete(s.entries, entry.key)
+	s.expiries.Remove(entry.expiry)
+	recorded := s.byPrincipal[entry.principal]
+	recorded.Remove(entry.recorded)
+	if recorded.Len() == 0 {
+		delete(s.byPrincipal, entry.principal)
+	}
+}
+
+// IdempotencyMiddleware replays the recorded response for a repeated POST or PATCH with the
+// same Idempotency-Key. Reusing a key with a different request body is rejected.
+func (s *Server) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped per caller so one API key can never replay the response of another
+		principal, _ := domain.PrincipalFromContext(r.Context())
+		scopedKey := principal.KeyID + " " + r.Method + " " + r.URL.Path + " " + key
+		fingerprint := sha256.Sum256(body)
+
+		for {
+			entry, execute := s.idempotency.begin(principal.KeyID, scopedKey, fingerprint)
+			if execute {
+				recorder := newResponseRecorder(w)
+				completed := false
+				defer func() {
+					response := recorder.recorded()
+					if !completed {
+						// The handler panicked, recorded as a server error a retry executes it again
+						response = &recordedResponse{status: http.StatusInternalServerError}
+					}
+					s.idempotency.finish(scopedKey, entry, response)
+				}()
+				next.ServeHTTP(recorder, r)
+				completed = true
+				return
+			}
+
+			if entry.fingerprint != fingerprint {
+				writeError(w, http.StatusUnprocessableEntity, types.ErrorCodeIdempotencyKeyReused,
+					"idempotency key was already used for a different request")
+				return
+			}
+
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			// A failed first attempt is not recorded, the next loop executes the request again
+			if entry.response == nil {
+				continue
+			}
+
+			for name, values := range entry.response.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.response.status)
+			w.Write(entry.response.body)
+			return
+		}
+	})
+}
+
+// responseRecorder passes a response through to the client while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) recorded() *recordedResponse {
+	return &recordedResponse{
+		status: r.status,
+		header: r.Header().Clone(),
+		body:   r.body.Bytes(),
+	}
+}
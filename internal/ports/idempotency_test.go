@@ -0,0 +1,79 @@
+package ports
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStoreBounds(t *testing.T) {
+	store := newIdempotencyStore()
+	record := func(principal, key string) {
+		entry, execute := store.begin(principal, key, sha256.Sum256(nil))
+		if !execute {
+			t.Fatalf("%s of %s must be executed", key, principal)
+		}
+		store.finish(key, entry, &recordedResponse{status: http.StatusCreated})
+	}
+
+	record("b", "b-key")
+	for i := 0; i <= maxIdempotencyKeys; i++ {
+		record("a", fmt.Sprintf("a-key-%d", i))
+	}
+	if len(store.entries) != maxIdempotencyKeys+1 || store.byPrincipal["a"].Len() != maxIdempotencyKeys {
+		t.Fatalf("expected %d keys of a and one of b, got %d in total", maxIdempotencyKeys, len(store.entries))
+	}
+	if _, execute := store.begin("a", "a-key-0", sha256.Sum256(nil)); !execute {
+		t.Error("the oldest key of a caller exceeding the limit must be forgotten")
+	}
+	if _, execute := store.begin("b", "b-key", sha256.Sum256(nil)); execute {
+		t.Error("other callers must keep their keys")
+	}
+
+	// Only expired entries are swept, the others stay in order
+	store.entries["b-key"].expiresAt = time.Now().Add(-time.Second)
+	if _, execute := store.begin("b", "b-key", sha256.Sum256(nil)); !execute {
+		t.Error("an expired key must be forgotten")
+	}
+	if _, ok := store.byPrincipal["b"]; ok || store.byPrincipal["a"].Len() != maxIdempotencyKeys {
+		t.Errorf("only the expired entry must be swept, %d entries of a left", store.byPrincipal["a"].Len())
+	}
+}
+
+func TestIdempotencyKeyReleasedAfterPanic(t *testing.T) {
+	server := &Server{idempotency: newIdempotencyStore()}
+	attempts := 0
+	handler := server.IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	request := func() *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"id": "till"}`))
+		request.Header.Set(idempotencyKeyHeader, "retry-after-panic")
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+		return responseRecorder
+	}
+
+	func() {
+		defer func() { recover() }()
+		request()
+	}()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- request() }()
+	select {
+	case responseRecorder := <-done:
+		if responseRecorder.Code != http.StatusCreated || attempts != 2 {
+			t.Errorf("the retry must execute the request again, got %d after %d attempts", responseRecorder.Code, attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the retry is blocked by the request that panicked")
+	}
+}
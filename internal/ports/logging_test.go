@@ -0,0 +1,64 @@
+package ports
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	handler := NewServer(zap.New(core).Sugar(), app.NewAPIService(storage.NewStorage()), 8080).Handler()
+	serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "logged", "algorithm": "ECC"}`)
+	logs.TakeAll()
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/devices/logged/signatures", strings.NewReader(`{"data": "receipt"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Request-ID", "till-7:receipt-42")
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("signing returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	if requestID := responseRecorder.Header().Get("X-Request-ID"); requestID != "till-7:receipt-42" {
+		t.Errorf("the request ID must be echoed, got %q", requestID)
+	}
+
+	// The service and the access log share the request ID
+	signed := logs.FilterMessage("Signed transaction").FilterField(zap.String("request_id", "till-7:receipt-42"))
+	if signed.Len() != 1 {
+		t.Errorf("expected the service log to carry the request ID, got %v", logs.All())
+	}
+	access := logs.FilterMessage("Handled request").FilterField(zap.String("request_id", "till-7:receipt-42")).All()
+	if len(access) != 1 {
+		t.Fatalf("expected one access log entry, got %v", logs.All())
+	}
+	fields := access[0].ContextMap()
+	if fields["status"] != int64(http.StatusCreated) || fields["device_id"] != "logged" ||
+		fields["route"] != "/api/v1/devices/{id}/signatures" || fields["method"] != http.MethodPost {
+		t.Errorf("unexpected access log fields %v", fields)
+	}
+
+	// Missing and malformed IDs are replaced by generated ones
+	for _, sent := range []string{"", "contains spaces", strings.Repeat("x", 200)} {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/devices/missing", nil)
+		request.Header.Set("X-Request-ID", sent)
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+
+		requestID := responseRecorder.Header().Get("X-Request-ID")
+		if requestID == "" || requestID == sent {
+			t.Errorf("expected a generated request ID for %q, got %q", sent, requestID)
+		}
+		if logs.FilterField(zap.String("request_id", requestID)).FilterField(zap.Int("status", http.StatusNotFound)).Len() != 1 {
+			t.Errorf("the access log must use the generated request ID %q", requestID)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ports
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithMetrics records request metrics and serves them on /metrics.
+func WithMetrics(m *metrics.Metrics) ServerOption {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// MetricsMiddleware records the count and latency of requests by method, route pattern and status.
+func (s *Server) MetricsMiddleware(next http.Handler) http.Handler {
+	if s.metrics == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		s.metrics.ObserveHTTPRequest(r.Method, routePattern(r), recorder.status, time.Since(start))
+	})
+}
+
+// statusRecorder remembers the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend write deadlines.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// rateLimitCollector exports the state of the rate limiter on every scrape.
+type rateLimitCollector struct {
+	limiter  *rateLimiter
+	requests *prometheus.Desc
+	buckets  *prometheus.Desc
+}
+
+func newRateLimitCollector(limiter *rateLimiter) *rateLimitCollector {
+	return &rateLimitCollector{
+		limiter: limiter,
+		requests: prometheus.NewDesc("signer_rate_limit_requests_total",
+			"Requests checked by the rate limiter by dimension and result.", []string{"dimension", "result"}, nil),
+		buckets: prometheus.NewDesc("signer_rate_limit_buckets",
+			"Token buckets currently tracked by dimension.", []string{"dimension"}, nil),
+	}
+}
+
+func (c *rateLimitCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.requests
+	descs <- c.buckets
+}
+
+func (c *rateLimitCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, stats := range c.limiter.stats() {
+		metrics <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(stats.Allowed), stats.Dimension, "allowed")
+		metrics <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(stats.Rejected), stats.Dimension, "rejected")
+		metrics <- prometheus.MustNewConstMetric(c.buckets, prometheus.GaugeValue, float64(stats.Buckets), stats.Dimension)
+	}
+}
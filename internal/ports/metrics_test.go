@@ -0,0 +1,53 @@
+package ports
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/metrics"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestMetrics(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	serviceMetrics := metrics.New()
+	appService := app.NewAPIService(storage.NewStorage(), app.WithObserver(serviceMetrics))
+	serviceMetrics.RegisterDeviceCount(func() int { return appService.CountDevices(context.Background()) })
+	handler := NewServer(loggerZap.Sugar(), appService, 8080, WithMetrics(serviceMetrics),
+		WithRateLimits(RateLimits{Device: RateLimit{Rate: 100, Burst: 100}})).Handler()
+
+	serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "metered", "algorithm": "ECC"}`)
+	serve(handler, http.MethodPost, "/api/v1/devices/metered/signatures", `{"data": "receipt"}`)
+	serve(handler, http.MethodPost, "/api/v0/sign-transaction", `{"deviceId": "metered", "data": "receipt"}`)
+	serve(handler, http.MethodGet, "/api/v1/devices/missing", "")
+	serve(handler, http.MethodGet, "/not/a/route", "")
+
+	responseRecorder := serve(handler, http.MethodGet, "/metrics", "")
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("metrics returned %d", responseRecorder.Code)
+	}
+	exposition := responseRecorder.Body.String()
+	for _, expected := range []string{
+		`signer_http_requests_total{method="POST",route="/api/v1/devices",status="201"} 1`,
+		`signer_http_requests_total{method="POST",route="/api/v1/devices/{id}/signatures",status="201"} 1`,
+		`signer_http_requests_total{method="POST",route="/api/v0/sign-transaction",status="200"} 1`,
+		`signer_http_requests_total{method="GET",route="/api/v1/devices/{id}",status="404"} 1`,
+		`signer_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`signer_http_request_duration_seconds_count{method="GET",route="/api/v1/devices/{id}",status="404"} 1`,
+		`signer_signing_duration_seconds_count{algorithm="ECC"} 2`,
+		`signer_key_generation_duration_seconds_count{algorithm="ECC"} 1`,
+		`signer_device_lock_wait_seconds_count 3`,
+		`signer_signatures_total{algorithm="ECC"} 2`,
+		`signer_devices 1`,
+		`signer_rate_limit_requests_total{dimension="device",result="allowed"} 3`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(exposition, expected) {
+			t.Errorf("metrics do not contain %s", expected)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Package openapi embeds the OpenAPI document of the signature service and validates
+// requests and responses against it.
+//
+// Only the subset of OpenAPI 3.0 used by the embedded document is supported: local
+// $ref, type, properties, required, additionalProperties, items, enum, minLength,
+// minimum and nullable.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the raw OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// Document is the parsed subset of an OpenAPI document needed for validation.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// PathItem holds the operations of a path template.
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+// Operations returns the operations of the path item keyed by HTTP method.
+func (p PathItem) Operations() map[string]*Operation {
+	operations := make(map[string]*Operation)
+	for method, operation := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodPatch:  p.Patch,
+		http.MethodDelete: p.Delete,
+	} {
+		if operation != nil {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+// Operation describes a single API operation.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// RequestBody describes the accepted request payload.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a documented response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes a response header.
+type Header struct {
+	Required bool `json:"required"`
+}
+
+// MediaType binds a schema to a content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema is the supported subset of an OpenAPI schema object.
+type Schema struct {
+	Ref                  string                `json:"$ref,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+	Format               string                `json:"format,omitempty"`
+	Nullable             bool                  `json:"nullable,omitempty"`
+	Enum                 []any                 `json:"enum,omitempty"`
+	MinLength            *int                  `json:"minLength,omitempty"`
+	Minimum              *float64              `json:"minimum,omitempty"`
+	Required             []string              `json:"required,omitempty"`
+	Properties           map[string]*Schema    `json:"properties,omitempty"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties,omitempty"`
+	Items                *Schema               `json:"items,omitempty"`
+}
+
+// AdditionalProperties is either a boolean or a schema for undeclared object properties.
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// Load parses the embedded OpenAPI document.
+func Load() (*Document, error) {
+	var document Document
+	if err := json.Unmarshal(spec, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	return &document, nil
+}
+
+// MustLoad is like Load but panics if the embedded document is invalid.
+func MustLoad() *Document {
+	document, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return document
+}
+
+// FindOperation returns the path template and operation matching a request. If the path
+// matches several templates the one with the fewest parameters wins. The boolean is false
+// if no operation is documented for the method and path.
+func (d *Document) FindOperation(method, path string) (string, *Operation, bool) {
+	templates := make([]string, 0, len(d.Paths))
+	for template := range d.Paths {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return strings.Count(templates[i], "{") < strings.Count(templates[j], "{")
+	})
+
+	for _, template := range templates {
+		if !matchTemplate(template, path) {
+			continue
+		}
+		if operation, ok := d.Paths[template].Operations()[method]; ok {
+			return template, operation, true
+		}
+	}
+	return "", nil, false
+}
+
+// ValidateRequest validates a request body against the operation's JSON request schema.
+func (d *Document) ValidateRequest(operation *Operation, body []byte) error {
+	if operation.RequestBody == nil {
+		return nil
+	}
+	if len(body) == 0 {
+		if operation.RequestBody.Required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+
+	mediaType, ok := operation.RequestBody.Content["application/json"]
+	if !ok || mediaType.Schema == nil {
+		return nil
+	}
+	return d.validateJSON(mediaType.Schema, body)
+}
+
+// ValidateResponse checks that the status code is documented for the operation, that
+// required headers are present and that a JSON body matches the documented schema.
+func (d *Document) ValidateResponse(operation *Operation, status int, header http.Header, body []byte) error {
+	response, ok := operation.Responses[fmt.Sprint(status)]
+	if !ok {
+		response, ok = operation.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+
+	for name, documented := range response.Headers {
+		if documented.Required && header.Get(name) == "" {
+			return fmt.Errorf("status %d: required header %s is missing", status, name)
+		}
+	}
+
+	if len(response.Content) == 0 {
+		return nil
+	}
+	contentType := strings.TrimSpace(strings.Split(header.Get("Content-Type"), ";")[0])
+	mediaType, ok := response.Content[contentType]
+	if !ok {
+		return fmt.Errorf("status %d: content type %q is not documented", status, contentType)
+	}
+	// Structured suffixes, e.g. application/health+json, are JSON as well
+	if (contentType != "application/json" && !strings.HasSuffix(contentType, "+json")) || mediaType.Schema == nil {
+		return nil
+	}
+	return d.validateJSON(mediaType.Schema, body)
+}
+
+func (d *Document) validateJSON(schema *Schema, body []byte) error {
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return d.validateValue(schema, value, "body")
+}
+
+func (d *Document) resolve(schema *Schema) (*Schema, error) {
+	for schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved schema reference %q", schema.Ref)
+		}
+		schema = resolved
+	}
+	return schema, nil
+}
+
+func (d *Document) validateValue(schema *Schema, value any, location string) error {
+	schema, err := d.resolve(schema)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: must not be null", location)
+	}
+
+	if len(schema.Enum) > 0 && !containsValue(schema.Enum, value) {
+		return fmt.Errorf("%s: must be one of %v", location, schema.Enum)
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		return d.validateObject(schema, value, location)
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an array", location)
+		}
+		if schema.Items == nil {
+			return nil
+		}
+		for i, item := range items {
+			if err := d.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", location, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", location)
+		}
+		if schema.MinLength != nil && len(text) < *schema.MinLength {
+			return fmt.Errorf("%s: must be at least %d characters long", location, *schema.MinLength)
+		}
+		return nil
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: must be a %s", location, schema.Type)
+		}
+		if schema.Type == "integer" {
+			if _, err := number.Int64(); err != nil {
+				return fmt.Errorf("%s: must be an integer", location)
+			}
+		}
+		parsed, err := number.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: must be a number", location)
+		}
+		if schema.Minimum != nil && parsed < *schema.Minimum {
+			return fmt.Errorf("%s: must be at least %v", location, *schema.Minimum)
+		}
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: must be a boolean", location)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", location, schema.Type)
+	}
+}
+
+func (d *Document) validateObject(schema *Schema, value any, location string) error {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: must be an object", location)
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s: property %q is required", location, name)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyLocation := location + "." + name
+		if property, ok := schema.Properties[name]; ok {
+			if err := d.validateValue(property, object[name], propertyLocation); err != nil {
+				return err
+			}
+			continue
+		}
+
+		additional := schema.AdditionalProperties
+		switch {
+		case additional == nil:
+		case !additional.Allowed:
+			return fmt.Errorf("%s: unknown property", propertyLocation)
+		case additional.Schema != nil:
+			if err := d.validateValue(additional.Schema, object[name], propertyLocation); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTemplate(template, path string) bool {
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(templateSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range templateSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
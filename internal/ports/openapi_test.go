@@ -0,0 +1,133 @@
+package ports
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+// TestOpenAPIRoutesMatchSpec fails if a v1 route is added without documenting it or the
+// document describes an operation that is not served.
+func TestOpenAPIRoutesMatchSpec(t *testing.T) {
+	document := openapi.MustLoad()
+	loggerZap, _ := zap.NewDevelopment()
+	server := NewServer(loggerZap.Sugar(), app.NewAPIService(storage.NewStorage()), 8080)
+
+	served := make(map[string]bool)
+	routes := append(server.v1Routes(), server.apiKeyRoutes()...)
+	for _, rte := range append(routes, server.backupRoutes()...) {
+		served[rte.method+" "+rte.pattern] = true
+		pathItem, ok := document.Paths[rte.pattern]
+		if !ok {
+			t.Errorf("route %s %s is not documented", rte.method, rte.pattern)
+			continue
+		}
+		if _, ok := pathItem.Operations()[rte.method]; !ok {
+			t.Errorf("route %s %s is not documented", rte.method, rte.pattern)
+		}
+	}
+
+	for template, pathItem := range document.Paths {
+		if !strings.HasPrefix(template, apiV1Prefix) {
+			continue
+		}
+		for method := range pathItem.Operations() {
+			if !served[method+" "+template] {
+				t.Errorf("documented operation %s %s is not served", method, template)
+			}
+		}
+	}
+}
+
+// TestOpenAPIContract runs requests through the full handler and checks every response
+// against the document, so handler behaviour and specification cannot drift apart.
+func TestOpenAPIContract(t *testing.T) {
+	document := openapi.MustLoad()
+	handler := newTestHandler()
+
+	steps := []struct {
+		method string
+		path   string
+		header map[string]string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/api/openapi.json", nil, "", http.StatusOK},
+		{http.MethodGet, "/api/v0/health", nil, "", http.StatusOK},
+		{http.MethodPost, "/api/v1/devices", nil, `{"id": "contract", "algorithm": "ECC", "metadata": {"till": "1"}}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/devices", nil, `{"id": "contract", "algorithm": "ECC"}`, http.StatusConflict},
+		{http.MethodPost, "/api/v1/devices", nil, `{"id": "other", "algorithm": "DSA"}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/devices", nil, "", http.StatusOK},
+		{http.MethodGet, "/api/v1/devices/contract", nil, "", http.StatusOK},
+		{http.MethodGet, "/api/v1/devices/missing", nil, "", http.StatusNotFound},
+		{http.MethodPatch, "/api/v1/devices/contract", map[string]string{"If-Match": `"1"`}, `{"label": "Till 1"}`, http.StatusOK},
+		{http.MethodPatch, "/api/v1/devices/contract", map[string]string{"If-Match": `"1"`}, `{"label": "stale"}`, http.StatusPreconditionFailed},
+		{http.MethodPatch, "/api/v1/devices/contract", nil, `{"label": "unconditional"}`, http.StatusPreconditionRequired},
+		{http.MethodPatch, "/api/v1/devices/missing", nil, `{"label": "x", "version": 1}`, http.StatusNotFound},
+		{http.MethodPost, "/api/v1/devices/contract/signatures", nil, `{"data": "receipt"}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/devices/contract/signatures", nil, `{}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/devices/missing/signatures", nil, `{"data": "receipt"}`, http.StatusNotFound},
+		{http.MethodGet, "/api/v1/devices/contract/signatures", nil, "", http.StatusOK},
+		{http.MethodGet, "/api/v1/devices/contract/signatures/0", nil, "", http.StatusOK},
+		{http.MethodGet, "/api/v1/devices/contract/signatures/1", nil, "", http.StatusNotFound},
+		{http.MethodPost, "/api/v0/create-device", nil, `{"id": "contract-v0", "algorithm": "ECC"}`, http.StatusOK},
+		{http.MethodPost, "/api/v0/create-device", nil, `{"id": "", "algorithm": "ECC"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v0/sign-transaction", nil, `{"deviceId": "contract-v0", "data": "receipt"}`, http.StatusOK},
+		{http.MethodPost, "/api/v0/sign-transaction", nil, `{"deviceId": "missing", "data": "receipt"}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/v0/devices/contract-v0", map[string]string{"If-Match": `"1"`}, `{"label": "v0"}`, http.StatusOK},
+	}
+
+	for _, step := range steps {
+		request := httptest.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+		for name, value := range step.header {
+			request.Header.Set(name, value)
+		}
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != step.status {
+			t.Errorf("%s %s: got status %d want %d: %s", step.method, step.path,
+				responseRecorder.Code, step.status, responseRecorder.Body)
+			continue
+		}
+
+		_, operation, ok := document.FindOperation(step.method, step.path)
+		if !ok {
+			t.Errorf("%s %s is not documented", step.method, step.path)
+			continue
+		}
+		if err := document.ValidateResponse(operation, responseRecorder.Code, responseRecorder.Header(),
+			responseRecorder.Body.Bytes()); err != nil {
+			t.Errorf("%s %s: response does not match the specification: %v", step.method, step.path, err)
+		}
+	}
+}
+
+func TestValidationMiddleware(t *testing.T) {
+	handler := newTestHandler()
+
+	for name, body := range map[string]string{
+		"unknown property": `{"id": "device", "algorithm": "ECC", "owner": "me"}`,
+		"wrong type":       `{"id": 1, "algorithm": "ECC"}`,
+		"missing property": `{"algorithm": "ECC"}`,
+		"invalid metadata": `{"id": "device", "algorithm": "ECC", "metadata": {"till": 3}}`,
+		"empty body":       ``,
+	} {
+		responseRecorder := serve(handler, http.MethodPost, "/api/v1/devices", body)
+		if status := responseRecorder.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: got status %d want %d", name, status, http.StatusBadRequest)
+			continue
+		}
+		if response := decodeBody[types.ErrorResponse](t, responseRecorder); response.Error.Code != types.ErrorCodeInvalidRequest {
+			t.Errorf("%s: unexpected error code %q", name, response.Error.Code)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package ports
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTTL is how long the bucket of an inactive key is kept. Any bucket idle
+// for longer than burst/rate seconds is full again, so dropping it changes nothing.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// RateLimit configures a token bucket refilled with Rate tokens per second up to Burst.
+// A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits configures the buckets a request takes a token from. Every tenant, API key
+// and device has its own bucket.
+type RateLimits struct {
+	Tenant RateLimit
+	APIKey RateLimit
+	Device RateLimit
+}
+
+// WithRateLimits rejects requests exceeding the limits with 429 Too Many Requests.
+func WithRateLimits(limits RateLimits) ServerOption {
+	return func(s *Server) {
+		s.rateLimiter.setLimits(limits)
+	}
+}
+
+// SetRateLimits replaces the limits of a running server. Tracked buckets keep their tokens
+// and counters, they are refilled at the new rate up to the new burst.
+func (s *Server) SetRateLimits(limits RateLimits) {
+	s.rateLimiter.setLimits(limits)
+}
+
+// RateLimiterStats describes the state of the buckets of one dimension.
+type RateLimiterStats struct {
+	Dimension string // tenant, api_key or device
+	Allowed   uint64 // Requests that took a token
+	Rejected  uint64 // Requests rejected for lack of a token
+	Buckets   int    // Keys currently tracked
+}
+
+type rateLimiter struct {
+	mu         sync.RWMutex // Held for writing while the limits change
+	dimensions []*limiterDimension
+}
+
+type limiterDimension struct {
+	name  string
+	limit RateLimit // A zero Rate disables the dimension
+
+	mu        sync.Mutex
+	buckets   map[string]*limiterBucket
+	allowed   uint64
+	rejected  uint64
+	lastSweep time.Time
+}
+
+type limiterBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	limiter := &rateLimiter{}
+	for _, name := range []string{"tenant", "api_key", "device"} {
+		limiter.dimensions = append(limiter.dimensions, &limiterDimension{
+			name:    name,
+			buckets: make(map[string]*limiterBucket),
+		})
+	}
+	limiter.setLimits(limits)
+	return limiter
+}
+
+// setLimits changes the limits in place. Buckets of disabled dimensions are dropped.
+func (l *rateLimiter) setLimits(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for i, limit := range []RateLimit{limits.Tenant, limits.APIKey, limits.Device} {
+		dimension := l.dimensions[i]
+		dimension.mu.Lock()
+		dimension.limit = limit
+		for key, bucket := range dimension.buckets {
+			if !dimension.enabled() {
+				delete(dimension.buckets, key)
+				continue
+			}
+			bucket.limiter.SetLimitAt(now, rate.Limit(limit.Rate))
+			bucket.limiter.SetBurstAt(now, limit.Burst)
+		}
+		dimension.mu.Unlock()
+	}
+}
+
+// reserve takes a token from the bucket of every dimension with a key. If any bucket is
+// empty no token is taken and the time until a retry can succeed is returned.
+func (l *rateLimiter) reserve(keys map[string]string, now time.Time) (time.Duration, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var (
+		reservations []*rate.Reservation
+		rejectedBy   []*limiterDimension
+		retryAfter   time.Duration
+	)
+	for _, dimension := range l.dimensions {
+		key := keys[dimension.name]
+		if key == "" || !dimension.enabled() {
+			continue
+		}
+		reservation := dimension.bucket(key, now).ReserveN(now, 1)
+		reservations = append(reservations, reservation)
+		if !reservation.OK() {
+			// The burst is below one token, requests can never pass
+			rejectedBy = append(rejectedBy, dimension)
+			retryAfter = time.Hour
+			continue
+		}
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			rejectedBy = append(rejectedBy, dimension)
+			retryAfter = max(retryAfter, delay)
+		}
+	}
+
+	if len(rejectedBy) == 0 {
+		for _, dimension := range l.dimensions {
+			if keys[dimension.name] != "" && dimension.enabled() {
+				dimension.count(true)
+			}
+		}
+		return 0, true
+	}
+	for _, reservation := range reservations {
+		reservation.CancelAt(now)
+	}
+	for _, dimension := range rejectedBy {
+		dimension.count(false)
+	}
+	return retryAfter, false
+}
+
+// enabled reports whether the rate limiter checks any dimension.
+func (l *rateLimiter) enabled() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, dimension := range l.dimensions {
+		if dimension.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// stats describes the enabled dimensions.
+func (l *rateLimiter) stats() []RateLimiterStats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	stats := make([]RateLimiterStats, 0, len(l.dimensions))
+	for _, dimension := range l.dimensions {
+		if !dimension.enabled() {
+			continue
+		}
+		dimension.mu.Lock()
+		stats = append(stats, RateLimiterStats{
+			Dimension: dimension.name,
+			Allowed:   dimension.allowed,
+			Rejected:  dimension.rejected,
+			Buckets:   len(dimension.buckets),
+		})
+		dimension.mu.Unlock()
+	}
+	return stats
+}
+
+// enabled reports whether the dimension limits requests. The caller holds the lock of the
+// rate limiter, which guards the limit.
+func (d *limiterDimension) enabled() bool {
+	return d.limit.Rate > 0
+}
+
+// bucket returns the limiter of a key, dropping idle buckets at most once per TTL.
+func (d *limiterDimension) bucket(key string, now time.Time) *rate.Limiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastSweep) > rateLimiterIdleTTL {
+		for storedKey, bucket := range d.buckets {
+			if now.Sub(bucket.lastSeen) > rateLimiterIdleTTL {
+				delete(d.buckets, storedKey)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	bucket, ok := d.buckets[key]
+	if !ok {
+		bucket = &limiterBucket{limiter: rate.NewLimiter(rate.Limit(d.limit.Rate), d.limit.Burst)}
+		d.buckets[key] = bucket
+	}
+	bucket.lastSeen = now
+	return bucket.limiter
+}
+
+func (d *limiterDimension) count(allowed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if allowed {
+		d.allowed++
+	} else {
+		d.rejected++
+	}
+}
+
+// RateLimitStats returns the state of the rate limiter, or nil if rate limiting is disabled.
+func (s *Server) RateLimitStats() []RateLimiterStats {
+	if !s.rateLimiter.enabled() {
+		return nil
+	}
+	return s.rateLimiter.stats()
+}
+
+// rateLimit rejects requests once the tenant, API key or device of the request ran out of
+// tokens. deviceID extracts the device a request addresses and may be nil, the device is
+// also recorded for the access log.
+func (s *Server) rateLimit(deviceID func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var device string
+		if deviceID != nil {
+			device = deviceID(r)
+			setRequestDevice(r, device)
+		}
+		tenantID := domain.TenantFromContext(r.Context())
+		principal, _ := domain.PrincipalFromContext(r.Context())
+		keys := map[string]string{
+			"tenant":  tenantID,
+			"api_key": principal.KeyID,
+		}
+		if device != "" {
+			keys["device"] = tenantID + "/" + device
+		}
+
+		retryAfter, ok := s.rateLimiter.reserve(keys, time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, types.ErrorCodeRateLimited, "rate limit exceeded, retry later")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// devicePathParam returns the device ID of v1 routes below /devices/{id}.
+func devicePathParam(r *http.Request) string {
+	return pathParam(r, "id")
+}
+
+// v0DevicePath returns the device ID of /api/v0/devices/{id}.
+func v0DevicePath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/api/v0/devices/")
+}
+
+// v0DeviceBody returns the deviceId field of a v0 request body, leaving the body readable.
+func v0DeviceBody(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+	if err != nil {
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var request struct {
+		DeviceID string `json:"deviceId"`
+	}
+	json.Unmarshal(body, &request)
+	return request.DeviceID
+}
@@ -0,0 +1,154 @@
+package ports
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestRateLimiting(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	stor := storage.NewStorage()
+	keys := app.NewKeyService(stor, []domain.APIKey{
+		{ID: "a", TenantID: "tenant-a", Hash: app.HashAPIKey("key-a"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+		{ID: "b", TenantID: "tenant-b", Hash: app.HashAPIKey("key-b"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+	})
+	server := NewServer(loggerZap.Sugar(), app.NewAPIService(stor), 8080, WithAPIKeys(keys),
+		WithRateLimits(RateLimits{
+			Tenant: RateLimit{Rate: 0.001, Burst: 6},
+			Device: RateLimit{Rate: 0.001, Burst: 2},
+		}))
+	handler := server.Handler()
+	document := openapi.MustLoad()
+
+	for _, id := range []string{"busy", "quiet"} {
+		if responseRecorder := serveWithKey(handler, "key-a", http.MethodPost, "/api/v1/devices",
+			`{"id": "`+id+`", "algorithm": "ECC"}`); responseRecorder.Code != http.StatusCreated {
+			t.Fatalf("creating the device returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if responseRecorder := serveWithKey(handler, "key-a", http.MethodPost, "/api/v1/devices/busy/signatures",
+			`{"data": "receipt"}`); responseRecorder.Code != http.StatusCreated {
+			t.Fatalf("signature %d returned %d: %s", i, responseRecorder.Code, responseRecorder.Body)
+		}
+	}
+
+	// The device is exhausted, the v0 API shares its bucket
+	for _, step := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/v1/devices/busy/signatures", `{"data": "receipt"}`},
+		{http.MethodPost, "/api/v0/sign-transaction", `{"deviceId": "busy", "data": "receipt"}`},
+	} {
+		responseRecorder := serveWithKey(handler, "key-a", step.method, step.path, step.body)
+		if responseRecorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s %s: got status %d want %d", step.method, step.path, responseRecorder.Code, http.StatusTooManyRequests)
+		}
+		if retryAfter := responseRecorder.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+			t.Errorf("unexpected Retry-After header %q", retryAfter)
+		}
+		if body := decodeBody[types.ErrorResponse](t, responseRecorder); body.Error.Code != types.ErrorCodeRateLimited {
+			t.Errorf("unexpected error code %q", body.Error.Code)
+		}
+		if _, operation, ok := document.FindOperation(step.method, step.path); ok {
+			if err := document.ValidateResponse(operation, responseRecorder.Code, responseRecorder.Header(),
+				responseRecorder.Body.Bytes()); err != nil {
+				t.Errorf("response does not match the specification: %v", err)
+			}
+		}
+	}
+
+	// Other devices of the tenant keep working until the tenant runs out
+	if responseRecorder := serveWithKey(handler, "key-a", http.MethodPost, "/api/v1/devices/quiet/signatures",
+		`{"data": "receipt"}`); responseRecorder.Code != http.StatusCreated {
+		t.Errorf("signing with another device returned %d", responseRecorder.Code)
+	}
+	if responseRecorder := serveWithKey(handler, "key-a", http.MethodGet, "/api/v1/devices", ""); responseRecorder.Code != http.StatusOK {
+		t.Errorf("listing devices returned %d", responseRecorder.Code)
+	}
+	if responseRecorder := serveWithKey(handler, "key-a", http.MethodGet, "/api/v1/devices", ""); responseRecorder.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the tenant to be exhausted, got %d", responseRecorder.Code)
+	}
+	if responseRecorder := serveWithKey(handler, "key-b", http.MethodGet, "/api/v1/devices", ""); responseRecorder.Code != http.StatusOK {
+		t.Errorf("other tenants must not be limited, got %d", responseRecorder.Code)
+	}
+
+	stats := server.RateLimitStats()
+	if len(stats) != 2 || stats[0].Dimension != "tenant" || stats[1].Dimension != "device" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats[0].Allowed != 7 || stats[0].Rejected != 1 || stats[0].Buckets != 2 {
+		t.Errorf("unexpected tenant stats: %+v", stats[0])
+	}
+	if stats[1].Allowed != 3 || stats[1].Rejected != 2 || stats[1].Buckets != 2 {
+		t.Errorf("unexpected device stats: %+v", stats[1])
+	}
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	limiter := newRateLimiter(RateLimits{APIKey: RateLimit{Rate: 0.5, Burst: 1}})
+	now := time.Now()
+
+	if _, ok := limiter.reserve(map[string]string{"api_key": "key"}, now); !ok {
+		t.Fatal("the first request must pass")
+	}
+	retryAfter, ok := limiter.reserve(map[string]string{"api_key": "key"}, now)
+	if ok || retryAfter != 2*time.Second {
+		t.Errorf("expected a retry after 2s, got %s, %t", retryAfter, ok)
+	}
+	// The rejected request must not have consumed the next token
+	if _, ok := limiter.reserve(map[string]string{"api_key": "key"}, now.Add(2*time.Second)); !ok {
+		t.Error("the request must pass once the token is refilled")
+	}
+}
+
+func TestSetRateLimits(t *testing.T) {
+	loggerZap, _ := zap.NewDevelopment()
+	server := NewServer(loggerZap.Sugar(), app.NewAPIService(storage.NewStorage()), 8080)
+	handler := server.Handler()
+
+	if stats := server.RateLimitStats(); stats != nil {
+		t.Fatalf("rate limiting must be disabled without limits, got %+v", stats)
+	}
+	list := func() int {
+		return serve(handler, http.MethodGet, "/api/v1/devices", "").Code
+	}
+	for i := 0; i < 3; i++ {
+		if status := list(); status != http.StatusOK {
+			t.Fatalf("request %d returned %d", i, status)
+		}
+	}
+
+	server.SetRateLimits(RateLimits{Tenant: RateLimit{Rate: 0.001, Burst: 2}})
+	for i := 0; i < 2; i++ {
+		if status := list(); status != http.StatusOK {
+			t.Fatalf("request %d within the new burst returned %d", i, status)
+		}
+	}
+	if status := list(); status != http.StatusTooManyRequests {
+		t.Errorf("expected the new limit to apply, got %d", status)
+	}
+
+	// Raising the burst lets the tracked bucket grow without resetting its counters
+	server.SetRateLimits(RateLimits{Tenant: RateLimit{Rate: 1000, Burst: 5}})
+	time.Sleep(10 * time.Millisecond)
+	if status := list(); status != http.StatusOK {
+		t.Errorf("expected the raised limit to apply, got %d", status)
+	}
+	stats := server.RateLimitStats()
+	if len(stats) != 1 || stats[0].Allowed != 3 || stats[0].Rejected != 1 || stats[0].Buckets != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	server.SetRateLimits(RateLimits{})
+	if stats := server.RateLimitStats(); stats != nil {
+		t.Errorf("removing the limits must disable rate limiting, got %+v", stats)
+	}
+}
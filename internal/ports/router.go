@@ -0,0 +1,138 @@
+package ports
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths cannot inflate label cardinality.
+const unmatchedRoute = "unmatched"
+
+type pathParamsKey struct{}
+
+type requestInfoKey struct{}
+
+// requestInfo collects what the handlers learn about a request for the access log, metrics
+// and traces, which only read it after the handler returned.
+type requestInfo struct {
+	route    string
+	deviceID string
+}
+
+// route binds a handler to a method and a path pattern. Pattern segments in braces,
+// e.g. /api/v1/devices/{id}, match any single non-empty segment. Callers need the scope
+// to be allowed to use the route.
+type route struct {
+	method  string
+	pattern string
+	scope   domain.Scope
+	handler http.HandlerFunc
+}
+
+// router dispatches requests by method and path pattern. Unlike http.ServeMux it
+// answers with 405 and an Allow header if the path exists but the method does not.
+type router struct {
+	routes           []route
+	notFound         http.HandlerFunc
+	methodNotAllowed func(w http.ResponseWriter, r *http.Request, allowed []string)
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, rte := range rt.routes {
+		params, ok := matchPattern(rte.pattern, r.URL.Path)
+		if !ok {
+			continue
+		}
+		if rte.method != r.Method {
+			allowed = append(allowed, rte.method)
+			continue
+		}
+		setRoutePattern(r, rte.pattern)
+		ctx := context.WithValue(r.Context(), pathParamsKey{}, params)
+		rte.handler(w, r.WithContext(ctx))
+		return
+	}
+
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		rt.methodNotAllowed(w, r, allowed)
+		return
+	}
+	rt.notFound(w, r)
+}
+
+// routeMiddleware resolves the route pattern of a request for logs, metrics and traces. It
+// starts with the pattern of the mux, the v1 router refines it once it matched a route.
+func routeMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &requestInfo{route: unmatchedRoute}
+		if _, pattern := mux.Handler(r); pattern != "" {
+			info.route = pattern
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+	})
+}
+
+func setRoutePattern(r *http.Request, pattern string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.route = pattern
+	}
+}
+
+// routePattern returns the pattern of the route handling the request. Read it after the
+// handler returned, the v1 router only knows it once it matched.
+func routePattern(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.route
+	}
+	return unmatchedRoute
+}
+
+func setRequestDevice(r *http.Request, deviceID string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.deviceID = deviceID
+	}
+}
+
+// requestDevice returns the ID of the device the request addressed, if any.
+func requestDevice(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.deviceID
+	}
+	return ""
+}
+
+// pathParam returns the value of a named pattern segment of the matched route.
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
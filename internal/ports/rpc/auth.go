@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	signerv1 "github.com/ashermp9/fiskaly-test-task/api/signer/v1"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes maps every RPC to the scope it requires. RPCs missing here are rejected.
+var methodScopes = map[string]domain.Scope{
+	signerv1.SignatureService_CreateDevice_FullMethodName:    domain.ScopeDevicesWrite,
+	signerv1.SignatureService_GetDevice_FullMethodName:       domain.ScopeDevicesRead,
+	signerv1.SignatureService_ListDevices_FullMethodName:     domain.ScopeDevicesRead,
+	signerv1.SignatureService_SignTransaction_FullMethodName: domain.ScopeSign,
+	signerv1.SignatureService_WatchSignatures_FullMethodName: domain.ScopeDevicesRead,
+}
+
+func (s *Server) authUnaryInterceptor(
+	ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (any, error) {
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+func (s *Server) authStreamInterceptor(
+	server any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	ctx, err := s.authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(server, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// authorize authenticates the API key sent in the authorization or x-api-key metadata and
+// checks the scope of the method. The returned context carries the principal.
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	if s.keys == nil {
+		return ctx, nil
+	}
+
+	principal, err := s.keys.Authenticate(ctx, apiKeyFromMetadata(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	scope, ok := methodScopes[method]
+	if !ok || !principal.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "API key lacks the %s scope", scope)
+	}
+	return domain.ContextWithPrincipal(ctx, principal), nil
+}
+
+func apiKeyFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		scheme, token, found := strings.Cut(values[0], " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// contextStream replaces the context of a stream, e.g. with one carrying the principal.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,295 @@
+// Package rpc exposes the APIService over gRPC next to the HTTP API in package ports.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	signerv1 "github.com/ashermp9/fiskaly-test-task/api/signer/v1"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/logging"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const requestIDMetadata = "x-request-id"
+
+type Server struct {
+	signerv1.UnimplementedSignatureServiceServer
+
+	logger        *zap.SugaredLogger
+	APIService    *app.APIService
+	server        *grpc.Server
+	listenAddress int
+	host          string
+	keys          *app.KeyService
+}
+
+// ServerOption configures optional features of a Server.
+type ServerOption func(*Server)
+
+// WithAPIKeys enables API key authentication. Without it every RPC is allowed.
+func WithAPIKeys(keys *app.KeyService) ServerOption {
+	return func(s *Server) {
+		s.keys = keys
+	}
+}
+
+// WithHost listens on a single interface instead of all.
+func WithHost(host string) ServerOption {
+	return func(s *Server) {
+		s.host = host
+	}
+}
+
+func NewServer(logger *zap.SugaredLogger, appService *app.APIService, listenAddress int, options ...ServerOption) *Server {
+	s := &Server{
+		APIService:    appService,
+		listenAddress: listenAddress,
+		logger:        logger,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.loggingUnaryInterceptor, s.authUnaryInterceptor),
+		grpc.ChainStreamInterceptor(s.loggingStreamInterceptor, s.authStreamInterceptor),
+	)
+	signerv1.RegisterSignatureServiceServer(s.server, s)
+	return s
+}
+
+// Run listens on the configured port and serves until Shutdown is called.
+func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.host, strconv.Itoa(s.listenAddress)))
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on an existing listener.
+func (s *Server) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Shutdown stops accepting new RPCs and waits for running ones until the context is done,
+// after which all remaining RPCs, including open watch streams, are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) CreateDevice(ctx context.Context, request *signerv1.CreateDeviceRequest) (*signerv1.Device, error) {
+	createDeviceRequest := types.CreateDeviceRequest{
+		ID:        request.GetId(),
+		Algorithm: algorithmFromProto(request.GetAlgorithm()),
+		Label:     request.GetLabel(),
+		Metadata:  request.GetMetadata(),
+	}
+	if err := createDeviceRequest.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	device, err := s.APIService.CreateDevice(ctx, types.ConvertToDomainCreateDeviceRequest(createDeviceRequest))
+	if err != nil {
+		return nil, s.statusFromError(err)
+	}
+	return deviceToProto(device), nil
+}
+
+func (s *Server) GetDevice(ctx context.Context, request *signerv1.GetDeviceRequest) (*signerv1.Device, error) {
+	device, err := s.APIService.GetDevice(ctx, request.GetId())
+	if err != nil {
+		return nil, s.statusFromError(err)
+	}
+	return deviceToProto(device), nil
+}
+
+func (s *Server) ListDevices(ctx context.Context, _ *signerv1.ListDevicesRequest) (*signerv1.ListDevicesResponse, error) {
+	devices, err := s.APIService.ListDevices(ctx)
+	if err != nil {
+		return nil, s.statusFromError(err)
+	}
+	response := &signerv1.ListDevicesResponse{Devices: make([]*signerv1.Device, 0, len(devices))}
+	for _, device := range devices {
+		response.Devices = append(response.Devices, deviceToProto(device))
+	}
+	return response, nil
+}
+
+func (s *Server) SignTransaction(ctx context.Context, request *signerv1.SignTransactionRequest) (*signerv1.Signature, error) {
+	signRequest := types.SignTransactionRequest{
+		DeviceID: request.GetDeviceId(),
+		Data:     request.GetData(),
+	}
+	if err := signRequest.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	signature, err := s.APIService.SignTransaction(ctx, types.ConvertToDomainSignTransactionRequest(signRequest))
+	if err != nil {
+		return nil, s.statusFromError(err)
+	}
+
+	transaction, err := s.APIService.GetTransaction(ctx, request.GetDeviceId(), signature.Counter)
+	if err != nil {
+		return nil, s.statusFromError(err)
+	}
+	return transactionToProto(transaction), nil
+}
+
+// WatchSignatures streams signatures until the client cancels, the server shuts down or
+// the client falls too far behind, in which case the stream ends with ResourceExhausted.
+func (s *Server) WatchSignatures(
+	request *signerv1.WatchSignaturesRequest, stream signerv1.SignatureService_WatchSignaturesServer,
+) error {
+	ctx := stream.Context()
+	if deviceID := request.GetDeviceId(); deviceID != "" {
+		if _, err := s.APIService.GetDevice(ctx, deviceID); err != nil {
+			return s.statusFromError(err)
+		}
+	}
+
+	transactions, cancel := s.APIService.WatchSignatures(ctx, request.GetDeviceId())
+	defer cancel()
+
+	// Headers tell the client that the subscription is in place
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case transaction, ok := <-transactions:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind, resubscribe to continue")
+			}
+			if err := stream.Send(transactionToProto(transaction)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// statusFromError maps domain errors to gRPC status codes.
+func (s *Server) statusFromError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrDeviceNotFound), errors.Is(err, domain.ErrTransactionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrDeviceExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrVersionMismatch), errors.Is(err, domain.ErrDeviceDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, domain.ErrCounterConflict), errors.Is(err, domain.ErrLeaseExpired):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, domain.ErrAlgorithmNotAllowed):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		s.logger.Errorf("RPC failed: %v", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func (s *Server) loggingUnaryInterceptor(
+	ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+	ctx, logger := s.requestLogger(ctx)
+	response, err := handler(ctx, request)
+	logger.Infow("Handled RPC", "method", info.FullMethod, "code", status.Code(err), "duration", time.Since(start))
+	return response, err
+}
+
+func (s *Server) loggingStreamInterceptor(
+	server any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	ctx, logger := s.requestLogger(stream.Context())
+	err := handler(server, &contextStream{ServerStream: stream, ctx: ctx})
+	logger.Infow("Handled stream", "method", info.FullMethod, "code", status.Code(err), "duration", time.Since(start))
+	return err
+}
+
+// requestLogger correlates an RPC by the x-request-id metadata like the HTTP API does by the
+// X-Request-ID header. The returned context carries the logger and the ID is sent back in
+// the response header.
+func (s *Server) requestLogger(ctx context.Context) (context.Context, *zap.SugaredLogger) {
+	var sent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadata); len(values) > 0 {
+			sent = values[0]
+		}
+	}
+	requestID := logging.RequestID(sent)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+
+	logger := s.logger.With("request_id", requestID)
+	return logging.WithLogger(ctx, logger), logger
+}
+
+func algorithmFromProto(algorithm signerv1.Algorithm) string {
+	switch algorithm {
+	case signerv1.Algorithm_ALGORITHM_RSA:
+		return string(domain.AlgorithmRSA)
+	case signerv1.Algorithm_ALGORITHM_ECC:
+		return string(domain.AlgorithmECC)
+	default:
+		return ""
+	}
+}
+
+func algorithmToProto(algorithm domain.Algorithm) signerv1.Algorithm {
+	switch algorithm {
+	case domain.AlgorithmRSA:
+		return signerv1.Algorithm_ALGORITHM_RSA
+	case domain.AlgorithmECC:
+		return signerv1.Algorithm_ALGORITHM_ECC
+	default:
+		return signerv1.Algorithm_ALGORITHM_UNSPECIFIED
+	}
+}
+
+func deviceToProto(device domain.SignatureDevice) *signerv1.Device {
+	return &signerv1.Device{
+		Id:               device.ID,
+		Algorithm:        algorithmToProto(device.Algorithm),
+		Label:            device.Label,
+		PublicKey:        string(device.PublicKey),
+		SignatureCounter: int64(device.SignatureCounter),
+		Metadata:         device.Metadata,
+		Version:          int64(device.Version),
+	}
+}
+
+func transactionToProto(transaction domain.Transaction) *signerv1.Signature {
+	return &signerv1.Signature{
+		DeviceId:   transaction.DeviceID,
+		Counter:    int64(transaction.Counter),
+		Signature:  transaction.Signature,
+		SignedData: transaction.SignedData,
+		CreatedAt:  timestamppb.New(transaction.CreatedAt),
+	}
+}
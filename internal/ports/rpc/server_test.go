@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	signerv1 "github.com/ashermp9/fiskaly-test-task/api/signer/v1"
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, options ...ServerOption) signerv1.SignatureServiceClient {
+	loggerZap, _ := zap.NewDevelopment()
+	server := NewServer(loggerZap.Sugar(), app.NewAPIService(storage.NewStorage()), 0, options...)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return signerv1.NewSignatureServiceClient(conn)
+}
+
+func TestDevices(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	device, err := client.CreateDevice(ctx, &signerv1.CreateDeviceRequest{
+		Id:        "grpc-device",
+		Algorithm: signerv1.Algorithm_ALGORITHM_ECC,
+		Label:     "Till 1",
+	})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	if device.GetId() != "grpc-device" || device.GetPublicKey() == "" || device.GetVersion() != 1 {
+		t.Errorf("unexpected device: %v", device)
+	}
+
+	_, err = client.CreateDevice(ctx, &signerv1.CreateDeviceRequest{Id: "grpc-device", Algorithm: signerv1.Algorithm_ALGORITHM_ECC})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists, got %v", err)
+	}
+
+	_, err = client.CreateDevice(ctx, &signerv1.CreateDeviceRequest{Id: "no-algorithm"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+
+	if _, err := client.GetDevice(ctx, &signerv1.GetDeviceRequest{Id: "grpc-device"}); err != nil {
+		t.Errorf("GetDevice failed: %v", err)
+	}
+	if _, err := client.GetDevice(ctx, &signerv1.GetDeviceRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+
+	devices, err := client.ListDevices(ctx, &signerv1.ListDevicesRequest{})
+	if err != nil || len(devices.GetDevices()) != 1 {
+		t.Errorf("unexpected ListDevices result: %v, %v", devices, err)
+	}
+}
+
+func TestWatchSignatures(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, id := range []string{"watched", "other"} {
+		if _, err := client.CreateDevice(ctx, &signerv1.CreateDeviceRequest{Id: id, Algorithm: signerv1.Algorithm_ALGORITHM_ECC}); err != nil {
+			t.Fatalf("CreateDevice failed: %v", err)
+		}
+	}
+
+	stream, err := client.WatchSignatures(ctx, &signerv1.WatchSignaturesRequest{DeviceId: "watched"})
+	if err != nil {
+		t.Fatalf("WatchSignatures failed: %v", err)
+	}
+	// The subscription is registered once the stream's headers arrive
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("failed to receive headers: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, id := range []string{"other", "watched"} {
+			signature, err := client.SignTransaction(ctx, &signerv1.SignTransactionRequest{DeviceId: id, Data: fmt.Sprintf("receipt %d", i)})
+			if err != nil {
+				t.Fatalf("SignTransaction failed: %v", err)
+			}
+			if signature.GetCounter() != int64(i) {
+				t.Errorf("expected counter %d, got %d", i, signature.GetCounter())
+			}
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		signature, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if signature.GetDeviceId() != "watched" || signature.GetCounter() != int64(i) {
+			t.Errorf("unexpected signature %d: %v", i, signature)
+		}
+	}
+
+	missingStream, err := client.WatchSignatures(ctx, &signerv1.WatchSignaturesRequest{DeviceId: "missing"})
+	if err != nil {
+		t.Fatalf("WatchSignatures failed: %v", err)
+	}
+	if _, err := missingStream.Recv(); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	keys := app.NewKeyService(storage.NewStorage(), []domain.APIKey{
+		{ID: "reader", Hash: app.HashAPIKey("reader-key"), Scopes: []domain.Scope{domain.ScopeDevicesRead}},
+	})
+	client := newTestClient(t, WithAPIKeys(keys))
+
+	_, err := client.ListDevices(context.Background(), &signerv1.ListDevicesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a key, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer reader-key")
+	if _, err := client.ListDevices(ctx, &signerv1.ListDevicesRequest{}); err != nil {
+		t.Errorf("ListDevices failed: %v", err)
+	}
+	_, err = client.CreateDevice(ctx, &signerv1.CreateDeviceRequest{Id: "denied", Algorithm: signerv1.Algorithm_ALGORITHM_ECC})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+
+	stream, err := client.WatchSignatures(metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "wrong"),
+		&signerv1.WatchSignaturesRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated for the stream, got %v", err)
+	}
+}
+
+func TestWatchSignaturesTenantIsolation(t *testing.T) {
+	keys := app.NewKeyService(storage.NewStorage(), []domain.APIKey{
+		{ID: "a", TenantID: "tenant-a", Hash: app.HashAPIKey("key-a"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+		{ID: "b", TenantID: "tenant-b", Hash: app.HashAPIKey("key-b"), Scopes: []domain.Scope{domain.ScopeAdmin}},
+	})
+	client := newTestClient(t, WithAPIKeys(keys))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctxA := metadata.AppendToOutgoingContext(ctx, "x-api-key", "key-a")
+	ctxB := metadata.AppendToOutgoingContext(ctx, "x-api-key", "key-b")
+
+	for _, tenantCtx := range []context.Context{ctxA, ctxB} {
+		if _, err := client.CreateDevice(tenantCtx, &signerv1.CreateDeviceRequest{Id: "till", Algorithm: signerv1.Algorithm_ALGORITHM_ECC}); err != nil {
+			t.Fatalf("CreateDevice failed: %v", err)
+		}
+	}
+
+	// Watching all devices must not include the devices of other tenants
+	stream, err := client.WatchSignatures(ctxB, &signerv1.WatchSignaturesRequest{})
+	if err != nil {
+		t.Fatalf("WatchSignatures failed: %v", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("failed to receive headers: %v", err)
+	}
+
+	if _, err := client.SignTransaction(ctxA, &signerv1.SignTransactionRequest{DeviceId: "till", Data: "tenant a"}); err != nil {
+		t.Fatalf("SignTransaction failed: %v", err)
+	}
+	if _, err := client.SignTransaction(ctxB, &signerv1.SignTransactionRequest{DeviceId: "till", Data: "tenant b"}); err != nil {
+		t.Fatalf("SignTransaction failed: %v", err)
+	}
+
+	signature, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if !strings.Contains(signature.GetSignedData(), "tenant b") {
+		t.Errorf("received the signature of another tenant: %s", signature.GetSignedData())
+	}
+}
@@ -0,0 +1,215 @@
+package ports
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// TLSOptions configures HTTPS serving and the verification of client certificates.
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	MinVersion   uint16   // Defaults to TLS 1.2
+	CipherSuites []uint16 // Defaults to the Go defaults, TLS 1.3 suites are not configurable
+	// ClientCAFile enables the verification of client certificates against the CA bundle.
+	ClientCAFile string
+	// RequireClientCert rejects connections without a verified client certificate.
+	RequireClientCert bool
+	// ClientSubjects maps subjects of verified client certificates, e.g. "CN=till-1,O=Acme",
+	// to the principal a request is authenticated as if it carries no API key.
+	ClientSubjects map[string]domain.Principal
+}
+
+// WithTLS serves HTTPS instead of plain HTTP. Certificates and the client CA bundle are
+// reloaded when their files change.
+func WithTLS(options TLSOptions) ServerOption {
+	return func(s *Server) {
+		s.tls = &options
+	}
+}
+
+// ParseTLSVersion converts a version like "1.2" to its crypto/tls constant.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q, use 1.2 or 1.3", version)
+	}
+}
+
+// ParseCipherSuites converts IANA cipher suite names to their crypto/tls IDs. Insecure
+// suites are rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// certificateReloader holds the current certificate and client CAs and replaces them
+// whenever one of their files changes. A failed reload keeps the previous state.
+type certificateReloader struct {
+	options TLSOptions
+	logger  *zap.SugaredLogger
+	watcher *fsnotify.Watcher
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+func newCertificateReloader(options TLSOptions, logger *zap.SugaredLogger) (*certificateReloader, error) {
+	reloader := &certificateReloader{options: options, logger: logger}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch certificates: %w", err)
+	}
+	// Watch the directories, files replaced by a rename (e.g. Kubernetes secrets) would otherwise be lost
+	for _, file := range []string{options.CertFile, options.KeyFile, options.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", file, err)
+		}
+	}
+	reloader.watcher = watcher
+	go reloader.watch()
+	return reloader, nil
+}
+
+func (c *certificateReloader) load() error {
+	certificate, err := tls.LoadX509KeyPair(c.options.CertFile, c.options.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	// Parsed once for the expiry reported by the readiness probe
+	if certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if c.options.ClientCAFile != "" {
+		bundle, err := os.ReadFile(c.options.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("client CA bundle %s contains no certificates", c.options.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certificate = &certificate
+	c.clientCAs = clientCAs
+	return nil
+}
+
+func (c *certificateReloader) watch() {
+	for {
+		select {
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			if err := c.load(); err != nil {
+				c.logger.Warnf("Keeping previous certificates, reload failed: %v", err)
+				continue
+			}
+			c.logger.Infof("Reloaded certificates after change of %s", event.Name)
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+			c.logger.Errorf("Certificate watcher failed: %v", err)
+		}
+	}
+}
+
+// tlsConfig returns a configuration resolving the current certificates on every handshake.
+func (c *certificateReloader) tlsConfig() *tls.Config {
+	minVersion := c.options.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	clientAuth := tls.NoClientCert
+	if c.options.ClientCAFile != "" {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if c.options.RequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: c.options.CipherSuites,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   minVersion,
+				CipherSuites: c.options.CipherSuites,
+				Certificates: []tls.Certificate{*c.certificate},
+				ClientAuth:   clientAuth,
+				ClientCAs:    c.clientCAs,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+func (c *certificateReloader) Close() error {
+	return c.watcher.Close()
+}
+
+// certificatePrincipal resolves the principal of a request's verified client certificate.
+func (s *Server) certificatePrincipal(r *http.Request) (domain.Principal, bool) {
+	if s.tls == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return domain.Principal{}, false
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject.String()
+	principal, ok := s.tls.ClientSubjects[subject]
+	if !ok {
+		return domain.Principal{}, false
+	}
+	if principal.KeyID == "" {
+		principal.KeyID = "cert:" + subject
+	}
+	if principal.Name == "" {
+		principal.Name = subject
+	}
+	return principal, true
+}
@@ -0,0 +1,217 @@
+package ports
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.uber.org/zap"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// issueCertificate creates a certificate signed by the parent, or a self-signed CA if parent is nil.
+func issueCertificate(t *testing.T, commonName string, parent *testCertificate) testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Acme"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	issuer, issuerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		issuer, issuerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return testCertificate{certificate: certificate, key: key}
+}
+
+func (c testCertificate) certificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw})
+}
+
+func (c testCertificate) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	der, _ := x509.MarshalECPrivateKey(c.key)
+	// Write to temporary files and rename them, as certificate rotation usually does
+	for file, content := range map[string][]byte{
+		certFile: c.certificatePEM(),
+		keyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+	} {
+		if err := os.WriteFile(file+".tmp", content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(file+".tmp", file); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.certificate.Raw}, PrivateKey: c.key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+
+	ca := issueCertificate(t, "Test CA", nil)
+	issueCertificate(t, "server", &ca).write(t, certFile, keyFile)
+	if err := os.WriteFile(caFile, ca.certificatePEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := issueCertificate(t, "till-1", &ca)
+	unknownClient := issueCertificate(t, "till-2", &ca)
+
+	loggerZap, _ := zap.NewDevelopment()
+	server := NewServer(loggerZap.Sugar(), app.NewAPIService(storage.NewStorage()), 0, WithTLS(TLSOptions{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		MinVersion:        tls.VersionTLS12,
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+		ClientSubjects: map[string]domain.Principal{
+			"CN=till-1,O=Acme": {TenantID: "acme", Scopes: []domain.Scope{domain.ScopeDevicesWrite}},
+		},
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certificates,
+		}}}
+	}
+	url := "https://" + listener.Addr().String() + "/api/v1/devices"
+
+	var response *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		response, err = newClient(client.tlsCertificate()).Post(url, "application/json",
+			bytes.NewBufferString(`{"id": "mtls", "algorithm": "ECC"}`))
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("request with client certificate failed: %v", err)
+	}
+	var device types.DeviceResponse
+	json.NewDecoder(response.Body).Decode(&device)
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated || device.TenantID != "acme" {
+		t.Errorf("expected the device to be created for tenant acme, got %d %+v", response.StatusCode, device)
+	}
+
+	response, err = newClient(client.tlsCertificate()).Get("https://" + listener.Addr().String() + "/readyz")
+	if err != nil {
+		t.Fatalf("readiness request failed: %v", err)
+	}
+	var health types.HealthResponse
+	json.NewDecoder(response.Body).Decode(&health)
+	response.Body.Close()
+	// The test certificates are only valid for an hour
+	if results := health.Checks["tls:certificate"]; len(results) != 1 || results[0].Status != "warn" || results[0].ObservedValue == nil {
+		t.Errorf("expected the soon expiring certificate to be reported, got %+v", health.Checks)
+	}
+	if health.Status != "warn" || response.StatusCode != http.StatusOK {
+		t.Errorf("a warning must not make the server unready, got %s %d", health.Status, response.StatusCode)
+	}
+
+	if _, err := newClient().Get(url); err == nil {
+		t.Error("connections without client certificate must be rejected")
+	}
+
+	response, err = newClient(unknownClient.tlsCertificate()).Get(url)
+	if err != nil {
+		t.Fatalf("request with unmapped client certificate failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unmapped subjects must not be authenticated, got %d", response.StatusCode)
+	}
+
+	// Rotate the server certificate, new connections must use it without a restart
+	rotated := issueCertificate(t, "rotated", &ca)
+	rotated.write(t, certFile, keyFile)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		connection, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{client.tlsCertificate()},
+		})
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		served := connection.ConnectionState().PeerCertificates[0]
+		connection.Close()
+		if served.Equal(rotated.certificate) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the rotated certificate was not picked up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestParseTLSOptions(t *testing.T) {
+	if version, err := ParseTLSVersion("1.3"); err != nil || version != tls.VersionTLS13 {
+		t.Errorf("unexpected version %x: %v", version, err)
+	}
+	if _, err := ParseTLSVersion("1.0"); err == nil {
+		t.Error("TLS 1.0 must be rejected")
+	}
+
+	suites, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(suites) != 1 || suites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites %v: %v", suites, err)
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("insecure cipher suites must be rejected")
+	}
+}
@@ -0,0 +1,91 @@
+package ports
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	loggerZap, _ := zap.NewDevelopment()
+	handler := NewServer(loggerZap.Sugar(), app.NewAPIService(storage.NewStorage()), 8080).Handler()
+	serve(handler, http.MethodPost, "/api/v1/devices", `{"id": "traced", "algorithm": "ECC"}`)
+	if !containsSpan(recorder.Ended(), "CryptoManager.GenerateKeys") {
+		t.Error("key generation was not traced")
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/devices/traced/signatures", strings.NewReader(`{"data": "receipt"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("signing returned %d: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			spans[span.Name()] = span
+		}
+	}
+	for _, name := range []string{
+		"POST /api/v1/devices/{id}/signatures",
+		"APIService.SignTransaction",
+		"Storage.LockDevice",
+		"Storage.GetDevice",
+		"Storage.SignTransaction",
+		"CryptoManager.Sign",
+		"APIService.persist",
+		"Storage.CommitSignature",
+	} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("span %q missing from the trace, got %v", name, spanNames(spans))
+		}
+	}
+
+	server := spans["POST /api/v1/devices/{id}/signatures"]
+	if server != nil && server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("the server span must continue the caller's span, got parent %s", server.Parent().SpanID())
+	}
+	if sign := spans["APIService.SignTransaction"]; sign != nil && server != nil &&
+		sign.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("the service span must be a child of the server span")
+	}
+}
+
+func spanNames(spans map[string]sdktrace.ReadOnlySpan) []string {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
+
+func containsSpan(spans []sdktrace.ReadOnlySpan, name string) bool {
+	for _, span := range spans {
+		if span.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package types
 
 import (
+	"encoding/base64"
+	"time"
+
 	"github.com/ashermp9/fiskaly-test-task/internal/domain"
 )
 
@@ -9,6 +12,31 @@ func ConvertToDomainCreateDeviceRequest(apiRequest CreateDeviceRequest) domain.C
 		ID:        apiRequest.ID,
 		Algorithm: domain.Algorithm(apiRequest.Algorithm),
 		Label:     apiRequest.Label,
+		Metadata:  apiRequest.Metadata,
+	}
+}
+
+func ConvertToDomainUpdateDeviceRequest(id string, version int, apiRequest UpdateDeviceRequest) domain.UpdateDeviceRequest {
+	return domain.UpdateDeviceRequest{
+		ID:              id,
+		Label:           apiRequest.Label,
+		Metadata:        apiRequest.Metadata,
+		Disabled:        apiRequest.Disabled,
+		ExpectedVersion: version,
+	}
+}
+
+func ConvertFromDomainDevice(device domain.SignatureDevice) DeviceResponse {
+	return DeviceResponse{
+		ID:               device.ID,
+		TenantID:         device.TenantID,
+		Algorithm:        string(device.Algorithm),
+		Label:            device.Label,
+		PublicKey:        string(device.PublicKey),
+		SignatureCounter: device.SignatureCounter,
+		Metadata:         device.Metadata,
+		Version:          device.Version,
+		Disabled:         device.Disabled,
 	}
 }
 
@@ -18,3 +46,88 @@ func ConvertToDomainSignTransactionRequest(apiRequest SignTransactionRequest) do
 		Data:     apiRequest.Data,
 	}
 }
+
+func ConvertFromDomainDevices(devices []domain.SignatureDevice) DeviceListResponse {
+	response := DeviceListResponse{Devices: make([]DeviceResponse, 0, len(devices))}
+	for _, device := range devices {
+		response.Devices = append(response.Devices, ConvertFromDomainDevice(device))
+	}
+	return response
+}
+
+func ConvertToDomainCreateSignatureRequest(deviceID string, apiRequest CreateSignatureRequest) domain.SignTransactionRequest {
+	return domain.SignTransactionRequest{
+		DeviceID: deviceID,
+		Data:     apiRequest.Data,
+	}
+}
+
+func ConvertFromDomainSignature(deviceID string, signature domain.SignatureResponse) SignatureResponse {
+	return SignatureResponse{
+		DeviceID:   deviceID,
+		Counter:    signature.Counter,
+		Signature:  signature.Signature,
+		SignedData: signature.SignedData,
+	}
+}
+
+func ConvertFromDomainTransaction(transaction domain.Transaction) SignatureResponse {
+	return SignatureResponse{
+		DeviceID:   transaction.DeviceID,
+		Counter:    transaction.Counter,
+		Signature:  base64.StdEncoding.EncodeToString(transaction.Signature),
+		SignedData: transaction.SignedData,
+		CreatedAt:  transaction.CreatedAt.Format(time.RFC3339Nano),
+	}
+}
+
+func ConvertFromDomainTransactions(transactions []domain.Transaction) SignatureListResponse {
+	response := SignatureListResponse{Signatures: make([]SignatureResponse, 0, len(transactions))}
+	for _, transaction := range transactions {
+		response.Signatures = append(response.Signatures, ConvertFromDomainTransaction(transaction))
+	}
+	return response
+}
+
+func ConvertToDomainScopes(scopes []string) []domain.Scope {
+	domainScopes := make([]domain.Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		domainScopes = append(domainScopes, domain.Scope(scope))
+	}
+	return domainScopes
+}
+
+func ConvertFromDomainAPIKey(apiKey domain.APIKey) APIKeyResponse {
+	scopes := make([]string, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	response := APIKeyResponse{
+		ID:       apiKey.ID,
+		Name:     apiKey.Name,
+		TenantID: apiKey.TenantID,
+		Scopes:   scopes,
+	}
+	if !apiKey.CreatedAt.IsZero() {
+		response.CreatedAt = apiKey.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return response
+}
+
+func ConvertFromDomainAPIKeys(apiKeys []domain.APIKey) APIKeyListResponse {
+	response := APIKeyListResponse{APIKeys: make([]APIKeyResponse, 0, len(apiKeys))}
+	for _, apiKey := range apiKeys {
+		response.APIKeys = append(response.APIKeys, ConvertFromDomainAPIKey(apiKey))
+	}
+	return response
+}
+
+func ConvertFromDomainRestoreSummary(summary domain.RestoreSummary) RestoreResponse {
+	return RestoreResponse{
+		Devices:        summary.Devices,
+		SkippedDevices: summary.SkippedDevices,
+		Transactions:   summary.Transactions,
+		APIKeys:        summary.APIKeys,
+	}
+}
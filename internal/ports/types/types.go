@@ -1,6 +1,12 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+)
 
 // Validator interface for request validation
 type Validator interface {
@@ -8,9 +14,10 @@ type Validator interface {
 }
 
 type CreateDeviceRequest struct {
-	ID        string `json:"id"`
-	Algorithm string `json:"algorithm"`
-	Label     string `json:"label,omitempty"`
+	ID        string            `json:"id"`
+	Algorithm string            `json:"algorithm"`
+	Label     string            `json:"label,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
 func (r CreateDeviceRequest) Validate() error {
@@ -20,9 +27,49 @@ func (r CreateDeviceRequest) Validate() error {
 	if r.Algorithm != "RSA" && r.Algorithm != "ECC" {
 		return fmt.Errorf("invalid algorithm: must be 'RSA' or 'ECC'")
 	}
+	for key := range r.Metadata {
+		if key == "" {
+			return fmt.Errorf("metadata keys must not be empty")
+		}
+	}
 	return nil
 }
 
+// UpdateDeviceRequest is a partial update of a device. Omitted fields are left unchanged,
+// metadata keys set to null are removed.
+type UpdateDeviceRequest struct {
+	Label    *string            `json:"label,omitempty"`
+	Metadata map[string]*string `json:"metadata,omitempty"`
+	Disabled *bool              `json:"disabled,omitempty"`
+	Version  *int               `json:"version,omitempty"`
+}
+
+// Validate performs input validation on an UpdateDeviceRequest.
+func (r UpdateDeviceRequest) Validate() error {
+	if r.Label == nil && r.Metadata == nil && r.Disabled == nil {
+		return fmt.Errorf("label, metadata or disabled is required")
+	}
+	for key := range r.Metadata {
+		if key == "" {
+			return fmt.Errorf("metadata keys must not be empty")
+		}
+	}
+	return nil
+}
+
+// DeviceResponse is the public representation of a signature device. It never includes the private key.
+type DeviceResponse struct {
+	ID               string            `json:"id"`
+	TenantID         string            `json:"tenantId"`
+	Algorithm        string            `json:"algorithm"`
+	Label            string            `json:"label,omitempty"`
+	PublicKey        string            `json:"publicKey"`
+	SignatureCounter int               `json:"signatureCounter"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Version          int               `json:"version"`
+	Disabled         bool              `json:"disabled"`
+}
+
 type SignTransactionRequest struct {
 	DeviceID string `json:"deviceId"`
 	Data     string `json:"data"`
@@ -38,3 +85,140 @@ func (r SignTransactionRequest) Validate() error {
 	}
 	return nil
 }
+
+// DeviceListResponse is the response of the device collection.
+type DeviceListResponse struct {
+	Devices []DeviceResponse `json:"devices"`
+}
+
+// CreateSignatureRequest is the body of a signature creation on a device resource.
+type CreateSignatureRequest struct {
+	Data string `json:"data"`
+}
+
+// Validate performs input validation on a CreateSignatureRequest.
+func (r CreateSignatureRequest) Validate() error {
+	if r.Data == "" {
+		return fmt.Errorf("data is required")
+	}
+	return nil
+}
+
+// SignatureResponse is the public representation of a created signature.
+type SignatureResponse struct {
+	DeviceID   string `json:"deviceId"`
+	Counter    int    `json:"counter"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signedData"`
+	CreatedAt  string `json:"createdAt,omitempty"`
+}
+
+// SignatureListResponse is the response of the signature collection of a device.
+type SignatureListResponse struct {
+	Signatures []SignatureResponse `json:"signatures"`
+}
+
+// ErrorResponse is the body of every error returned by the v1 API.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an error with a stable machine-readable code.
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes returned by the v1 API.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeMethodNotAllowed     = "method_not_allowed"
+	ErrorCodeDeviceNotFound       = "device_not_found"
+	ErrorCodeDeviceExists         = "device_exists"
+	ErrorCodeDeviceDisabled       = "device_disabled"
+	ErrorCodeVersionMismatch      = "version_mismatch"
+	ErrorCodeCounterConflict      = "counter_conflict"
+	ErrorCodeLeaseExpired         = "lease_expired"
+	ErrorCodePreconditionRequired = "precondition_required"
+	ErrorCodeSignatureNotFound    = "signature_not_found"
+	ErrorCodeIdempotencyKeyReused = "idempotency_key_reused"
+	ErrorCodeUnauthenticated      = "unauthenticated"
+	ErrorCodeForbidden            = "forbidden"
+	ErrorCodeAPIKeyNotFound       = "api_key_not_found"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeAlgorithmNotAllowed  = "algorithm_not_allowed"
+	ErrorCodeInvalidBackup        = "invalid_backup"
+	ErrorCodeCounterRollback      = "counter_rollback"
+	ErrorCodeInternal             = "internal_error"
+)
+
+// RestoreResponse reports what restoring a backup changed.
+type RestoreResponse struct {
+	Devices        int `json:"devices"`
+	SkippedDevices int `json:"skippedDevices"`
+	Transactions   int `json:"transactions"`
+	APIKeys        int `json:"apiKeys"`
+}
+
+// CreateAPIKeyRequest is the body of an API key creation.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Validate performs input validation on a CreateAPIKeyRequest.
+func (r CreateAPIKeyRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(r.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range r.Scopes {
+		if !domain.Scope(scope).Valid() {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// APIKeyResponse is the public representation of an API key. Key is only set when the key is created.
+type APIKeyResponse struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	TenantID  string   `json:"tenantId"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"createdAt,omitempty"`
+	Key       string   `json:"key,omitempty"`
+}
+
+// AuditEventListResponse is the response of the audit event collection. The events are
+// returned as hashed, any other encoding would break their verification.
+type AuditEventListResponse struct {
+	Events []audit.Event `json:"events"`
+}
+
+// APIKeyListResponse is the response of the API key collection.
+type APIKeyListResponse struct {
+	APIKeys []APIKeyResponse `json:"apiKeys"`
+}
+
+// HealthResponse is a health check document of draft-inadarei-api-health-check, served as
+// application/health+json.
+type HealthResponse struct {
+	Status      string                         `json:"status"` // pass, warn or fail
+	ServiceID   string                         `json:"serviceId"`
+	Description string                         `json:"description,omitempty"`
+	Checks      map[string][]HealthCheckResult `json:"checks,omitempty"` // Keyed by component:measurement
+}
+
+// HealthCheckResult is the state of one component of a health check.
+type HealthCheckResult struct {
+	ComponentType string    `json:"componentType,omitempty"`
+	ObservedValue any       `json:"observedValue,omitempty"`
+	ObservedUnit  string    `json:"observedUnit,omitempty"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
@@ -0,0 +1,60 @@
+package ports
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/openapi"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports/types"
+)
+
+// maxRequestBodySize limits the request bodies buffered for validation.
+const maxRequestBodySize = 1 << 20
+
+// ValidationMiddleware rejects requests whose body does not match the OpenAPI document.
+// Requests for undocumented operations are passed through unchanged.
+func (s *Server) ValidationMiddleware(document *openapi.Document, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, operation, ok := document.FindOperation(r.Method, r.URL.Path)
+		if !ok || operation.RequestBody == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Only JSON bodies are validated, others such as backups may exceed maxRequestBodySize
+		if _, isJSON := operation.RequestBody.Content["application/json"]; !isJSON {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err.Error())
+			return
+		}
+		if len(body) > maxRequestBodySize {
+			writeError(w, http.StatusRequestEntityTooLarge, types.ErrorCodeInvalidRequest, "request body too large")
+			return
+		}
+
+		if err := document.ValidateRequest(operation, body); err != nil {
+			writeError(w, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err.Error())
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OpenAPIHandler serves the OpenAPI document of the API.
+func (s *Server) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi.Spec())
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// AddAPIKey stores an API key under its hash. Configured keys are never journaled.
+func (s *Storage) AddAPIKey(_ context.Context, key domain.APIKey) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key.Configured {
+		s.apply(journalRecord{APIKey: &key})
+		return nil
+	}
+	return s.commit(journalRecord{APIKey: &key})
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash.
+func (s *Storage) GetAPIKeyByHash(_ context.Context, hash string) (domain.APIKey, error) {
+	key, found := s.cache.APIKeyCache.Get(hash)
+	if !found {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the API keys of the request's tenant ordered by ID.
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	tenantID := domain.TenantFromContext(ctx)
+	keys := make([]domain.APIKey, 0)
+	for _, key := range s.cache.APIKeyCache.Values() {
+		if key.TenantID == tenantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// DeleteAPIKey removes the API key of the request's tenant with the given ID.
+func (s *Storage) DeleteAPIKey(ctx context.Context, id string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenantID := domain.TenantFromContext(ctx)
+	for _, key := range s.cache.APIKeyCache.Values() {
+		if key.ID == id && key.TenantID == tenantID {
+			if key.Configured {
+				s.apply(journalRecord{DeletedAPIKey: key.Hash})
+				return nil
+			}
+			return s.commit(journalRecord{DeletedAPIKey: key.Hash})
+		}
+	}
+	return domain.ErrAPIKeyNotFound
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+)
+
+// AuditLog keeps one hash chain of audit events per tenant. Opened from a file, every event
+// is appended to it as a JSON line and synced before Append returns. Events are never
+// changed or removed.
+type AuditLog struct {
+	mu     sync.Mutex
+	file   *os.File
+	size   int64 // Bytes of complete lines, the file is truncated back to it on failed writes
+	err    error // Set once the file is in an unknown state, the log refuses all appends
+	chains map[string][]audit.Event
+}
+
+// NewAuditLog creates an audit log kept in memory only.
+func NewAuditLog() *AuditLog {
+	return &AuditLog{chains: make(map[string][]audit.Event)}
+}
+
+// OpenAuditLog loads the events of the log file, creating it if missing, and appends new
+// events to it. An incomplete last line, left behind by a crash while appending, is
+// discarded: its event was never acknowledged. It returns the discarded bytes. A log whose
+// chains do not verify is refused instead of being extended.
+func OpenAuditLog(path string) (*AuditLog, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, 0, fmt.Errorf("failed to create the audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open the audit log: %w", err)
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to read the audit log %s: %w", path, err)
+	}
+
+	// Every append ends with a newline, anything after the last one is a torn write
+	size := int64(bytes.LastIndexByte(content, '\n') + 1)
+	events, err := audit.ReadLog(bytes.NewReader(content[:size]))
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to read the audit log %s: %w", path, err)
+	}
+	if _, err := audit.Verify(events); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("audit log %s is corrupted: %w", path, err)
+	}
+	truncated := int64(len(content)) - size
+	if truncated > 0 {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, 0, fmt.Errorf("failed to truncate the audit log: %w", err)
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, 0, fmt.Errorf("failed to sync the audit log: %w", err)
+		}
+	}
+
+	log := NewAuditLog()
+	log.file = file
+	log.size = size
+	for _, event := range events {
+		log.chains[event.TenantID] = append(log.chains[event.TenantID], event)
+	}
+	return log, truncated, nil
+}
+
+// Append seals the event into the chain of its tenant and stores it. A failed write is
+// truncated away, so the next event does not follow a partial line.
+func (l *AuditLog) Append(_ context.Context, event audit.Event) (audit.Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return audit.Event{}, l.err
+	}
+
+	chain := l.chains[event.TenantID]
+	var previous *audit.Event
+	if len(chain) > 0 {
+		previous = &chain[len(chain)-1]
+	}
+	event = audit.Seal(event, previous)
+
+	if l.file != nil {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return audit.Event{}, err
+		}
+		line = append(line, '\n')
+		if _, err := l.file.Write(line); err != nil {
+			if truncateErr := l.file.Truncate(l.size); truncateErr != nil {
+				l.err = fmt.Errorf("audit log %s is broken: %w", l.file.Name(), truncateErr)
+			}
+			return audit.Event{}, fmt.Errorf("failed to write the audit log: %w", err)
+		}
+		if err := l.file.Sync(); err != nil {
+			// The kernel may have dropped the written pages, nothing written since is reliable
+			l.err = fmt.Errorf("audit log %s is broken: failed to sync: %w", l.file.Name(), err)
+			return audit.Event{}, l.err
+		}
+		l.size += int64(len(line))
+	}
+
+	l.chains[event.TenantID] = append(chain, event)
+	return event, nil
+}
+
+// List returns the chain of a tenant in order.
+func (l *AuditLog) List(_ context.Context, tenantID string) []audit.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	chain := l.chains[tenantID]
+	events := make([]audit.Event, len(chain))
+	copy(events, chain)
+	return events
+}
+
+// Ping checks that the log file is still open and present on disk.
+func (l *AuditLog) Ping(_ context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	if l.err != nil {
+		return l.err
+	}
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(l.file.Name()); err != nil {
+		return fmt.Errorf("audit log %s was removed: %w", info.Name(), err)
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (l *AuditLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/audit"
+)
+
+// TestAuditLogDiscardsTornLine cuts the last line as a crash while appending would. The log
+// must open without it and continue the chain after the last complete event.
+func TestAuditLogDiscardsTornLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, _, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{audit.ActionDeviceCreate, audit.ActionDeviceUpdate} {
+		if _, err := log.Append(ctx, audit.Event{TenantID: "acme", Action: action, DeviceID: "till"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.Close()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := append(content[:len(content)-10:len(content)-10], make([]byte, 512)...)
+	if err := os.WriteFile(path, torn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	log, truncated, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("a torn last line must not prevent opening the log: %v", err)
+	}
+	defer log.Close()
+	events := log.List(ctx, "acme")
+	if len(events) != 1 || truncated == 0 {
+		t.Fatalf("expected the first event and a discarded line, got %d events, %d bytes", len(events), truncated)
+	}
+	if _, err := log.Append(ctx, audit.Event{TenantID: "acme", Action: audit.ActionDeviceExport, DeviceID: "till"}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	logged, err := audit.ReadLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chains, err := audit.Verify(logged); err != nil || chains != 1 || len(logged) != 2 {
+		t.Errorf("expected 2 verified events, got %d events, %d chains, %v", len(logged), chains, err)
+	}
+}
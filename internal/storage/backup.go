@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// Snapshot copies the devices, transactions and API keys of all tenants. Mutations wait
+// while the copy is taken.
+func (s *Storage) Snapshot(ctx context.Context) (domain.Snapshot, error) {
+	_, span := tracer.Start(ctx, "Storage.Snapshot")
+	defer span.End()
+
+	s.mu.Lock()
+	devices, histories, apiKeys := s.copyState()
+	s.mu.Unlock()
+
+	snapshot := domain.Snapshot{Devices: devices, Transactions: make([]domain.Transaction, 0), APIKeys: apiKeys}
+	for _, device := range devices {
+		history := histories[cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}]
+		snapshot.Transactions = append(snapshot.Transactions, history...)
+	}
+	return snapshot, nil
+}
+
+// copyState returns the devices ordered by tenant and ID, their histories and the API keys
+// ordered by hash. Callers hold mu.
+func (s *Storage) copyState() ([]domain.SignatureDevice, map[cache.DeviceKey][]domain.Transaction, []domain.APIKey) {
+	devices := s.cache.DeviceCache.Values()
+	histories := make(map[cache.DeviceKey][]domain.Transaction, len(devices))
+	for _, device := range devices {
+		key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+		histories[key], _ = s.cache.TransactionCache.Get(key)
+	}
+	apiKeys := s.cache.APIKeyCache.Values()
+
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].TenantID != devices[j].TenantID {
+			return devices[i].TenantID < devices[j].TenantID
+		}
+		return devices[i].ID < devices[j].ID
+	})
+	sort.Slice(apiKeys, func(i, j int) bool { return apiKeys[i].Hash < apiKeys[j].Hash })
+	return devices, histories, apiKeys
+}
+
+// Restore adds the devices, transactions and API keys of a snapshot. Devices that exist
+// already are brought forward to the state of the snapshot if they use the same key, the
+// restore fails with domain.ErrCounterRollback if one has signed more than the snapshot
+// knows of or if its signatures differ from the snapshot's. Nothing is changed if the
+// restore fails. The snapshot must be consistent, with the transactions of every device
+// complete and ordered by counter.
+func (s *Storage) Restore(ctx context.Context, snapshot domain.Snapshot) (domain.RestoreSummary, error) {
+	_, span := tracer.Start(ctx, "Storage.Restore")
+	defer span.End()
+
+	histories := make(map[cache.DeviceKey][]domain.Transaction, len(snapshot.Devices))
+	for _, transaction := range snapshot.Transactions {
+		key := cache.DeviceKey{TenantID: transaction.TenantID, DeviceID: transaction.DeviceID}
+		histories[key] = append(histories[key], transaction)
+	}
+
+	// Signing holds the device lock from reading the device until it is stored, take the
+	// locks first so no signature based on the replaced state completes afterwards
+	keys := make([]cache.DeviceKey, 0, len(snapshot.Devices))
+	for _, device := range snapshot.Devices {
+		keys = append(keys, cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].TenantID < keys[j].TenantID || (keys[i].TenantID == keys[j].TenantID && keys[i].DeviceID < keys[j].DeviceID)
+	})
+	for _, key := range keys {
+		s.cache.DeviceCache.Lock(key)
+		defer s.cache.DeviceCache.Unlock(key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summary domain.RestoreSummary
+	var restore []domain.SignatureDevice
+	for _, device := range snapshot.Devices {
+		existing, found := s.cache.DeviceCache.Get(cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID})
+		if !found {
+			restore = append(restore, device)
+			continue
+		}
+		if !bytes.Equal(existing.PublicKey, device.PublicKey) {
+			return domain.RestoreSummary{}, fmt.Errorf("%w: device %q of tenant %q uses a different key",
+				domain.ErrDeviceExists, device.ID, device.TenantID)
+		}
+		if existing.SignatureCounter > device.SignatureCounter {
+			return domain.RestoreSummary{}, fmt.Errorf("%w: device %q of tenant %q has signed %d times, the backup %d times",
+				domain.ErrCounterRollback, device.ID, device.TenantID, existing.SignatureCounter, device.SignatureCounter)
+		}
+		if existing.SignatureCounter == device.SignatureCounter {
+			summary.SkippedDevices++
+			continue
+		}
+		history, _ := s.cache.TransactionCache.Get(cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID})
+		if err := checkForked(device, history, histories[cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}]); err != nil {
+			return domain.RestoreSummary{}, err
+		}
+		restore = append(restore, device)
+	}
+
+	changes := domain.Snapshot{Devices: restore}
+	for _, device := range restore {
+		key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+		existing, _ := s.cache.TransactionCache.Get(key)
+		history := histories[key]
+		changes.Transactions = append(changes.Transactions, history...)
+		summary.Devices++
+		summary.Transactions += len(history) - min(len(existing), len(history))
+	}
+	for _, apiKey := range snapshot.APIKeys {
+		// Configured keys belong to the configuration of the instance the backup was taken on
+		if _, found := s.cache.APIKeyCache.Get(apiKey.Hash); !found && !apiKey.Configured {
+			changes.APIKeys = append(changes.APIKeys, apiKey)
+			summary.APIKeys++
+		}
+	}
+	if err := s.commit(journalRecord{Restore: &changes}); err != nil {
+		return domain.RestoreSummary{}, err
+	}
+	return summary, nil
+}
+
+// checkForked fails with domain.ErrCounterRollback unless the history of a device is a prefix
+// of the restored one. Signatures of a history forked from the snapshot's were handed out, the
+// snapshot's chain would not contain them.
+func checkForked(device domain.SignatureDevice, history, restored []domain.Transaction) error {
+	for _, transaction := range history {
+		if transaction.Counter >= len(restored) || !bytes.Equal(transaction.Signature, restored[transaction.Counter].Signature) {
+			return fmt.Errorf("%w: signature %d of device %q of tenant %q differs from the backup",
+				domain.ErrCounterRollback, transaction.Counter, device.ID, device.TenantID)
+		}
+	}
+	return nil
+}
@@ -2,29 +2,103 @@ package storage
 
 import (
 	"context"
-	"fmt"
+	"sort"
 
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
 	"github.com/ashermp9/fiskaly-test-task/internal/domain"
 )
 
-// AddDevice adds a new signature device to the storage.
-func (s *Storage) AddDevice(_ context.Context, device domain.SignatureDevice) {
-	s.cache.DeviceCache.Set(device.ID, device)
+// deviceKey scopes a device ID to the tenant of the request.
+func deviceKey(ctx context.Context, deviceID string) cache.DeviceKey {
+	return cache.DeviceKey{TenantID: domain.TenantFromContext(ctx), DeviceID: deviceID}
 }
 
-// GetDevice retrieves a signature device from the storage.
-func (s *Storage) GetDevice(_ context.Context, id string) (domain.SignatureDevice, error) {
-	device, found := s.cache.DeviceCache.Get(id)
+// AddDevice adds a new signature device to the storage of its tenant. It fails with
+// domain.ErrDeviceExists if the tenant has a device with the same ID.
+func (s *Storage) AddDevice(ctx context.Context, device domain.SignatureDevice) error {
+	_, span := tracer.Start(ctx, "Storage.AddDevice")
+	defer span.End()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.conditions.Lock()
+	defer s.conditions.Unlock()
+
+	key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+	if err := s.checkFence(ctx, key); err != nil {
+		return err
+	}
+	if _, found := s.cache.DeviceCache.Get(key); found {
+		return domain.ErrDeviceExists
+	}
+	return s.commit(journalRecord{Device: &device})
+}
+
+// UpdateDevice stores the label, metadata, status and version of a device if the stored
+// device still has expectedVersion, otherwise it fails with domain.ErrVersionMismatch. The
+// signature counter and last signature of the stored device are kept.
+func (s *Storage) UpdateDevice(ctx context.Context, device domain.SignatureDevice, expectedVersion int) error {
+	_, span := tracer.Start(ctx, "Storage.UpdateDevice")
+	defer span.End()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.conditions.Lock()
+	defer s.conditions.Unlock()
+
+	key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+	if err := s.checkFence(ctx, key); err != nil {
+		return err
+	}
+	stored, found := s.cache.DeviceCache.Get(key)
 	if !found {
-		return domain.SignatureDevice{}, fmt.Errorf("device not found")
+		return domain.ErrDeviceNotFound
+	}
+	if stored.Version != expectedVersion {
+		return domain.ErrVersionMismatch
+	}
+	stored.Label = device.Label
+	stored.Metadata = device.Metadata
+	stored.Disabled = device.Disabled
+	stored.Version = device.Version
+	return s.commit(journalRecord{Device: &stored})
+}
+
+// GetDevice retrieves a signature device of the request's tenant from the storage.
+func (s *Storage) GetDevice(ctx context.Context, id string) (domain.SignatureDevice, error) {
+	_, span := tracer.Start(ctx, "Storage.GetDevice")
+	defer span.End()
+
+	device, found := s.cache.DeviceCache.Get(deviceKey(ctx, id))
+	if !found {
+		return domain.SignatureDevice{}, domain.ErrDeviceNotFound
 	}
 	return device, nil
 }
 
-func (s *Storage) LockDevice(_ context.Context, deviceID string) {
-	s.cache.DeviceCache.Lock(deviceID)
+// ListDevices returns the signature devices of the request's tenant ordered by ID.
+func (s *Storage) ListDevices(ctx context.Context) ([]domain.SignatureDevice, error) {
+	tenantID := domain.TenantFromContext(ctx)
+	devices := make([]domain.SignatureDevice, 0)
+	for _, device := range s.cache.DeviceCache.Values() {
+		if device.TenantID == tenantID {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices, nil
+}
+
+// CountDevices returns the number of devices of all tenants.
+func (s *Storage) CountDevices(_ context.Context) int {
+	return s.cache.DeviceCache.Len()
+}
+
+func (s *Storage) LockDevice(ctx context.Context, deviceID string) {
+	_, span := tracer.Start(ctx, "Storage.LockDevice")
+	defer span.End()
+
+	s.cache.DeviceCache.Lock(deviceKey(ctx, deviceID))
 }
 
-func (s *Storage) UnlockDevice(_ context.Context, deviceID string) {
-	s.cache.DeviceCache.Unlock(deviceID)
+func (s *Storage) UnlockDevice(ctx context.Context, deviceID string) {
+	s.cache.DeviceCache.Unlock(deviceKey(ctx, deviceID))
 }
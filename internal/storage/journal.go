@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+)
+
+const (
+	journalFile  = "journal.log"
+	snapshotFile = "snapshot.json"
+
+	// Every record is framed by the length and the CRC-32C of its JSON payload
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 30
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// journalRecord is one mutation of the storage. Exactly one field besides Sequence is set.
+// Applying a record sets state rather than changing it, so records may be replayed over a
+// snapshot that already contains them.
+type journalRecord struct {
+	Sequence      uint64                  `json:"seq"`
+	Device        *domain.SignatureDevice `json:"device,omitempty"`
+	Transaction   *domain.Transaction     `json:"transaction,omitempty"` // Also advances the counter of its device
+	APIKey        *domain.APIKey          `json:"apiKey,omitempty"`
+	DeletedAPIKey string                  `json:"deletedApiKey,omitempty"` // Hash of the key
+	Restore       *domain.Snapshot        `json:"restore,omitempty"`       // Devices with their complete history
+}
+
+// journalSnapshot is the content of the snapshot file, the state after the record Sequence.
+// Version is the schema version of the state and of the journal records after it.
+type journalSnapshot struct {
+	Sequence uint64          `json:"seq"`
+	Version  int             `json:"version"`
+	State    domain.Snapshot `json:"state"`
+}
+
+// journal appends records to the journal file of a directory and syncs them before they are
+// applied. Compaction moves the records into the snapshot file of the same directory.
+type journal struct {
+	dir string
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64  // Bytes of intact records, the file is truncated back to it on failed writes
+	sequence uint64 // Sequence of the last record
+	err      error  // Set once the file is in an unknown state, the journal refuses all writes
+
+	compacting sync.Mutex
+}
+
+// Recovery describes the state OpenStorage loaded from its directory.
+type Recovery struct {
+	SnapshotSequence uint64 // Last record contained in the snapshot, 0 without a snapshot
+	Records          int    // Journal records replayed on top of the snapshot
+	Truncated        int64  // Bytes of an incomplete last record that were discarded
+}
+
+// OpenStorage opens a storage whose mutations are journaled in dir, creating the directory
+// if missing. The state is loaded from the snapshot file and the journal records after it. An
+// incomplete last record, left behind by a crash while appending, is discarded: it was never
+// acknowledged. Data of another schema version than the latest fails with
+// migrate.ErrOutdated or migrate.ErrUnknownVersion, see MigrateJournal. The files contain the
+// private keys of all devices.
+func OpenStorage(dir string) (*Storage, Recovery, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, Recovery{}, fmt.Errorf("failed to create the storage directory: %w", err)
+	}
+	loaded, err := load(dir)
+	if err != nil {
+		return nil, Recovery{}, err
+	}
+	if loaded.fresh {
+		// A new directory starts at the latest version
+		if err := writeSnapshot(dir, journalSnapshot{Version: len(journalMigrations)}); err != nil {
+			return nil, Recovery{}, fmt.Errorf("failed to write the snapshot: %w", err)
+		}
+	} else if err := migrate.Check(journalSchemaMigrations(), loaded.version); err != nil {
+		return nil, Recovery{}, fmt.Errorf("storage %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, journalFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, Recovery{}, fmt.Errorf("failed to open the journal: %w", err)
+	}
+	if loaded.recovery.Truncated > 0 {
+		if err := file.Truncate(loaded.size); err != nil {
+			file.Close()
+			return nil, Recovery{}, fmt.Errorf("failed to truncate the journal: %w", err)
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, Recovery{}, fmt.Errorf("failed to sync the journal: %w", err)
+		}
+	}
+
+	s := loaded.storage
+	s.journal = &journal{dir: dir, file: file, size: loaded.size, sequence: loaded.sequence}
+	return s, loaded.recovery, nil
+}
+
+// loadedDir is the content of a storage directory.
+type loadedDir struct {
+	storage  *Storage // The state, without a journal
+	version  int      // Schema version of the state
+	fresh    bool     // Neither a snapshot nor journal records exist
+	sequence uint64   // Last record applied
+	size     int64    // Bytes of intact journal records
+	recovery Recovery
+}
+
+// load reads the snapshot and the journal of dir without changing them. Data without a
+// snapshot has version 0, it was journaled before versions were recorded.
+func load(dir string) (loadedDir, error) {
+	loaded := loadedDir{storage: NewStorage()}
+	content, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return loadedDir{}, fmt.Errorf("failed to read the snapshot: %w", err)
+	}
+	snapshotFound := err == nil
+	if snapshotFound {
+		var snapshot journalSnapshot
+		if err := json.Unmarshal(content, &snapshot); err != nil {
+			return loadedDir{}, fmt.Errorf("snapshot %s is corrupted: %w", filepath.Join(dir, snapshotFile), err)
+		}
+		loaded.storage.apply(journalRecord{Restore: &snapshot.State})
+		loaded.version = snapshot.Version
+		loaded.recovery.SnapshotSequence = snapshot.Sequence
+	}
+
+	path := filepath.Join(dir, journalFile)
+	content, err = os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return loadedDir{}, fmt.Errorf("failed to read the journal: %w", err)
+	}
+	records, size, err := readJournal(content)
+	if err != nil {
+		return loadedDir{}, fmt.Errorf("journal %s is corrupted: %w", path, err)
+	}
+	if len(records) > 0 && records[0].Sequence > loaded.recovery.SnapshotSequence+1 {
+		return loadedDir{}, fmt.Errorf("journal %s starts at record %d, the snapshot ends at %d",
+			path, records[0].Sequence, loaded.recovery.SnapshotSequence)
+	}
+	loaded.fresh = !snapshotFound && len(records) == 0
+	loaded.size = size
+	loaded.recovery.Truncated = int64(len(content)) - size
+
+	loaded.sequence = loaded.recovery.SnapshotSequence
+	for _, record := range records {
+		// Records up to the snapshot remain if compaction was interrupted
+		if record.Sequence <= loaded.recovery.SnapshotSequence {
+			continue
+		}
+		loaded.storage.apply(record)
+		loaded.recovery.Records++
+		loaded.sequence = record.Sequence
+	}
+	loaded.storage.settle()
+	return loaded, nil
+}
+
+// settle drops transactions beyond the counter of their device and sets the last signature of
+// every device from its history. JSON does not preserve the raw signature bytes of
+// domain.SignatureDevice.LastSignature.
+func (s *Storage) settle() {
+	for _, device := range s.cache.DeviceCache.Values() {
+		key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+		history, _ := s.cache.TransactionCache.Get(key)
+		history = history[:min(len(history), device.SignatureCounter)]
+		s.cache.TransactionCache.Set(key, history)
+		if len(history) > 0 {
+			device.LastSignature = string(history[len(history)-1].Signature)
+			s.cache.DeviceCache.Set(key, device)
+		}
+	}
+}
+
+// Compact writes the state into the snapshot file and removes the journal records it
+// contains, so startup does not replay the whole history. Storages without a journal have
+// nothing to compact. Mutations only wait while the state is copied.
+func (s *Storage) Compact(ctx context.Context) error {
+	if s.journal == nil {
+		return nil
+	}
+	_, span := tracer.Start(ctx, "Storage.Compact")
+	defer span.End()
+	s.journal.compacting.Lock()
+	defer s.journal.compacting.Unlock()
+
+	s.mu.Lock()
+	devices, histories, apiKeys := s.copyState()
+	sequence, size := s.journal.position()
+	s.mu.Unlock()
+	if size == 0 {
+		return nil
+	}
+
+	snapshot := journalSnapshot{Sequence: sequence, Version: len(journalMigrations), State: domain.Snapshot{Devices: devices}}
+	for _, device := range devices {
+		key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+		snapshot.State.Transactions = append(snapshot.State.Transactions, histories[key]...)
+	}
+	for _, apiKey := range apiKeys {
+		if !apiKey.Configured {
+			snapshot.State.APIKeys = append(snapshot.State.APIKeys, apiKey)
+		}
+	}
+	if err := writeSnapshot(s.journal.dir, snapshot); err != nil {
+		return fmt.Errorf("failed to write the snapshot: %w", err)
+	}
+	return s.journal.discardBefore(size)
+}
+
+func writeSnapshot(dir string, snapshot journalSnapshot) error {
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return writeFileSynced(filepath.Join(dir, snapshotFile), content)
+}
+
+// RunCompaction compacts the journal every interval until ctx is done. Failures are passed
+// to onError, the next compaction retries.
+func (s *Storage) RunCompaction(ctx context.Context, interval time.Duration, onError func(error)) {
+	if s.journal == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Compact(ctx); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// append writes the record, syncs it and then applies it. Nothing is applied if the record
+// could not be made durable.
+func (j *journal) append(record journalRecord, apply func(journalRecord)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+
+	record.Sequence = j.sequence + 1
+	frame, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(frame); err != nil {
+		// A partial record must not be followed by the next one, it would look like corruption
+		if truncateErr := j.file.Truncate(j.size); truncateErr != nil {
+			j.err = fmt.Errorf("journal %s is broken: %w", j.file.Name(), truncateErr)
+		}
+		return fmt.Errorf("failed to write the journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		// The kernel may have dropped the written pages, nothing written since is reliable
+		j.err = fmt.Errorf("journal %s is broken: failed to sync: %w", j.file.Name(), err)
+		return j.err
+	}
+
+	j.size += int64(len(frame))
+	j.sequence = record.Sequence
+	apply(record)
+	return nil
+}
+
+// position returns the sequence of the last record and the size of the journal.
+func (j *journal) position() (uint64, int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sequence, j.size
+}
+
+// discardBefore removes the first offset bytes of the journal once they are contained in the
+// snapshot. The remaining records are copied into a new file that replaces the journal.
+func (j *journal) discardBefore(offset int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+
+	tail := make([]byte, j.size-offset)
+	if _, err := j.file.ReadAt(tail, offset); err != nil {
+		return fmt.Errorf("failed to read the journal: %w", err)
+	}
+	path := filepath.Join(j.dir, journalFile)
+	if err := writeFileSynced(path, tail); err != nil {
+		return fmt.Errorf("failed to rewrite the journal: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		j.err = fmt.Errorf("journal %s is broken: failed to reopen it: %w", path, err)
+		return j.err
+	}
+	j.file.Close()
+	j.file = file
+	j.size = int64(len(tail))
+	return nil
+}
+
+// ping checks that the journal accepts writes and is still present on disk.
+func (j *journal) ping() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	if _, err := os.Stat(j.file.Name()); err != nil {
+		return fmt.Errorf("journal was removed: %w", err)
+	}
+	return nil
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+func encodeRecord(record journalRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("journal record of %d bytes exceeds the limit of %d", len(payload), maxRecordSize)
+	}
+	frame := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, castagnoli))
+	return append(frame, payload...), nil
+}
+
+// readJournal decodes the records of a journal and returns them with the size of the intact
+// prefix. A crash while appending leaves an incomplete last record behind, the prefix ends
+// before it. A damaged record followed by more records is corruption and fails.
+func readJournal(data []byte) ([]journalRecord, int64, error) {
+	var records []journalRecord
+	var offset int64
+	for offset < int64(len(data)) {
+		record, size, err := decodeRecord(data[offset:])
+		if err != nil {
+			if isTorn(data[offset:], size, err) {
+				break
+			}
+			return nil, 0, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		if len(records) > 0 && record.Sequence != records[len(records)-1].Sequence+1 {
+			return nil, 0, fmt.Errorf("record at offset %d has sequence %d, expected %d",
+				offset, record.Sequence, records[len(records)-1].Sequence+1)
+		}
+		records = append(records, record)
+		offset += size
+	}
+	return records, offset, nil
+}
+
+// isTorn reports whether the damaged record at the start of data is the last append, cut
+// short by a crash. The file system may also have extended the file with zeros. A frame
+// running past the end is only torn if no intact record follows, a damaged length header
+// would otherwise hide all records after it.
+func isTorn(data []byte, size int64, err error) bool {
+	if isZero(data) || (size > 0 && isZero(data[size:])) {
+		return true
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false
+	}
+	for offset := 1; offset < len(data); offset++ {
+		if _, _, err := decodeRecord(data[offset:]); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeRecord decodes the record at the start of data and returns its framed size. The size
+// is 0 if the frame is incomplete or its length invalid.
+func decodeRecord(data []byte) (journalRecord, int64, error) {
+	if len(data) < recordHeaderSize {
+		return journalRecord{}, 0, io.ErrUnexpectedEOF
+	}
+	length := binary.BigEndian.Uint32(data[0:4])
+	size := recordHeaderSize + int64(length)
+	if length == 0 || length > maxRecordSize {
+		return journalRecord{}, 0, fmt.Errorf("invalid record length %d", length)
+	}
+	if size > int64(len(data)) {
+		return journalRecord{}, 0, io.ErrUnexpectedEOF
+	}
+	payload := data[recordHeaderSize:size]
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(data[4:8]) {
+		return journalRecord{}, size, errors.New("checksum mismatch")
+	}
+	var record journalRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return journalRecord{}, size, err
+	}
+	return record, size, nil
+}
+
+func isZero(data []byte) bool {
+	return len(bytes.Trim(data, "\x00")) == 0
+}
+
+// writeFileSynced replaces the file at path atomically: the content is written and synced to
+// a temporary file which is then renamed, and the rename is synced with the directory.
+func writeFileSynced(path string, content []byte) error {
+	temporary := path + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary, path)
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
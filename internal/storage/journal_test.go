@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+func openTestStorage(t *testing.T, dir string) (*Storage, Recovery) {
+	t.Helper()
+	stor, recovery, err := OpenStorage(dir)
+	if err != nil {
+		t.Fatalf("failed to open the storage: %v", err)
+	}
+	t.Cleanup(func() { stor.Close() })
+	return stor, recovery
+}
+
+func sign(t *testing.T, stor *Storage, deviceID string, count int) {
+	t.Helper()
+	service := app.NewAPIService(stor)
+	for i := 0; i < count; i++ {
+		request := domain.SignTransactionRequest{DeviceID: deviceID, Data: fmt.Sprintf("receipt %d", i)}
+		if _, err := service.SignTransaction(context.Background(), request); err != nil {
+			t.Fatalf("signing with %s failed: %v", deviceID, err)
+		}
+	}
+}
+
+// verifyChain checks that the device signed count times and that its history verifies,
+// including the next signature chained to the recovered last signature.
+func verifyChain(t *testing.T, stor *Storage, deviceID string, count int) {
+	t.Helper()
+	ctx := context.Background()
+	device, err := stor.GetDevice(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("device %s was not recovered: %v", deviceID, err)
+	}
+	if device.SignatureCounter != count {
+		t.Fatalf("device %s has counter %d, expected %d", deviceID, device.SignatureCounter, count)
+	}
+	sign(t, stor, deviceID, 1)
+	verifier, err := crypto.NewChainVerifier(deviceID, device.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err := stor.ListTransactions(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != count+1 {
+		t.Fatalf("device %s has %d transactions, expected %d", deviceID, len(transactions), count+1)
+	}
+	for _, transaction := range transactions {
+		if err := verifier.Verify(transaction.Counter, transaction.SignedData, transaction.Signature); err != nil {
+			t.Fatalf("chain of %s does not verify: %v", deviceID, err)
+		}
+	}
+}
+
+func createDevice(t *testing.T, stor *Storage, deviceID string) {
+	t.Helper()
+	request := domain.CreateDeviceRequest{ID: deviceID, Algorithm: domain.AlgorithmECC}
+	if _, err := app.NewAPIService(stor).CreateDevice(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func journalSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	stor, _ := openTestStorage(t, dir)
+	createDevice(t, stor, "till-1")
+	createDevice(t, stor, "till-2")
+	sign(t, stor, "till-1", 5)
+	sign(t, stor, "till-2", 2)
+	keys := app.NewKeyService(stor, []domain.APIKey{{ID: "configured", Hash: app.HashAPIKey("configured")}})
+	created, _, err := keys.CreateAPIKey(ctx, "till", []domain.Scope{domain.ScopeSign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, _ := keys.CreateAPIKey(ctx, "old till", []domain.Scope{domain.ScopeSign})
+	if err := keys.RevokeAPIKey(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	stor.Close()
+
+	stor, recovery := openTestStorage(t, dir)
+	if recovery.Records == 0 || recovery.Truncated != 0 {
+		t.Errorf("unexpected recovery %+v", recovery)
+	}
+	verifyChain(t, stor, "till-1", 5)
+	verifyChain(t, stor, "till-2", 2)
+	if _, err := stor.GetAPIKeyByHash(ctx, created.Hash); err != nil {
+		t.Errorf("created API key was not recovered: %v", err)
+	}
+	if _, err := stor.GetAPIKeyByHash(ctx, revoked.Hash); err == nil {
+		t.Error("revoked API key must stay revoked")
+	}
+	if _, err := stor.GetAPIKeyByHash(ctx, app.HashAPIKey("configured")); err == nil {
+		t.Error("configured API keys must not be journaled")
+	}
+}
+
+// TestJournalCrashRecovery cuts the last record at every kind of position a crash can leave
+// behind. The storage must recover the state before that record and keep journaling.
+func TestJournalCrashRecovery(t *testing.T) {
+	template := t.TempDir()
+	stor, _ := openTestStorage(t, template)
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 3)
+	before := journalSize(t, template)
+	createDevice(t, stor, "till-2")
+	after := journalSize(t, template)
+	stor.Close()
+	content, err := os.ReadFile(filepath.Join(template, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := os.ReadFile(filepath.Join(template, snapshotFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cuts := map[string][]byte{
+		"partial header":        content[:before+3],
+		"header only":           content[:before+recordHeaderSize],
+		"partial payload":       content[:before+(after-before)/2],
+		"missing last byte":     content[:after-1],
+		"zero filled":           append(append([]byte{}, content[:before+10]...), make([]byte, 4096)...),
+		"garbage after records": append(append([]byte{}, content[:before]...), 0xff, 0xff, 0xff),
+	}
+	for name, journal := range cuts {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, snapshotFile), snapshot, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, journalFile), journal, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			stor, recovery := openTestStorage(t, dir)
+			if recovery.Truncated != int64(len(journal))-before {
+				t.Errorf("expected %d bytes to be discarded, got %+v", int64(len(journal))-before, recovery)
+			}
+			if _, err := stor.GetDevice(context.Background(), "till-2"); err == nil {
+				t.Error("the device of the incomplete record must not be recovered")
+			}
+			verifyChain(t, stor, "till-1", 3)
+			stor.Close()
+
+			// The journal continues after the discarded record
+			stor, _ = openTestStorage(t, dir)
+			verifyChain(t, stor, "till-1", 4)
+		})
+	}
+}
+
+func TestJournalRejectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	stor, _ := openTestStorage(t, dir)
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 3)
+	stor.Close()
+
+	path := filepath.Join(dir, journalFile)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, damage := range map[string]func(content []byte){
+		"payload":      func(content []byte) { content[recordHeaderSize+10] ^= 1 },
+		"zero length":  func(content []byte) { copy(content[0:4], []byte{0, 0, 0, 0}) },
+		"long length":  func(content []byte) { content[1] ^= 1 },
+		"length > max": func(content []byte) { content[0] ^= 0x80 },
+		"short length": func(content []byte) { content[3]-- },
+	} {
+		damaged := bytes.Clone(content)
+		damage(damaged)
+		if err := os.WriteFile(path, damaged, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := OpenStorage(dir); err == nil {
+			t.Errorf("%s: a damaged record followed by others must be refused, not truncated", name)
+		}
+		if written, _ := os.ReadFile(path); !bytes.Equal(written, damaged) {
+			t.Errorf("%s: a refused journal must be left unchanged", name)
+		}
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	stor, _ := openTestStorage(t, dir)
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 5)
+	uncompacted, err := os.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size := journalSize(t, dir); size != 0 {
+		t.Errorf("expected an empty journal after compaction, got %d bytes", size)
+	}
+	sign(t, stor, "till-1", 2)
+	stor.Close()
+
+	stor, recovery := openTestStorage(t, dir)
+	if recovery.SnapshotSequence == 0 || recovery.Records != 2 {
+		t.Errorf("expected the snapshot and the records of 2 signatures, got %+v", recovery)
+	}
+	verifyChain(t, stor, "till-1", 7)
+	stor.Close()
+
+	// A crash after writing the snapshot leaves the compacted records in the journal
+	if err := os.WriteFile(filepath.Join(dir, journalFile), uncompacted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stor, recovery = openTestStorage(t, dir)
+	if recovery.Records != 0 {
+		t.Errorf("records contained in the snapshot must be skipped, got %+v", recovery)
+	}
+	verifyChain(t, stor, "till-1", 5)
+}
+
+func TestJournalCompactionWhileSigning(t *testing.T) {
+	dir := t.TempDir()
+	stor, _ := openTestStorage(t, dir)
+	createDevice(t, stor, "till-1")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service := app.NewAPIService(stor)
+		for i := 0; i < 50; i++ {
+			request := domain.SignTransactionRequest{DeviceID: "till-1", Data: "receipt"}
+			if _, err := service.SignTransaction(context.Background(), request); err != nil {
+				t.Errorf("signing failed: %v", err)
+				return
+			}
+		}
+	}()
+	for compacting := true; compacting; {
+		select {
+		case <-done:
+			compacting = false
+		default:
+			if err := stor.Compact(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	stor.Close()
+
+	stor, _ = openTestStorage(t, dir)
+	verifyChain(t, stor, "till-1", 50)
+}
@@ -0,0 +1,149 @@
+// Package migrate moves the persisted data of a storage backend between versions of its
+// schema. Every backend lists its migrations, records the version its data has and refuses to
+// open data of any other version than the latest one it knows.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Latest targets the version of the newest migration a backend knows.
+const Latest = -1
+
+var (
+	// ErrOutdated is returned when opening data of an older version, it must be migrated first.
+	ErrOutdated = errors.New("storage schema is outdated")
+	// ErrUnknownVersion is returned for versions no migration of this build leads to, e.g. of
+	// data migrated by a newer build.
+	ErrUnknownVersion = errors.New("storage schema version is unknown")
+)
+
+// Direction is the way a migration is applied in.
+type Direction string
+
+const (
+	Up   Direction = "up"
+	Down Direction = "down"
+)
+
+// Migration changes the data of a backend from Version-1 to Version, or back. Versions count
+// up from 1, 0 is the data before the first migration.
+type Migration struct {
+	Version int
+	Name    string
+}
+
+// Step applies a migration in one direction.
+type Step struct {
+	Migration
+	Direction Direction
+}
+
+// Target returns the version the data has after the step.
+func (s Step) Target() int {
+	if s.Direction == Down {
+		return s.Version - 1
+	}
+	return s.Version
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%s %d %s", s.Direction, s.Version, s.Name)
+}
+
+// Schema is the persisted data of a backend.
+type Schema interface {
+	// Migrations lists the migrations of the backend ordered by version.
+	Migrations() []Migration
+	// Version returns the version of the data.
+	Version(ctx context.Context) (int, error)
+	// Apply runs a step and records its target version, if possible atomically.
+	Apply(ctx context.Context, step Step) error
+}
+
+// Result describes a migration.
+type Result struct {
+	From    int    // Version before the migration
+	To      int    // Version the steps lead to
+	Latest  int    // Version of the newest migration
+	Steps   []Step // Planned steps in order
+	Applied int    // Steps applied, fewer than planned for dry runs and failed migrations
+}
+
+// Plan returns the steps leading from version from to version to of migrations.
+func Plan(migrations []Migration, from, to int) ([]Step, error) {
+	latest := len(migrations)
+	if to == Latest {
+		to = latest
+	}
+	for _, version := range []int{from, to} {
+		if version < 0 || version > latest {
+			return nil, fmt.Errorf("%w: version %d, this build knows up to %d", ErrUnknownVersion, version, latest)
+		}
+	}
+
+	var steps []Step
+	for version := from + 1; version <= to; version++ {
+		steps = append(steps, Step{Migration: migrations[version-1], Direction: Up})
+	}
+	for version := from; version > to; version-- {
+		steps = append(steps, Step{Migration: migrations[version-1], Direction: Down})
+	}
+	return steps, nil
+}
+
+// Run migrates the data of schema to version to, or to the latest version for Latest. A dry
+// run only plans the steps. A failed step ends the migration, the data keeps the version
+// of the last step applied.
+func Run(ctx context.Context, schema Schema, to int, dryRun bool) (Result, error) {
+	migrations := schema.Migrations()
+	if err := validate(migrations); err != nil {
+		return Result{}, err
+	}
+	from, err := schema.Version(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	steps, err := Plan(migrations, from, to)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{From: from, To: from, Latest: len(migrations), Steps: steps}
+	if len(steps) > 0 {
+		result.To = steps[len(steps)-1].Target()
+	}
+	if dryRun {
+		return result, nil
+	}
+	for _, step := range steps {
+		if err := schema.Apply(ctx, step); err != nil {
+			return result, fmt.Errorf("migration %s failed: %w", step, err)
+		}
+		result.Applied++
+	}
+	return result, nil
+}
+
+// Check fails with ErrOutdated or ErrUnknownVersion unless version is the latest of migrations.
+func Check(migrations []Migration, version int) error {
+	latest := len(migrations)
+	switch {
+	case version < latest:
+		return fmt.Errorf("%w: version %d, the latest is %d, run `signer migrate`", ErrOutdated, version, latest)
+	case version > latest:
+		return fmt.Errorf("%w: version %d, this build knows up to %d", ErrUnknownVersion, version, latest)
+	}
+	return nil
+}
+
+func validate(migrations []Migration) error {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, expected %d", migration.Name, migration.Version, i+1)
+		}
+	}
+	return nil
+}
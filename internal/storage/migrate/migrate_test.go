@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeSchema records the applied steps and fails the step of version failAt.
+type fakeSchema struct {
+	version int
+	applied []string
+	failAt  int
+}
+
+func (s *fakeSchema) Migrations() []Migration {
+	return []Migration{{1, "initial"}, {2, "device_status"}, {3, "key_version"}}
+}
+
+func (s *fakeSchema) Version(context.Context) (int, error) {
+	return s.version, nil
+}
+
+func (s *fakeSchema) Apply(_ context.Context, step Step) error {
+	if step.Version == s.failAt {
+		return errors.New("broken")
+	}
+	s.applied = append(s.applied, step.String())
+	s.version = step.Target()
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	schema := &fakeSchema{version: 1}
+	result, err := Run(ctx, schema, Latest, true)
+	if err != nil || result.From != 1 || result.To != 3 || len(result.Steps) != 2 || result.Applied != 0 {
+		t.Fatalf("unexpected dry run %+v, %v", result, err)
+	}
+	if schema.version != 1 || len(schema.applied) != 0 {
+		t.Fatal("a dry run must not change the schema")
+	}
+
+	if result, err = Run(ctx, schema, Latest, false); err != nil || result.Applied != 2 {
+		t.Fatalf("unexpected migration %+v, %v", result, err)
+	}
+	if result, err = Run(ctx, schema, 1, false); err != nil || result.To != 1 {
+		t.Fatalf("unexpected migration %+v, %v", result, err)
+	}
+	expected := []string{"up 2 device_status", "up 3 key_version", "down 3 key_version", "down 2 device_status"}
+	if !reflect.DeepEqual(schema.applied, expected) {
+		t.Errorf("applied %v, expected %v", schema.applied, expected)
+	}
+	if result, err = Run(ctx, schema, 1, false); err != nil || len(result.Steps) != 0 {
+		t.Errorf("migrating to the current version must do nothing, got %+v, %v", result, err)
+	}
+}
+
+func TestRunStopsAtFailedStep(t *testing.T) {
+	schema := &fakeSchema{failAt: 2}
+	result, err := Run(context.Background(), schema, Latest, false)
+	if err == nil || result.Applied != 1 || schema.version != 1 {
+		t.Errorf("a failed step must end the migration, got %+v, %v at version %d", result, err, schema.version)
+	}
+}
+
+func TestUnknownVersions(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Run(ctx, &fakeSchema{}, 4, false); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion for an unknown target, got %v", err)
+	}
+	if _, err := Run(ctx, &fakeSchema{version: 5}, Latest, false); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion for a newer schema, got %v", err)
+	}
+
+	migrations := (&fakeSchema{}).Migrations()
+	if err := Check(migrations, 3); err != nil {
+		t.Errorf("the latest version must pass, got %v", err)
+	}
+	if err := Check(migrations, 2); !errors.Is(err, ErrOutdated) {
+		t.Errorf("expected ErrOutdated, got %v", err)
+	}
+	if err := Check(migrations, 4); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+}
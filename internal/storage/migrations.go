@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+)
+
+// journalMigration changes the journaled state between two schema versions. The functions
+// transform the state in place, nil leaves it unchanged.
+type journalMigration struct {
+	migrate.Migration
+	up, down func(state *domain.Snapshot) error
+}
+
+// journalMigrations lists the schema versions of the journaled state. Migrating rewrites the
+// snapshot, so journal records are only ever read by the version that wrote them. Released
+// migrations must never change, add a new one instead.
+var journalMigrations = []journalMigration{
+	// Records the version in the snapshot, directories of earlier builds have none
+	{Migration: migrate.Migration{Version: 1, Name: "record_schema_version"}},
+}
+
+func journalSchemaMigrations() []migrate.Migration {
+	migrations := make([]migrate.Migration, 0, len(journalMigrations))
+	for _, migration := range journalMigrations {
+		migrations = append(migrations, migration.Migration)
+	}
+	return migrations
+}
+
+// MigrateJournal migrates the storage in dir to schema version to, or to the latest version
+// for migrate.Latest. The storage must not be open. A dry run only plans the steps.
+func MigrateJournal(ctx context.Context, dir string, to int, dryRun bool) (migrate.Result, error) {
+	loaded, err := load(dir)
+	if err != nil {
+		return migrate.Result{}, err
+	}
+	version := loaded.version
+	if loaded.fresh {
+		version = len(journalMigrations)
+	}
+	state, err := loaded.storage.Snapshot(ctx)
+	if err != nil {
+		return migrate.Result{}, err
+	}
+	if !dryRun {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return migrate.Result{}, fmt.Errorf("failed to create the storage directory: %w", err)
+		}
+	}
+	schema := &journalSchema{dir: dir, version: version, sequence: loaded.sequence, state: state}
+	return migrate.Run(ctx, schema, to, dryRun)
+}
+
+// journalSchema is the state of a storage directory being migrated.
+type journalSchema struct {
+	dir      string
+	version  int
+	sequence uint64 // Last record contained in state
+	state    domain.Snapshot
+}
+
+func (s *journalSchema) Migrations() []migrate.Migration {
+	return journalSchemaMigrations()
+}
+
+func (s *journalSchema) Version(context.Context) (int, error) {
+	return s.version, nil
+}
+
+// Apply transforms the state and replaces the snapshot with it, then empties the journal. A
+// crash in between leaves records behind that the snapshot contains, they are skipped.
+func (s *journalSchema) Apply(_ context.Context, step migrate.Step) error {
+	migration := journalMigrations[step.Version-1]
+	transform := migration.up
+	if step.Direction == migrate.Down {
+		transform = migration.down
+	}
+	if transform != nil {
+		if err := transform(&s.state); err != nil {
+			return err
+		}
+	}
+	snapshot := journalSnapshot{Sequence: s.sequence, Version: step.Target(), State: s.state}
+	if err := writeSnapshot(s.dir, snapshot); err != nil {
+		return fmt.Errorf("failed to write the snapshot: %w", err)
+	}
+	if err := writeFileSynced(filepath.Join(s.dir, journalFile), nil); err != nil {
+		return fmt.Errorf("failed to empty the journal: %w", err)
+	}
+	s.version = step.Target()
+	return nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+)
+
+// withLabelMigration adds a migration labeling every device for the duration of the test.
+func withLabelMigration(t *testing.T) {
+	original := journalMigrations
+	t.Cleanup(func() { journalMigrations = original })
+	label := func(value string) func(*domain.Snapshot) error {
+		return func(state *domain.Snapshot) error {
+			for i := range state.Devices {
+				state.Devices[i].Label = value
+			}
+			return nil
+		}
+	}
+	journalMigrations = append(original[:len(original):len(original)], journalMigration{
+		Migration: migrate.Migration{Version: len(original) + 1, Name: "label_devices"},
+		up:        label("migrated"),
+		down:      label(""),
+	})
+}
+
+func TestMigrateJournal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	stor, _ := openTestStorage(t, dir)
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 3)
+	stor.Close()
+	withLabelMigration(t)
+
+	if _, _, err := OpenStorage(dir); !errors.Is(err, migrate.ErrOutdated) {
+		t.Fatalf("an outdated storage must be refused, got %v", err)
+	}
+	result, err := MigrateJournal(ctx, dir, migrate.Latest, true)
+	if err != nil || result.From != 1 || result.To != 2 || len(result.Steps) != 1 || result.Applied != 0 {
+		t.Fatalf("unexpected dry run %+v, %v", result, err)
+	}
+	if _, _, err := OpenStorage(dir); !errors.Is(err, migrate.ErrOutdated) {
+		t.Fatalf("a dry run must not migrate, got %v", err)
+	}
+
+	if result, err = MigrateJournal(ctx, dir, migrate.Latest, false); err != nil || result.Applied != 1 {
+		t.Fatalf("unexpected migration %+v, %v", result, err)
+	}
+	if journalSize(t, dir) != 0 {
+		t.Error("the journal must be moved into the snapshot")
+	}
+	stor, _ = openTestStorage(t, dir)
+	if device, _ := stor.GetDevice(ctx, "till-1"); device.Label != "migrated" {
+		t.Errorf("the migration was not applied to %+v", device)
+	}
+	verifyChain(t, stor, "till-1", 3)
+	stor.Close()
+
+	if result, err = MigrateJournal(ctx, dir, 1, false); err != nil || result.To != 1 {
+		t.Fatalf("unexpected migration %+v, %v", result, err)
+	}
+	if _, _, err := OpenStorage(dir); !errors.Is(err, migrate.ErrOutdated) {
+		t.Errorf("a storage migrated down must be refused, got %v", err)
+	}
+}
+
+func TestMigrateUnversionedJournal(t *testing.T) {
+	ctx := context.Background()
+	template := t.TempDir()
+	stor, _ := openTestStorage(t, template)
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 2)
+	stor.Close()
+
+	// Earlier builds wrote no snapshot until the first compaction
+	dir := t.TempDir()
+	content, err := os.ReadFile(filepath.Join(template, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, journalFile), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenStorage(dir); !errors.Is(err, migrate.ErrOutdated) {
+		t.Fatalf("a storage without a version must be refused, got %v", err)
+	}
+	result, err := MigrateJournal(ctx, dir, migrate.Latest, false)
+	if err != nil || result.From != 0 || result.To != len(journalMigrations) {
+		t.Fatalf("unexpected migration %+v, %v", result, err)
+	}
+	stor, _ = openTestStorage(t, dir)
+	verifyChain(t, stor, "till-1", 2)
+}
+
+func TestJournalRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeSnapshot(dir, journalSnapshot{Version: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenStorage(dir); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("a storage migrated by a newer build must be refused, got %v", err)
+	}
+	if _, err := MigrateJournal(context.Background(), dir, migrate.Latest, false); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("a storage migrated by a newer build must not be migrated, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyColumns = `hash, id, tenant_id, name, scopes, created_at`
+
+// scanAPIKey reads a row of apiKeyColumns.
+func scanAPIKey(row pgx.Row) (domain.APIKey, error) {
+	var key domain.APIKey
+	var scopes []string
+	err := row.Scan(&key.Hash, &key.ID, &key.TenantID, &key.Name, &scopes, &key.CreatedAt)
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, domain.Scope(scope))
+	}
+	key.CreatedAt = key.CreatedAt.UTC()
+	return key, err
+}
+
+// scopeNames converts scopes for the scopes column.
+func scopeNames(scopes []domain.Scope) []string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return names
+}
+
+// AddAPIKey stores an API key under its hash. Configured keys are kept in memory only.
+func (s *Storage) AddAPIKey(ctx context.Context, key domain.APIKey) error {
+	if key.Configured {
+		s.configured.Set(key.Hash, key)
+		return nil
+	}
+	_, err := s.pool.Exec(ctx, `INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (hash) DO UPDATE SET id = $2, tenant_id = $3, name = $4, scopes = $5, created_at = $6`,
+		key.Hash, key.ID, key.TenantID, key.Name, scopeNames(key.Scopes), key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store API key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash.
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	if key, found := s.configured.Get(hash); found {
+		return key, nil
+	}
+	key, err := scanAPIKey(s.pool.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = $1`, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return domain.APIKey{}, fmt.Errorf("failed to look up an API key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the API keys of the request's tenant ordered by ID.
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	tenantID := domain.TenantFromContext(ctx)
+	rows, err := s.pool.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	keys, err := collect(rows, scanAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	for _, key := range s.configured.Values() {
+		if key.TenantID == tenantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// DeleteAPIKey removes the API key of the request's tenant with the given ID.
+func (s *Storage) DeleteAPIKey(ctx context.Context, id string) error {
+	tenantID := domain.TenantFromContext(ctx)
+	for _, key := range s.configured.Values() {
+		if key.ID == id && key.TenantID == tenantID {
+			s.configured.Delete(key.Hash)
+			return nil
+		}
+	}
+	result, err := s.pool.Exec(ctx, "DELETE FROM api_keys WHERE tenant_id = $1 AND id = $2", tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key %s: %w", id, err)
+	}
+	if result.RowsAffected() == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
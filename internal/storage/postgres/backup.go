@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Snapshot copies the devices, transactions and API keys of all tenants as of one point in
+// time. Signing continues while the copy is taken.
+func (s *Storage) Snapshot(ctx context.Context) (domain.Snapshot, error) {
+	ctx, span := tracer.Start(ctx, "Storage.Snapshot")
+	defer span.End()
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return domain.Snapshot{}, err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	var snapshot domain.Snapshot
+	rows, err := tx.Query(ctx, `SELECT `+deviceColumns+` FROM devices ORDER BY tenant_id, id`)
+	if err != nil {
+		return domain.Snapshot{}, fmt.Errorf("failed to copy the devices: %w", err)
+	}
+	if snapshot.Devices, err = collect(rows, scanDevice); err != nil {
+		return domain.Snapshot{}, fmt.Errorf("failed to copy the devices: %w", err)
+	}
+	rows, err = tx.Query(ctx, `SELECT `+transactionColumns+` FROM transactions ORDER BY tenant_id, device_id, counter`)
+	if err != nil {
+		return domain.Snapshot{}, fmt.Errorf("failed to copy the signatures: %w", err)
+	}
+	if snapshot.Transactions, err = collect(rows, scanTransaction); err != nil {
+		return domain.Snapshot{}, fmt.Errorf("failed to copy the signatures: %w", err)
+	}
+	rows, err = tx.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys`)
+	if err != nil {
+		return domain.Snapshot{}, fmt.Errorf("failed to copy the API keys: %w", err)
+	}
+	if snapshot.APIKeys, err = collect(rows, scanAPIKey); err != nil {
+		return domain.Snapshot{}, fmt.Errorf("failed to copy the API keys: %w", err)
+	}
+	snapshot.APIKeys = append(snapshot.APIKeys, s.configured.Values()...)
+	sort.Slice(snapshot.APIKeys, func(i, j int) bool { return snapshot.APIKeys[i].Hash < snapshot.APIKeys[j].Hash })
+	return snapshot, nil
+}
+
+// Restore adds the devices, transactions and API keys of a snapshot. Devices that exist
+// already are brought forward to the state of the snapshot if they use the same key, the
+// restore fails with domain.ErrCounterRollback if one has signed more than the snapshot
+// knows of or if its signatures differ from the snapshot's. Nothing is changed if the
+// restore fails. The snapshot must be consistent, with the transactions of every device
+// complete and ordered by counter.
+func (s *Storage) Restore(ctx context.Context, snapshot domain.Snapshot) (domain.RestoreSummary, error) {
+	ctx, span := tracer.Start(ctx, "Storage.Restore")
+	defer span.End()
+
+	histories := make(map[cache.DeviceKey][]domain.Transaction, len(snapshot.Devices))
+	for _, transaction := range snapshot.Transactions {
+		key := cache.DeviceKey{TenantID: transaction.TenantID, DeviceID: transaction.DeviceID}
+		histories[key] = append(histories[key], transaction)
+	}
+	// Lock the rows in one order so concurrent restores cannot deadlock
+	devices := append([]domain.SignatureDevice(nil), snapshot.Devices...)
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].TenantID != devices[j].TenantID {
+			return devices[i].TenantID < devices[j].TenantID
+		}
+		return devices[i].ID < devices[j].ID
+	})
+
+	var summary domain.RestoreSummary
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		// Signatures committed meanwhile conflict with the locked counters and are signed again
+		batch := &pgx.Batch{}
+		for _, device := range devices {
+			var publicKey []byte
+			var counter int
+			err := tx.QueryRow(ctx, `SELECT public_key, signature_counter FROM devices
+				WHERE tenant_id = $1 AND id = $2 FOR UPDATE`, device.TenantID, device.ID).Scan(&publicKey, &counter)
+			found := err == nil
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("failed to lock device %s: %w", device.ID, err)
+			}
+			if found && !bytes.Equal(publicKey, device.PublicKey) {
+				return fmt.Errorf("%w: device %q of tenant %q uses a different key",
+					domain.ErrDeviceExists, device.ID, device.TenantID)
+			}
+			if found && counter > device.SignatureCounter {
+				return fmt.Errorf("%w: device %q of tenant %q has signed %d times, the backup %d times",
+					domain.ErrCounterRollback, device.ID, device.TenantID, counter, device.SignatureCounter)
+			}
+			if found && counter == device.SignatureCounter {
+				summary.SkippedDevices++
+				continue
+			}
+			history := histories[cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}]
+			if found && counter > 0 {
+				if err := checkForked(ctx, tx, device, history); err != nil {
+					return err
+				}
+			}
+
+			summary.Devices++
+			batch.Queue(`INSERT INTO devices (`+deviceColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+				ON CONFLICT (tenant_id, id) DO UPDATE SET label = $6, metadata = $7, signature_counter = $8,
+				last_signature = $9, version = $10, disabled = $11`,
+				device.TenantID, device.ID, string(device.Algorithm), device.PublicKey, device.PrivateKey, device.Label,
+				device.Metadata, device.SignatureCounter, []byte(device.LastSignature), device.Version, device.Disabled)
+			for _, transaction := range history {
+				batch.Queue(`INSERT INTO transactions (`+transactionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)
+					ON CONFLICT DO NOTHING`,
+					transaction.TenantID, transaction.DeviceID, transaction.Counter, []byte(transaction.Data),
+					[]byte(transaction.SignedData), transaction.Signature, transaction.CreatedAt,
+				).Exec(func(tag pgconn.CommandTag) error {
+					summary.Transactions += int(tag.RowsAffected())
+					return nil
+				})
+			}
+		}
+		for _, apiKey := range snapshot.APIKeys {
+			// Configured keys belong to the configuration of the instance the backup was taken on
+			if _, found := s.configured.Get(apiKey.Hash); found || apiKey.Configured {
+				continue
+			}
+			batch.Queue(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`,
+				apiKey.Hash, apiKey.ID, apiKey.TenantID, apiKey.Name, scopeNames(apiKey.Scopes), apiKey.CreatedAt,
+			).Exec(func(tag pgconn.CommandTag) error {
+				summary.APIKeys += int(tag.RowsAffected())
+				return nil
+			})
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to restore the snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.RestoreSummary{}, err
+	}
+	return summary, nil
+}
+
+// checkForked fails with domain.ErrCounterRollback unless the stored history of a device is a
+// prefix of the restored one. Signatures of a history forked from the snapshot's were handed
+// out, the snapshot's chain would not contain them.
+func checkForked(ctx context.Context, tx pgx.Tx, device domain.SignatureDevice, restored []domain.Transaction) error {
+	rows, err := tx.Query(ctx, `SELECT counter, signature FROM transactions
+		WHERE tenant_id = $1 AND device_id = $2 ORDER BY counter`, device.TenantID, device.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read the signatures of device %s: %w", device.ID, err)
+	}
+	defer rows.Close()
+	var counter int
+	var signature []byte
+	for rows.Next() {
+		if err := rows.Scan(&counter, &signature); err != nil {
+			return fmt.Errorf("failed to read the signatures of device %s: %w", device.ID, err)
+		}
+		if counter >= len(restored) || !bytes.Equal(signature, restored[counter].Signature) {
+			return fmt.Errorf("%w: signature %d of device %q of tenant %q differs from the backup",
+				domain.ErrCounterRollback, counter, device.ID, device.TenantID)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+const deviceColumns = `tenant_id, id, algorithm, public_key, private_key, label, metadata,
+	signature_counter, last_signature, version, disabled`
+
+// deviceKey scopes a device ID to the tenant of the request.
+func deviceKey(ctx context.Context, deviceID string) cache.DeviceKey {
+	return cache.DeviceKey{TenantID: domain.TenantFromContext(ctx), DeviceID: deviceID}
+}
+
+// scanDevice reads a row of deviceColumns.
+func scanDevice(row pgx.Row) (domain.SignatureDevice, error) {
+	var device domain.SignatureDevice
+	var algorithm string
+	var lastSignature []byte
+	err := row.Scan(&device.TenantID, &device.ID, &algorithm, &device.PublicKey, &device.PrivateKey, &device.Label,
+		&device.Metadata, &device.SignatureCounter, &lastSignature, &device.Version, &device.Disabled)
+	device.Algorithm = domain.Algorithm(algorithm)
+	device.LastSignature = string(lastSignature)
+	return device, err
+}
+
+// AddDevice adds a new signature device to the storage of its tenant. It fails with
+// domain.ErrDeviceExists if the tenant has a device with the same ID.
+func (s *Storage) AddDevice(ctx context.Context, device domain.SignatureDevice) error {
+	ctx, span := tracer.Start(ctx, "Storage.AddDevice")
+	defer span.End()
+
+	token, _ := domain.FencingTokenFromContext(ctx)
+	result, err := s.pool.Exec(ctx, `INSERT INTO devices (`+deviceColumns+`, fence)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) ON CONFLICT DO NOTHING`,
+		device.TenantID, device.ID, string(device.Algorithm), device.PublicKey, device.PrivateKey, device.Label,
+		device.Metadata, device.SignatureCounter, []byte(device.LastSignature), device.Version, device.Disabled, int64(token))
+	if err != nil {
+		return fmt.Errorf("failed to add device %s: %w", device.ID, err)
+	}
+	if result.RowsAffected() == 0 {
+		return domain.ErrDeviceExists
+	}
+	return nil
+}
+
+// UpdateDevice stores the label, metadata, status and version of a device if the stored
+// device still has expectedVersion, otherwise it fails with domain.ErrVersionMismatch. The
+// signature counter and last signature of the stored device are kept.
+func (s *Storage) UpdateDevice(ctx context.Context, device domain.SignatureDevice, expectedVersion int) error {
+	ctx, span := tracer.Start(ctx, "Storage.UpdateDevice")
+	defer span.End()
+
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+		stored, err := lockDevice(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if stored.version != expectedVersion {
+			return domain.ErrVersionMismatch
+		}
+		_, err = tx.Exec(ctx, `UPDATE devices SET label = $3, metadata = $4, disabled = $5, version = $6
+			WHERE tenant_id = $1 AND id = $2`,
+			key.TenantID, key.DeviceID, device.Label, device.Metadata, device.Disabled, device.Version)
+		if err != nil {
+			return fmt.Errorf("failed to update device %s: %w", device.ID, err)
+		}
+		return nil
+	})
+}
+
+// GetDevice retrieves a signature device of the request's tenant from the storage.
+func (s *Storage) GetDevice(ctx context.Context, id string) (domain.SignatureDevice, error) {
+	ctx, span := tracer.Start(ctx, "Storage.GetDevice")
+	defer span.End()
+
+	key := deviceKey(ctx, id)
+	device, err := scanDevice(s.pool.QueryRow(ctx, `SELECT `+deviceColumns+` FROM devices
+		WHERE tenant_id = $1 AND id = $2`, key.TenantID, key.DeviceID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.SignatureDevice{}, domain.ErrDeviceNotFound
+	}
+	if err != nil {
+		return domain.SignatureDevice{}, fmt.Errorf("failed to get device %s: %w", id, err)
+	}
+	return device, nil
+}
+
+// ListDevices returns the signature devices of the request's tenant ordered by ID.
+func (s *Storage) ListDevices(ctx context.Context) ([]domain.SignatureDevice, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE tenant_id = $1 ORDER BY id`,
+		domain.TenantFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	devices, err := collect(rows, scanDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
+// CountDevices returns the number of devices of all tenants, or 0 if the database is
+// unreachable.
+func (s *Storage) CountDevices(ctx context.Context) int {
+	var count int
+	if err := s.pool.QueryRow(ctx, "SELECT count(*) FROM devices").Scan(&count); err != nil {
+		return 0
+	}
+	return count
+}
+
+func (s *Storage) LockDevice(ctx context.Context, deviceID string) {
+	_, span := tracer.Start(ctx, "Storage.LockDevice")
+	defer span.End()
+
+	s.locks.Lock(deviceKey(ctx, deviceID))
+}
+
+func (s *Storage) UnlockDevice(ctx context.Context, deviceID string) {
+	s.locks.Unlock(deviceKey(ctx, deviceID))
+}
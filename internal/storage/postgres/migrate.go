@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationFiles holds the schema changes, named <version>_<name>.up.sql and
+// <version>_<name>.down.sql with versions counting up from 1. Released migrations must never
+// change, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock migrations run under, "signer" in ASCII.
+const migrationLock = 0x7369676e6572
+
+type migration struct {
+	migrate.Migration
+	up, down string
+}
+
+// loadMigrations returns the embedded migrations ordered by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration, len(entries))
+	for _, entry := range entries {
+		base, direction, _ := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		prefix, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version", entry.Name())
+		}
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		current, found := byVersion[version]
+		if !found {
+			current = &migration{Migration: migrate.Migration{Version: version, Name: name}}
+			byVersion[version] = current
+		}
+		switch {
+		case current.Name != name:
+			return nil, fmt.Errorf("migrations %s and %s share version %d", current.Name, name, version)
+		case direction == string(migrate.Up):
+			current.up = string(sql)
+		case direction == string(migrate.Down):
+			current.down = string(sql)
+		default:
+			return nil, fmt.Errorf("migration %s is neither up nor down", entry.Name())
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs an up and a down file", migration.Version, migration.Name)
+		}
+	}
+	return migrations, nil
+}
+
+func schemaMigrations(migrations []migration) []migrate.Migration {
+	result := make([]migrate.Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		result = append(result, migration.Migration)
+	}
+	return result
+}
+
+// Migrate migrates the database schema to version to, or to the latest version for
+// migrate.Latest, each step in its own transaction. Migrations run under an advisory lock,
+// instances starting at the same time migrate one after the other. A dry run only plans the
+// steps.
+func Migrate(ctx context.Context, config *pgxpool.Config, to int, dryRun bool) (migrate.Result, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return migrate.Result{}, err
+	}
+	conn, err := pgx.ConnectConfig(ctx, config.ConnConfig)
+	if err != nil {
+		return migrate.Result{}, err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return migrate.Result{}, fmt.Errorf("failed to lock the schema: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	return migrate.Run(ctx, &schema{conn: conn, migrations: migrations}, to, dryRun)
+}
+
+// checkSchema fails unless the schema has the latest version.
+func checkSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	version, err := schemaVersion(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	if err := migrate.Check(schemaMigrations(migrations), version); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	return nil
+}
+
+// schemaVersion returns the latest version recorded in schema_migrations, 0 for databases
+// never migrated.
+func schemaVersion(ctx context.Context, db interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}) (int, error) {
+	var migrated bool
+	if err := db.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&migrated); err != nil || !migrated {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// schema migrates a database over a connection holding migrationLock.
+type schema struct {
+	conn       *pgx.Conn
+	migrations []migration
+}
+
+func (s *schema) Migrations() []migrate.Migration {
+	return schemaMigrations(s.migrations)
+}
+
+func (s *schema) Version(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, s.conn)
+}
+
+// Apply runs the SQL of the step and records the version in the same transaction.
+func (s *schema) Apply(ctx context.Context, step migrate.Step) error {
+	migration := s.migrations[step.Version-1]
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	_, err = tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create the schema_migrations table: %w", err)
+	}
+	if step.Direction == migrate.Up {
+		if _, err := tx.Exec(ctx, migration.up); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	} else {
+		if _, err := tx.Exec(ctx, migration.down); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the schema version: %w", err)
+	}
+	return tx.Commit(ctx)
+}
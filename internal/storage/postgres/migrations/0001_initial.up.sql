@@ -0,0 +1,39 @@
+CREATE TABLE devices (
+	tenant_id         TEXT NOT NULL,
+	id                TEXT NOT NULL,
+	algorithm         TEXT NOT NULL,
+	public_key        BYTEA NOT NULL,
+	private_key       BYTEA NOT NULL,
+	label             TEXT NOT NULL,
+	metadata          JSONB,
+	signature_counter INTEGER NOT NULL,
+	last_signature    BYTEA NOT NULL,
+	version           INTEGER NOT NULL,
+	disabled          BOOLEAN NOT NULL,
+	-- Highest fencing token the device was written with
+	fence             BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, id)
+);
+
+CREATE TABLE transactions (
+	tenant_id   TEXT NOT NULL,
+	device_id   TEXT NOT NULL,
+	counter     INTEGER NOT NULL,
+	data        BYTEA NOT NULL,
+	signed_data BYTEA NOT NULL,
+	signature   BYTEA NOT NULL,
+	created_at  TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant_id, device_id, counter),
+	FOREIGN KEY (tenant_id, device_id) REFERENCES devices (tenant_id, id)
+);
+
+CREATE TABLE api_keys (
+	hash       TEXT PRIMARY KEY,
+	id         TEXT NOT NULL,
+	tenant_id  TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	scopes     TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX api_keys_tenant_id ON api_keys (tenant_id, id);
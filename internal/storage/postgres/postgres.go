@@ -0,0 +1,114 @@
+// Package postgres stores devices, signatures and API keys in a PostgreSQL database shared by
+// all instances of the service. Conditional writes lock the device row with SELECT ... FOR
+// UPDATE, so concurrent instances cannot advance a counter twice.
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/crypto"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	pkgcache "github.com/ashermp9/fiskaly-test-task/pkg/cache"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("github.com/ashermp9/fiskaly-test-task/internal/storage/postgres")
+
+type Storage struct {
+	pool      *pgxpool.Pool
+	cryptoMgr *crypto.CryptoManager
+	// Device locks exclude the requests of this instance only, see app.WithLeases
+	locks *pkgcache.Cache[cache.DeviceKey, struct{}]
+	// Configured API keys by hash, they are kept in memory only like in every storage
+	configured *pkgcache.Cache[string, domain.APIKey]
+}
+
+// Open connects to the database. Its schema must have the latest version, see Migrate.
+func Open(ctx context.Context, config *pgxpool.Config) (*Storage, error) {
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &Storage{
+		pool:       pool,
+		cryptoMgr:  crypto.NewCryptoManager(),
+		locks:      pkgcache.NewCache[cache.DeviceKey, struct{}](),
+		configured: pkgcache.NewCache[string, domain.APIKey](),
+	}, nil
+}
+
+// Ping checks that the database is reachable.
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// Close closes all connections. The storage must not be used afterwards.
+func (s *Storage) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+// SetCryptoPolicy restricts the keys generated for new devices.
+func (s *Storage) SetCryptoPolicy(policy crypto.Policy) error {
+	return s.cryptoMgr.SetPolicy(policy)
+}
+
+// inTx runs fn in a transaction committed if fn succeeds.
+func (s *Storage) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// collect reads all rows with scan.
+func collect[T any](rows pgx.Rows, scan func(pgx.Row) (T, error)) ([]T, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (T, error) { return scan(row) })
+}
+
+// lockedDevice is the part of a device row conditional writes check.
+type lockedDevice struct {
+	counter int
+	version int
+}
+
+// lockDevice locks the row of a device until tx ends. It rejects writes under a lease that
+// was granted to another instance since, see domain.ContextWithFencingToken, and records the
+// request's token otherwise.
+func lockDevice(ctx context.Context, tx pgx.Tx, key cache.DeviceKey) (lockedDevice, error) {
+	var device lockedDevice
+	var fence int64
+	err := tx.QueryRow(ctx, `SELECT signature_counter, version, fence FROM devices
+		WHERE tenant_id = $1 AND id = $2 FOR UPDATE`, key.TenantID, key.DeviceID).Scan(&device.counter, &device.version, &fence)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return lockedDevice{}, domain.ErrDeviceNotFound
+	}
+	if err != nil {
+		return lockedDevice{}, fmt.Errorf("failed to lock device %s: %w", key.DeviceID, err)
+	}
+
+	token, ok := domain.FencingTokenFromContext(ctx)
+	if !ok || uint64(fence) == token {
+		return device, nil
+	}
+	if token < uint64(fence) {
+		return lockedDevice{}, domain.ErrLeaseExpired
+	}
+	_, err = tx.Exec(ctx, "UPDATE devices SET fence = $3 WHERE tenant_id = $1 AND id = $2",
+		key.TenantID, key.DeviceID, int64(token))
+	return device, err
+}
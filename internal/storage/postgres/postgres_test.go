@@ -0,0 +1,348 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage/migrate"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// These tests need a database in SIGNER_TEST_POSTGRES_URL and are skipped without one,
+// `make test-postgres` runs them against a database started in Docker. Every test works in a
+// schema of its own that is dropped afterwards.
+
+// newTestSchema creates an empty schema and returns a pool configuration using it.
+func newTestSchema(t *testing.T) *pgxpool.Config {
+	t.Helper()
+	url := os.Getenv("SIGNER_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("SIGNER_TEST_POSTGRES_URL is not set")
+	}
+	ctx := context.Background()
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	schema := "signer_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	return config
+}
+
+func openTestStorage(t *testing.T, config *pgxpool.Config) *Storage {
+	t.Helper()
+	if _, err := Migrate(context.Background(), config.Copy(), migrate.Latest, false); err != nil {
+		t.Fatalf("failed to migrate the schema: %v", err)
+	}
+	stor, err := Open(context.Background(), config.Copy())
+	if err != nil {
+		t.Fatalf("failed to open the storage: %v", err)
+	}
+	t.Cleanup(func() { stor.Close() })
+	return stor
+}
+
+func createDevice(t *testing.T, stor *Storage, deviceID string) {
+	t.Helper()
+	request := domain.CreateDeviceRequest{ID: deviceID, Algorithm: domain.AlgorithmECC, Metadata: map[string]string{"store": "7"}}
+	if _, err := app.NewAPIService(stor).CreateDevice(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sign(t *testing.T, stor *Storage, deviceID string, count int) {
+	t.Helper()
+	service := app.NewAPIService(stor)
+	for i := 0; i < count; i++ {
+		request := domain.SignTransactionRequest{DeviceID: deviceID, Data: fmt.Sprintf("receipt %d", i)}
+		if _, err := service.SignTransaction(context.Background(), request); err != nil {
+			t.Fatalf("signing with %s failed: %v", deviceID, err)
+		}
+	}
+}
+
+// verifyChain checks that the device signed count times and that its history verifies,
+// including the next signature chained to the stored last signature.
+func verifyChain(t *testing.T, stor *Storage, deviceID string, count int) {
+	t.Helper()
+	ctx := context.Background()
+	device, err := stor.GetDevice(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("device %s not found: %v", deviceID, err)
+	}
+	if device.SignatureCounter != count {
+		t.Fatalf("device %s has counter %d, expected %d", deviceID, device.SignatureCounter, count)
+	}
+	sign(t, stor, deviceID, 1)
+	verifier, err := crypto.NewChainVerifier(deviceID, device.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err := stor.ListTransactions(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != count+1 {
+		t.Fatalf("device %s has %d transactions, expected %d", deviceID, len(transactions), count+1)
+	}
+	for _, transaction := range transactions {
+		if err := verifier.Verify(transaction.Counter, transaction.SignedData, transaction.Signature); err != nil {
+			t.Fatalf("chain of %s does not verify: %v", deviceID, err)
+		}
+	}
+}
+
+func TestPostgresSigning(t *testing.T) {
+	config := newTestSchema(t)
+	ctx := context.Background()
+	stor := openTestStorage(t, config)
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 3)
+	if err := stor.AddDevice(ctx, domain.SignatureDevice{TenantID: domain.DefaultTenantID, ID: "till-1"}); !errors.Is(err, domain.ErrDeviceExists) {
+		t.Errorf("adding an existing device must fail, got %v", err)
+	}
+	stor.Close()
+
+	// A restarted instance finds everything, the migrations are not applied twice
+	stor = openTestStorage(t, config)
+	verifyChain(t, stor, "till-1", 3)
+	device, err := stor.GetDevice(ctx, "till-1")
+	if err != nil || device.Metadata["store"] != "7" {
+		t.Errorf("unexpected device %+v, %v", device, err)
+	}
+	transaction, err := stor.GetTransaction(ctx, "till-1", 2)
+	if err != nil || transaction.Data != "receipt 2" {
+		t.Errorf("unexpected transaction %+v, %v", transaction, err)
+	}
+	if _, err := stor.GetTransaction(ctx, "till-1", 10); !errors.Is(err, domain.ErrTransactionNotFound) {
+		t.Errorf("expected ErrTransactionNotFound, got %v", err)
+	}
+	other := domain.ContextWithPrincipal(ctx, domain.Principal{TenantID: "acme"})
+	if _, err := stor.GetDevice(other, "till-1"); !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Errorf("devices must not be visible to other tenants, got %v", err)
+	}
+}
+
+func TestPostgresConflicts(t *testing.T) {
+	ctx := context.Background()
+	stor := openTestStorage(t, newTestSchema(t))
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 2)
+
+	stale := domain.Transaction{TenantID: domain.DefaultTenantID, DeviceID: "till-1", Counter: 1, Signature: []byte("stale")}
+	if err := stor.CommitSignature(ctx, stale); !errors.Is(err, domain.ErrCounterConflict) {
+		t.Errorf("committing an advanced counter must conflict, got %v", err)
+	}
+	device, _ := stor.GetDevice(ctx, "till-1")
+	expected := device.Version
+	device.Label = "Till 1"
+	device.Version++
+	if err := stor.UpdateDevice(ctx, device, expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.UpdateDevice(ctx, device, expected); !errors.Is(err, domain.ErrVersionMismatch) {
+		t.Errorf("updating a stale version must fail, got %v", err)
+	}
+
+	current := domain.ContextWithFencingToken(ctx, 5)
+	if err := stor.UpdateDevice(current, device, device.Version); err != nil {
+		t.Fatal(err)
+	}
+	expired := domain.ContextWithFencingToken(ctx, 4)
+	next := domain.Transaction{TenantID: domain.DefaultTenantID, DeviceID: "till-1", Counter: 2, Signature: []byte("late")}
+	if err := stor.CommitSignature(expired, next); !errors.Is(err, domain.ErrLeaseExpired) {
+		t.Errorf("a write under an older lease must be fenced, got %v", err)
+	}
+	verifyChain(t, stor, "till-1", 2)
+}
+
+// TestPostgresInstancesShareDatabase signs with several instances, each with a pool and
+// device locks of its own. Every signature must be stored once and chained.
+func TestPostgresInstancesShareDatabase(t *testing.T) {
+	config := newTestSchema(t)
+	createDevice(t, openTestStorage(t, config), "till-1")
+
+	const instances, signatures = 4, 10
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		service := app.NewAPIService(openTestStorage(t, config))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < signatures; j++ {
+				request := domain.SignTransactionRequest{DeviceID: "till-1", Data: "receipt"}
+				_, err := service.SignTransaction(context.Background(), request)
+				if err != nil && !errors.Is(err, domain.ErrCounterConflict) {
+					t.Errorf("signing failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stor := openTestStorage(t, config)
+	device, _ := stor.GetDevice(context.Background(), "till-1")
+	if device.SignatureCounter == 0 {
+		t.Fatal("no signature was committed")
+	}
+	verifyChain(t, stor, "till-1", device.SignatureCounter)
+}
+
+func TestPostgresEachTransaction(t *testing.T) {
+	ctx := context.Background()
+	stor := openTestStorage(t, newTestSchema(t))
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 3)
+
+	var counters []int
+	err := stor.EachTransaction(ctx, "till-1", 2, func(transaction domain.Transaction) error {
+		counters = append(counters, transaction.Counter)
+		return nil
+	})
+	if err != nil || len(counters) != 2 || counters[0] != 0 || counters[1] != 1 {
+		t.Errorf("expected the transactions 0 and 1 in order, got %v, %v", counters, err)
+	}
+	stop := errors.New("stop")
+	if err := stor.EachTransaction(ctx, "till-1", 3, func(domain.Transaction) error { return stop }); err != stop {
+		t.Errorf("the error of fn must end the iteration, got %v", err)
+	}
+}
+
+func TestPostgresAPIKeys(t *testing.T) {
+	config := newTestSchema(t)
+	ctx := context.Background()
+	stor := openTestStorage(t, config)
+	keys := app.NewKeyService(stor, []domain.APIKey{{ID: "configured", Hash: app.HashAPIKey("configured")}})
+	created, _, err := keys.CreateAPIKey(ctx, "till", []domain.Scope{domain.ScopeSign})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := keys.ListAPIKeys(ctx)
+	if err != nil || len(listed) != 2 {
+		t.Errorf("expected the configured and the created key, got %v, %v", listed, err)
+	}
+	stor.Close()
+
+	stor = openTestStorage(t, config)
+	key, err := stor.GetAPIKeyByHash(ctx, created.Hash)
+	if err != nil || key.ID != created.ID || len(key.Scopes) != 1 || key.Scopes[0] != domain.ScopeSign {
+		t.Errorf("created API key was not stored: %+v, %v", key, err)
+	}
+	if _, err := stor.GetAPIKeyByHash(ctx, app.HashAPIKey("configured")); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+		t.Errorf("configured API keys must not be stored, got %v", err)
+	}
+	if err := stor.DeleteAPIKey(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.DeleteAPIKey(ctx, created.ID); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestPostgresBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	source := openTestStorage(t, newTestSchema(t))
+	createDevice(t, source, "till-1")
+	createDevice(t, source, "till-2")
+	sign(t, source, "till-1", 3)
+	if _, _, err := app.NewKeyService(source, nil).CreateAPIKey(ctx, "till", []domain.Scope{domain.ScopeSign}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := source.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := openTestStorage(t, newTestSchema(t))
+	summary, err := target.Restore(ctx, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (domain.RestoreSummary{Devices: 2, Transactions: 3, APIKeys: 1}) {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if summary, err = target.Restore(ctx, snapshot); err != nil || summary.SkippedDevices != 2 || summary.APIKeys != 0 {
+		t.Errorf("restoring twice must skip everything, got %+v, %v", summary, err)
+	}
+	verifyChain(t, target, "till-1", 3)
+	if _, err := target.Restore(ctx, snapshot); !errors.Is(err, domain.ErrCounterRollback) {
+		t.Errorf("restoring an older state must fail, got %v", err)
+	}
+
+	// The target signed once more after the restore, the source twice: the histories forked
+	sign(t, source, "till-1", 2)
+	forked, err := source.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Restore(ctx, forked); !errors.Is(err, domain.ErrCounterRollback) {
+		t.Errorf("restoring a forked history must fail, got %v", err)
+	}
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	config := newTestSchema(t)
+	ctx := context.Background()
+	result, err := Migrate(ctx, config.Copy(), migrate.Latest, true)
+	if err != nil || result.From != 0 || result.To != result.Latest || result.Applied != 0 {
+		t.Fatalf("unexpected dry run %+v, %v", result, err)
+	}
+	if _, err := Open(ctx, config.Copy()); !errors.Is(err, migrate.ErrOutdated) {
+		t.Fatalf("a dry run must not migrate, got %v", err)
+	}
+
+	stor := openTestStorage(t, config)
+	createDevice(t, stor, "till-1")
+	stor.Close()
+	if result, err = Migrate(ctx, config.Copy(), 0, false); err != nil || result.To != 0 || result.Applied != result.Latest {
+		t.Fatalf("unexpected migration %+v, %v", result, err)
+	}
+	if _, err := Open(ctx, config.Copy()); !errors.Is(err, migrate.ErrOutdated) {
+		t.Errorf("a schema migrated down must be refused, got %v", err)
+	}
+
+	// Every down migration must undo its up migration completely
+	stor = openTestStorage(t, config)
+	if _, err := stor.GetDevice(ctx, "till-1"); !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Errorf("the migration down must drop the devices, got %v", err)
+	}
+}
+
+func TestPostgresRefusesNewerSchema(t *testing.T) {
+	config := newTestSchema(t)
+	stor := openTestStorage(t, config)
+	if _, err := stor.pool.Exec(context.Background(), "INSERT INTO schema_migrations (version, name) VALUES (1000, 'future')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(context.Background(), config.Copy()); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("a schema migrated by a newer build must be refused, got %v", err)
+	}
+	if _, err := Migrate(context.Background(), config.Copy(), migrate.Latest, false); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("a schema migrated by a newer build must not be migrated, got %v", err)
+	}
+}
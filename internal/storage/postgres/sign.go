@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// GenerateKeys uses CryptoManager to create key pairs.
+func (s *Storage) GenerateKeys(ctx context.Context, algorithm domain.Algorithm) ([]byte, []byte, error) {
+	return s.cryptoMgr.GenerateKeys(ctx, algorithm)
+}
+
+// SignTransaction uses CryptoManager to sign data with the device's private key.
+func (s *Storage) SignTransaction(ctx context.Context, deviceID string, data []byte) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "Storage.SignTransaction")
+	defer span.End()
+
+	key := deviceKey(ctx, deviceID)
+	var algorithm string
+	var privateKey []byte
+	err := s.pool.QueryRow(ctx, "SELECT algorithm, private_key FROM devices WHERE tenant_id = $1 AND id = $2",
+		key.TenantID, key.DeviceID).Scan(&algorithm, &privateKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the key of device %s: %w", deviceID, err)
+	}
+
+	return s.cryptoMgr.Sign(ctx, domain.Algorithm(algorithm), privateKey, data)
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+const transactionColumns = `tenant_id, device_id, counter, data, signed_data, signature, created_at`
+
+// scanTransaction reads a row of transactionColumns.
+func scanTransaction(row pgx.Row) (domain.Transaction, error) {
+	var transaction domain.Transaction
+	var data, signedData []byte
+	err := row.Scan(&transaction.TenantID, &transaction.DeviceID, &transaction.Counter, &data, &signedData,
+		&transaction.Signature, &transaction.CreatedAt)
+	transaction.Data, transaction.SignedData = string(data), string(signedData)
+	transaction.CreatedAt = transaction.CreatedAt.UTC()
+	return transaction, err
+}
+
+// CommitSignature stores a transaction and advances the signature counter of its device from
+// the transaction's counter to the next, with the transaction's signature as the last
+// signature. It fails with domain.ErrCounterConflict if the device's counter has moved on
+// since the transaction was signed, and with domain.ErrLeaseExpired if the lease it was
+// signed under was granted to another instance since.
+func (s *Storage) CommitSignature(ctx context.Context, transaction domain.Transaction) error {
+	ctx, span := tracer.Start(ctx, "Storage.CommitSignature")
+	defer span.End()
+
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		key := cache.DeviceKey{TenantID: transaction.TenantID, DeviceID: transaction.DeviceID}
+		device, err := lockDevice(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if device.counter != transaction.Counter {
+			return domain.ErrCounterConflict
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO transactions (`+transactionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			transaction.TenantID, transaction.DeviceID, transaction.Counter, []byte(transaction.Data),
+			[]byte(transaction.SignedData), transaction.Signature, transaction.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to store signature %d of device %s: %w", transaction.Counter, transaction.DeviceID, err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE devices SET signature_counter = $3, last_signature = $4
+			WHERE tenant_id = $1 AND id = $2`, key.TenantID, key.DeviceID, transaction.Counter+1, transaction.Signature)
+		if err != nil {
+			return fmt.Errorf("failed to advance the counter of device %s: %w", transaction.DeviceID, err)
+		}
+		return nil
+	})
+}
+
+// ListTransactions returns the transactions of a device ordered by counter.
+func (s *Storage) ListTransactions(ctx context.Context, deviceID string) ([]domain.Transaction, error) {
+	key := deviceKey(ctx, deviceID)
+	rows, err := s.pool.Query(ctx, `SELECT `+transactionColumns+` FROM transactions
+		WHERE tenant_id = $1 AND device_id = $2 ORDER BY counter`, key.TenantID, key.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the signatures of device %s: %w", deviceID, err)
+	}
+	transactions, err := collect(rows, scanTransaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the signatures of device %s: %w", deviceID, err)
+	}
+	return transactions, nil
+}
+
+// EachTransaction calls fn for the transactions of a device with counters below upTo in
+// counter order as the rows arrive from the database. It stops at the first error of fn.
+func (s *Storage) EachTransaction(ctx context.Context, deviceID string, upTo int, fn func(domain.Transaction) error) error {
+	key := deviceKey(ctx, deviceID)
+	rows, err := s.pool.Query(ctx, `SELECT `+transactionColumns+` FROM transactions
+		WHERE tenant_id = $1 AND device_id = $2 AND counter < $3 ORDER BY counter`, key.TenantID, key.DeviceID, upTo)
+	if err != nil {
+		return fmt.Errorf("failed to read the signatures of device %s: %w", deviceID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return fmt.Errorf("failed to read the signatures of device %s: %w", deviceID, err)
+		}
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read the signatures of device %s: %w", deviceID, err)
+	}
+	return nil
+}
+
+// GetTransaction retrieves the transaction of a device with the given counter.
+func (s *Storage) GetTransaction(ctx context.Context, deviceID string, counter int) (domain.Transaction, error) {
+	key := deviceKey(ctx, deviceID)
+	transaction, err := scanTransaction(s.pool.QueryRow(ctx, `SELECT `+transactionColumns+` FROM transactions
+		WHERE tenant_id = $1 AND device_id = $2 AND counter = $3`, key.TenantID, key.DeviceID, counter))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Transaction{}, domain.ErrTransactionNotFound
+	}
+	if err != nil {
+		return domain.Transaction{}, fmt.Errorf("failed to get signature %d of device %s: %w", counter, deviceID, err)
+	}
+	return transaction, nil
+}
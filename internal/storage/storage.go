@@ -1,13 +1,27 @@
 package storage
 
 import (
+	"context"
+	"slices"
+	"sync"
+
 	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
 	"github.com/ashermp9/fiskaly-test-task/internal/adapters/crypto"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/ashermp9/fiskaly-test-task/internal/storage")
+
 type Storage struct {
 	cache     *cache.InMemoryStorage
 	cryptoMgr *crypto.CryptoManager
+	journal   *journal // Makes mutations durable, nil for storages kept in memory only
+
+	// Mutations share mu, Snapshot, Restore and compaction hold it exclusively
+	mu sync.RWMutex
+	// Conditional mutations hold conditions from checking them until they are applied
+	conditions sync.Mutex
 }
 
 func NewStorage() *Storage {
@@ -16,3 +30,90 @@ func NewStorage() *Storage {
 		cryptoMgr: crypto.NewCryptoManager(),
 	}
 }
+
+// Ping checks that the storage is usable. The in-memory storage always is, a journaled one
+// as long as its journal accepts writes.
+func (s *Storage) Ping(_ context.Context) error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.ping()
+}
+
+// Close closes the journal. The storage must not be used afterwards.
+func (s *Storage) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.close()
+}
+
+// checkFence rejects writes to a device under a lease that was granted to another instance
+// since, see domain.ContextWithFencingToken. Fences are kept in memory only: an in-memory
+// storage is never shared, a restart ends all leases. Callers hold conditions.
+func (s *Storage) checkFence(ctx context.Context, key cache.DeviceKey) error {
+	token, ok := domain.FencingTokenFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if fence, _ := s.cache.FenceCache.Get(key); token < fence {
+		return domain.ErrLeaseExpired
+	}
+	s.cache.FenceCache.Set(key, token)
+	return nil
+}
+
+// commit makes a mutation durable and applies it. Callers hold mu.
+func (s *Storage) commit(record journalRecord) error {
+	if s.journal == nil {
+		s.apply(record)
+		return nil
+	}
+	return s.journal.append(record, s.apply)
+}
+
+// apply changes the cache as described by the record, see journalRecord.
+func (s *Storage) apply(record journalRecord) {
+	switch {
+	case record.Device != nil:
+		device := *record.Device
+		s.cache.DeviceCache.Set(cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}, device)
+	case record.Transaction != nil:
+		transaction := *record.Transaction
+		key := cache.DeviceKey{TenantID: transaction.TenantID, DeviceID: transaction.DeviceID}
+		transactions, _ := s.cache.TransactionCache.Get(key)
+		if len(transactions) > transaction.Counter {
+			// Clip so the history others may still read is not overwritten
+			transactions = slices.Clip(transactions[:transaction.Counter])
+		}
+		s.cache.TransactionCache.Set(key, append(transactions, transaction))
+		if device, found := s.cache.DeviceCache.Get(key); found {
+			device.SignatureCounter = transaction.Counter + 1
+			device.LastSignature = string(transaction.Signature)
+			s.cache.DeviceCache.Set(key, device)
+		}
+	case record.APIKey != nil:
+		s.cache.APIKeyCache.Set(record.APIKey.Hash, *record.APIKey)
+	case record.DeletedAPIKey != "":
+		s.cache.APIKeyCache.Delete(record.DeletedAPIKey)
+	case record.Restore != nil:
+		histories := make(map[cache.DeviceKey][]domain.Transaction, len(record.Restore.Devices))
+		for _, transaction := range record.Restore.Transactions {
+			key := cache.DeviceKey{TenantID: transaction.TenantID, DeviceID: transaction.DeviceID}
+			histories[key] = append(histories[key], transaction)
+		}
+		for _, device := range record.Restore.Devices {
+			key := cache.DeviceKey{TenantID: device.TenantID, DeviceID: device.ID}
+			s.cache.TransactionCache.Set(key, histories[key])
+			s.cache.DeviceCache.Set(key, device)
+		}
+		for _, apiKey := range record.Restore.APIKeys {
+			s.cache.APIKeyCache.Set(apiKey.Hash, apiKey)
+		}
+	}
+}
+
+// SetCryptoPolicy restricts the keys generated for new devices.
+func (s *Storage) SetCryptoPolicy(policy crypto.Policy) error {
+	return s.cryptoMgr.SetPolicy(policy)
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// instance shares a storage like a separate process would: its device locks exclude nobody else.
+type instance struct {
+	*Storage
+	locks sync.Map
+}
+
+func (i *instance) LockDevice(_ context.Context, deviceID string) {
+	lock, _ := i.locks.LoadOrStore(deviceID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+}
+
+func (i *instance) UnlockDevice(_ context.Context, deviceID string) {
+	lock, _ := i.locks.Load(deviceID)
+	lock.(*sync.Mutex).Unlock()
+}
+
+func TestCommitSignatureConflict(t *testing.T) {
+	ctx := context.Background()
+	stor := NewStorage()
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 2)
+
+	stale := domain.Transaction{TenantID: domain.DefaultTenantID, DeviceID: "till-1", Counter: 1, Signature: []byte("stale")}
+	if err := stor.CommitSignature(ctx, stale); !errors.Is(err, domain.ErrCounterConflict) {
+		t.Errorf("committing an advanced counter must conflict, got %v", err)
+	}
+	device, _ := stor.GetDevice(ctx, "till-1")
+	expected := device.Version
+	device.Label = "Till 1"
+	device.Version++
+	device.SignatureCounter = 0
+	if err := stor.UpdateDevice(ctx, device, expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.UpdateDevice(ctx, device, expected); !errors.Is(err, domain.ErrVersionMismatch) {
+		t.Errorf("updating a stale version must fail, got %v", err)
+	}
+	verifyChain(t, stor, "till-1", 2)
+}
+
+// TestSigningInstancesShareStorage signs with several services whose device locks do not
+// exclude each other. Conflicting signatures must be retried, never stored twice.
+func TestSigningInstancesShareStorage(t *testing.T) {
+	stor := NewStorage()
+	createDevice(t, stor, "till-1")
+
+	const instances, signatures = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service := app.NewAPIService(&instance{Storage: stor})
+			for j := 0; j < signatures; j++ {
+				request := domain.SignTransactionRequest{DeviceID: "till-1", Data: "receipt"}
+				_, err := service.SignTransaction(context.Background(), request)
+				if err != nil && !errors.Is(err, domain.ErrCounterConflict) {
+					t.Errorf("signing failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	device, _ := stor.GetDevice(context.Background(), "till-1")
+	if device.SignatureCounter == 0 {
+		t.Fatal("no signature was committed")
+	}
+	verifyChain(t, stor, "till-1", device.SignatureCounter)
+}
+
+func TestEachTransaction(t *testing.T) {
+	ctx := context.Background()
+	stor := NewStorage()
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 3)
+
+	var counters []int
+	collect := func(transaction domain.Transaction) error {
+		counters = append(counters, transaction.Counter)
+		return nil
+	}
+	for upTo, expected := range map[int]int{-1: 0, 2: 2, 10: 3} {
+		counters = nil
+		if err := stor.EachTransaction(ctx, "till-1", upTo, collect); err != nil || len(counters) != expected {
+			t.Errorf("up to %d: expected %d transactions, got %v, %v", upTo, expected, counters, err)
+		}
+	}
+	stop := errors.New("stop")
+	if err := stor.EachTransaction(ctx, "till-1", 3, func(domain.Transaction) error { return stop }); err != stop {
+		t.Errorf("the error of fn must end the iteration, got %v", err)
+	}
+}
+
+func TestListTransactionsReturnsCopy(t *testing.T) {
+	ctx := context.Background()
+	stor := NewStorage()
+	createDevice(t, stor, "till-1")
+	sign(t, stor, "till-1", 2)
+
+	listed, _ := stor.ListTransactions(ctx, "till-1")
+	listed[0].SignedData = "changed"
+	again, _ := stor.ListTransactions(ctx, "till-1")
+	if again[0].SignedData == "changed" {
+		t.Error("changing a listed transaction must not change the storage")
+	}
+}
+
+// TestRestoreRejectsForkedHistory restores a device that signed on after an earlier restore.
+// Its signatures are not in the newer snapshot, which signed on separately.
+func TestRestoreRejectsForkedHistory(t *testing.T) {
+	ctx := context.Background()
+	source, target := NewStorage(), NewStorage()
+	createDevice(t, source, "till-1")
+	sign(t, source, "till-1", 1)
+	snapshot, _ := source.Snapshot(ctx)
+	if _, err := target.Restore(ctx, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	sign(t, source, "till-1", 2)
+	snapshot, _ = source.Snapshot(ctx)
+
+	sign(t, target, "till-1", 1)
+	if _, err := target.Restore(ctx, snapshot); !errors.Is(err, domain.ErrCounterRollback) {
+		t.Fatalf("restoring a forked history must fail, got %v", err)
+	}
+
+	// A history that only fell behind is brought forward
+	behind := NewStorage()
+	device := snapshot.Devices[0]
+	device.SignatureCounter, device.LastSignature = 1, string(snapshot.Transactions[0].Signature)
+	if _, err := behind.Restore(ctx, domain.Snapshot{Devices: []domain.SignatureDevice{device}, Transactions: snapshot.Transactions[:1]}); err != nil {
+		t.Fatal(err)
+	}
+	if summary, err := behind.Restore(ctx, snapshot); err != nil || summary.Transactions != 2 {
+		t.Errorf("expected the two missing transactions to be restored, got %+v, %v", summary, err)
+	}
+}
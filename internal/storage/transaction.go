@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/adapters/cache"
+	"github.com/ashermp9/fiskaly-test-task/internal/domain"
+)
+
+// CommitSignature stores a transaction and advances the signature counter of its device from
+// the transaction's counter to the next, with the transaction's signature as the last
+// signature. It fails with domain.ErrCounterConflict if the device's counter has moved on
+// since the transaction was signed, and with domain.ErrLeaseExpired if the lease it was
+// signed under was granted to another instance since.
+func (s *Storage) CommitSignature(ctx context.Context, transaction domain.Transaction) error {
+	_, span := tracer.Start(ctx, "Storage.CommitSignature")
+	defer span.End()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.conditions.Lock()
+	defer s.conditions.Unlock()
+
+	key := cache.DeviceKey{TenantID: transaction.TenantID, DeviceID: transaction.DeviceID}
+	if err := s.checkFence(ctx, key); err != nil {
+		return err
+	}
+	device, found := s.cache.DeviceCache.Get(key)
+	if !found {
+		return domain.ErrDeviceNotFound
+	}
+	if device.SignatureCounter != transaction.Counter {
+		return domain.ErrCounterConflict
+	}
+	return s.commit(journalRecord{Transaction: &transaction})
+}
+
+// ListTransactions returns a copy of the transactions of a device ordered by counter.
+func (s *Storage) ListTransactions(ctx context.Context, deviceID string) ([]domain.Transaction, error) {
+	transactions, _ := s.cache.TransactionCache.Get(deviceKey(ctx, deviceID))
+	listed := make([]domain.Transaction, len(transactions))
+	copy(listed, transactions)
+	return listed, nil
+}
+
+// EachTransaction calls fn for the transactions of a device with counters below upTo in
+// counter order. It stops at the first error of fn.
+func (s *Storage) EachTransaction(ctx context.Context, deviceID string, upTo int, fn func(domain.Transaction) error) error {
+	// Stored transactions are never changed in place, see apply, so the history is read unlocked
+	transactions, _ := s.cache.TransactionCache.Get(deviceKey(ctx, deviceID))
+	for _, transaction := range transactions[:max(0, min(upTo, len(transactions)))] {
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTransaction retrieves the transaction of a device with the given counter.
+func (s *Storage) GetTransaction(ctx context.Context, deviceID string, counter int) (domain.Transaction, error) {
+	transactions, _ := s.cache.TransactionCache.Get(deviceKey(ctx, deviceID))
+	if counter < 0 || counter >= len(transactions) {
+		return domain.Transaction{}, domain.ErrTransactionNotFound
+	}
+	return transactions[counter], nil
+}
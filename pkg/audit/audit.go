@@ -0,0 +1,128 @@
+// Package audit defines the entries of the administrative audit log and verifies their
+// integrity offline. Every tenant has its own chain: each event carries the hash of its
+// predecessor, so removing, reordering or changing an event breaks all following hashes.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GenesisHash is the previous hash of the first event of a tenant.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+const (
+	ActionDeviceCreate  = "device.create"
+	ActionDeviceUpdate  = "device.update"
+	ActionDeviceExport  = "device.export"
+	ActionAPIKeyCreate  = "api_key.create"
+	ActionAPIKeyRevoke  = "api_key.revoke"
+	ActionBackupCreate  = "backup.create"
+	ActionBackupRestore = "backup.restore"
+)
+
+// Event is an administrative action. The JSON encoding is part of the hash, it must not
+// change for existing fields.
+type Event struct {
+	Sequence     int               `json:"sequence"` // Position in the tenant's chain, starting at 1
+	Time         time.Time         `json:"time"`
+	Actor        string            `json:"actor"` // API key ID or certificate subject of the caller
+	TenantID     string            `json:"tenantId"`
+	Action       string            `json:"action"`
+	DeviceID     string            `json:"deviceId,omitempty"`
+	Details      map[string]string `json:"details,omitempty"`
+	PreviousHash string            `json:"previousHash"`
+	Hash         string            `json:"hash"` // Hex encoded SHA-256 of the event without the hash
+}
+
+// ComputeHash returns the hash of the event. The Hash field itself is ignored.
+func (e Event) ComputeHash() string {
+	e.Hash = ""
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		// Only fields with stable encodings exist, marshalling cannot fail
+		panic(fmt.Errorf("failed to encode audit event: %w", err))
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// Seal links the event to the last event of its tenant, nil for the first one, and sets its hash.
+func Seal(event Event, previous *Event) Event {
+	event.Sequence = 1
+	event.PreviousHash = GenesisHash
+	if previous != nil {
+		event.Sequence = previous.Sequence + 1
+		event.PreviousHash = previous.Hash
+	}
+	event.Time = event.Time.UTC()
+	event.Hash = event.ComputeHash()
+	return event
+}
+
+// VerificationError reports the first event breaking a chain.
+type VerificationError struct {
+	TenantID string
+	Sequence int
+	Reason   string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("audit event %d of tenant %q: %s", e.Sequence, e.TenantID, e.Reason)
+}
+
+// Verify checks the complete chains of all tenants in the events, which may be interleaved
+// as in the log file. It returns the number of chains.
+func Verify(events []Event) (int, error) {
+	last := make(map[string]*Event)
+	for i := range events {
+		event := &events[i]
+		previous := last[event.TenantID]
+
+		expectedSequence, expectedPrevious := 1, GenesisHash
+		if previous != nil {
+			expectedSequence, expectedPrevious = previous.Sequence+1, previous.Hash
+		}
+		if event.Sequence != expectedSequence {
+			return 0, &VerificationError{TenantID: event.TenantID, Sequence: event.Sequence,
+				Reason: fmt.Sprintf("expected sequence %d, events are missing or reordered", expectedSequence)}
+		}
+		if event.PreviousHash != expectedPrevious {
+			return 0, &VerificationError{TenantID: event.TenantID, Sequence: event.Sequence,
+				Reason: "previous hash does not match the preceding event"}
+		}
+		if event.Hash != event.ComputeHash() {
+			return 0, &VerificationError{TenantID: event.TenantID, Sequence: event.Sequence,
+				Reason: "hash does not match the content, the event was modified"}
+		}
+		last[event.TenantID] = event
+	}
+	return len(last), nil
+}
+
+// ReadLog decodes a log of JSON encoded events, one per line.
+func ReadLog(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,238 @@
+// Package bundle defines the archive auditors receive for a device: a TAR file with the
+// device, its public key and its complete signature history. Everything needed to verify
+// the history is in the archive, see cmd/chainverify. Exports of the service end with a
+// manifest of all entries, signed by the service key.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+// Names of the archive entries, written in this order.
+const (
+	DeviceFile       = "device.json"
+	PublicKeyFile    = "public_key.pem"
+	ServiceKeyFile   = "service_key.pem"    // Public key the manifest is signed with
+	TransactionsFile = "transactions.jsonl" // One Transaction per line, ordered by counter
+	CSVFile          = "transactions.csv"   // The transactions for spreadsheets, with a header row
+	ManifestFile     = "manifest.json"
+	SignatureFile    = "manifest.sig" // base64 encoded signature of the manifest.json bytes
+)
+
+// csvHeader names the columns of CSVFile.
+var csvHeader = []string{"device_id", "counter", "data", "signed_data", "signature", "created_at"}
+
+// Device describes the device the bundle was exported for.
+type Device struct {
+	ID               string            `json:"id"`
+	TenantID         string            `json:"tenantId"`
+	Algorithm        string            `json:"algorithm"`
+	Label            string            `json:"label,omitempty"`
+	PublicKey        string            `json:"publicKey"` // PEM encoded
+	SignatureCounter int               `json:"signatureCounter"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Version          int               `json:"version"`
+	Disabled         bool              `json:"disabled"`
+}
+
+// Transaction is one signature of the device.
+type Transaction struct {
+	DeviceID   string    `json:"deviceId"`
+	Counter    int       `json:"counter"`
+	Data       string    `json:"data"`
+	SignedData string    `json:"signedData"`
+	Signature  string    `json:"signature"` // base64 encoded
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// File describes an entry written to the archive.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // Hex encoded
+}
+
+// Manifest lists every entry preceding it with its hash, so the signature of the manifest
+// covers the whole bundle.
+type Manifest struct {
+	DeviceID     string    `json:"deviceId"`
+	TenantID     string    `json:"tenantId"`
+	ExportedAt   time.Time `json:"exportedAt"`
+	Transactions int       `json:"transactions"`
+	ServiceKey   string    `json:"serviceKey"` // Fingerprint of the service key
+	Files        []File    `json:"files"`
+}
+
+// Writer streams a bundle as a TAR archive.
+type Writer struct {
+	tar     *tar.Writer
+	modTime time.Time
+	files   []File
+}
+
+// NewWriter writes a bundle to w, dating every entry with modTime.
+func NewWriter(w io.Writer, modTime time.Time) *Writer {
+	return &Writer{tar: tar.NewWriter(w), modTime: modTime}
+}
+
+// WriteFile adds an entry with the content write produces. TAR headers carry the size of
+// the entry, so write is called twice: once to measure and once to write. It must produce
+// the same bytes both times, in exchange no entry is ever held in memory.
+func (w *Writer) WriteFile(name string, write func(io.Writer) error) error {
+	var size countingWriter
+	if err := write(&size); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := w.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(size),
+		Mode:     0o644,
+		ModTime:  w.modTime,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return err
+	}
+
+	digest := sha256.New()
+	content := bufio.NewWriter(io.MultiWriter(w.tar, digest))
+	if err := write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := content.Flush(); err != nil {
+		return err
+	}
+	w.files = append(w.files, File{Name: name, Size: int64(size), SHA256: hexDigest(digest)})
+	return nil
+}
+
+// WriteJSON adds an entry with the indented JSON of value.
+func (w *Writer) WriteJSON(name string, value any) error {
+	return w.WriteFile(name, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	})
+}
+
+// WriteTransactions adds the transactions entry. each calls yield for every transaction
+// in counter order and must yield the same transactions when called again.
+func (w *Writer) WriteTransactions(each func(yield func(Transaction) error) error) error {
+	return w.WriteFile(TransactionsFile, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		return each(func(transaction Transaction) error {
+			return encoder.Encode(transaction)
+		})
+	})
+}
+
+// WriteCSV adds the CSV entry. each is called like for WriteTransactions.
+func (w *Writer) WriteCSV(each func(yield func(Transaction) error) error) error {
+	return w.WriteFile(CSVFile, func(out io.Writer) error {
+		records := csv.NewWriter(out)
+		if err := records.Write(csvHeader); err != nil {
+			return err
+		}
+		if err := each(func(transaction Transaction) error {
+			return records.Write([]string{
+				transaction.DeviceID,
+				strconv.Itoa(transaction.Counter),
+				transaction.Data,
+				transaction.SignedData,
+				transaction.Signature,
+				transaction.CreatedAt.Format(time.RFC3339Nano),
+			})
+		}); err != nil {
+			return err
+		}
+		records.Flush()
+		return records.Error()
+	})
+}
+
+// WriteManifest lists the entries written so far in the manifest and signs it. The
+// signature is only meaningful if the public key of signer was written as ServiceKeyFile.
+func (w *Writer) WriteManifest(manifest Manifest, signer crypto.Signer) error {
+	manifest.Files = append([]File(nil), w.files...)
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+	signature, err := signer.Sign(content)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", ManifestFile, err)
+	}
+
+	if err := w.WriteFile(ManifestFile, func(out io.Writer) error {
+		_, err := out.Write(content)
+		return err
+	}); err != nil {
+		return err
+	}
+	return w.WriteFile(SignatureFile, func(out io.Writer) error {
+		_, err := io.WriteString(out, base64.StdEncoding.EncodeToString(signature)+"\n")
+		return err
+	})
+}
+
+// Files returns the entries written so far.
+func (w *Writer) Files() []File {
+	return w.files
+}
+
+// Close finishes the archive without closing the underlying writer.
+func (w *Writer) Close() error {
+	return w.tar.Close()
+}
+
+// ReadTransactions decodes the transactions entry, calling fn for every transaction.
+func ReadTransactions(r io.Reader, fn func(Transaction) error) error {
+	decoder := json.NewDecoder(r)
+	for line := 1; decoder.More(); line++ {
+		var transaction Transaction
+		if err := decoder.Decode(&transaction); err != nil {
+			return fmt.Errorf("%s: transaction %d: %w", TransactionsFile, line, err)
+		}
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fingerprint identifies a PEM encoded public key by the hex encoded SHA-256 of its DER
+// encoding, which operators publish so auditors can recognize the service key.
+func Fingerprint(publicKey []byte) (string, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return "", fmt.Errorf("public key is not PEM encoded")
+	}
+	digest := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+func hexDigest(digest hash.Hash) string {
+	return hex.EncodeToString(digest.Sum(nil))
+}
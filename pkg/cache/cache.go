@@ -54,3 +54,21 @@ func (c *Cache[K, V]) Unlock(key K) {
 		c.mu.Unlock()
 	}
 }
+
+// Len returns the number of values currently stored in the cache.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Values returns a snapshot of all values currently stored in the cache.
+func (c *Cache[K, V]) Values() []V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]V, 0, len(c.items))
+	for _, value := range c.items {
+		values = append(values, value)
+	}
+	return values
+}
@@ -0,0 +1,227 @@
+// Package client is a Go client for the signature service HTTP API.
+//
+// Requests are retried on network errors and transient server errors. POST and PATCH
+// requests carry an Idempotency-Key that stays the same across retries, so a retry never
+// creates a second device or signature. Signatures returned by the API are verified
+// locally against the device's public key and the signature chain unless disabled.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 200 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
+)
+
+// Client calls the v1 API of the signature service. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	header       http.Header
+	maxRetries   int
+	retryBackoff time.Duration
+	verify       bool
+
+	mu             sync.Mutex
+	publicKeys     map[string][]byte // Verified devices by ID
+	lastSignatures map[string]Signature
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries sets how often a failed request is retried and the initial backoff, which doubles per attempt.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithHeader adds a header to every request, e.g. for authentication.
+func WithHeader(name, value string) Option {
+	return func(c *Client) { c.header.Add(name, value) }
+}
+
+// WithoutVerification disables the local verification of returned signatures.
+func WithoutVerification() Option {
+	return func(c *Client) { c.verify = false }
+}
+
+// New creates a client for the service at baseURL, e.g. http://localhost:8080.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		httpClient:     http.DefaultClient,
+		header:         make(http.Header),
+		maxRetries:     defaultMaxRetries,
+		retryBackoff:   defaultRetryBackoff,
+		verify:         true,
+		publicKeys:     make(map[string][]byte),
+		lastSignatures: make(map[string]Signature),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// request describes a single API call.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   any
+}
+
+// response is a successful API response.
+type response struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// do sends a request, retrying transient failures, and returns the response of the
+// first attempt that does not fail transiently. API errors are returned as *Error.
+func (c *Client) do(ctx context.Context, req request) (*response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	header := c.header.Clone()
+	for name, values := range req.header {
+		header[name] = values
+	}
+	if req.method == http.MethodPost || req.method == http.MethodPatch {
+		if header.Get("Idempotency-Key") == "" {
+			header.Set("Idempotency-Key", newIdempotencyKey())
+		}
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, retryAfter, err := c.send(ctx, req.method, req.path, header, body)
+		if err == nil {
+			return resp, nil
+		}
+		if retryAfter < 0 || attempt >= c.maxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// send performs one attempt. A negative retryAfter marks the error as permanent, zero
+// means retry with the default backoff.
+func (c *Client) send(
+	ctx context.Context, method, path string, header http.Header, body []byte,
+) (*response, time.Duration, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, -1, err
+	}
+	httpRequest.Header = header.Clone()
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+	httpRequest.Header.Set("Accept", "application/json")
+
+	httpResponse, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if httpResponse.StatusCode < http.StatusBadRequest {
+		return &response{
+			statusCode: httpResponse.StatusCode,
+			header:     httpResponse.Header,
+			body:       responseBody,
+		}, 0, nil
+	}
+
+	apiError := parseError(httpResponse.StatusCode, responseBody)
+	switch httpResponse.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, parseRetryAfter(httpResponse.Header.Get("Retry-After")), apiError
+	default:
+		return nil, -1, apiError
+	}
+}
+
+func parseError(statusCode int, body []byte) *Error {
+	var errorResponse struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err != nil || errorResponse.Error == nil {
+		return &Error{StatusCode: statusCode, Code: "unknown", Message: strings.TrimSpace(string(body))}
+	}
+	errorResponse.Error.StatusCode = statusCode
+	return errorResponse.Error
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Errorf("failed to generate idempotency key: %w", err))
+	}
+	return hex.EncodeToString(key)
+}
+
+func decode[T any](resp *response) (T, error) {
+	var value T
+	if err := json.Unmarshal(resp.body, &value); err != nil {
+		return value, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return value, nil
+}
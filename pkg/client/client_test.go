@@ -0,0 +1,193 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ashermp9/fiskaly-test-task/internal/app"
+	"github.com/ashermp9/fiskaly-test-task/internal/ports"
+	"github.com/ashermp9/fiskaly-test-task/internal/storage"
+	"github.com/ashermp9/fiskaly-test-task/pkg/bundle"
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+	"go.uber.org/zap"
+)
+
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) *httptest.Server {
+	loggerZap, _ := zap.NewDevelopment()
+	_, privateKey, err := (&crypto.ECCGenerator{}).GenerateBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, publicKey, err := crypto.NewSignerFromPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := app.NewAPIService(storage.NewStorage(), app.WithExportKey(signer, publicKey))
+	handler := ports.NewServer(loggerZap.Sugar(), service, 0).Handler()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	server := newTestServer(t, nil)
+	client := New(server.URL)
+	ctx := context.Background()
+
+	device, err := client.CreateDevice(ctx, CreateDeviceRequest{ID: "client-device", Algorithm: "ECC", Label: "Till 1"})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	if device.ID != "client-device" || device.Version != 1 {
+		t.Errorf("unexpected device: %+v", device)
+	}
+
+	_, err = client.CreateDevice(ctx, CreateDeviceRequest{ID: "client-device", Algorithm: "ECC"})
+	if !errors.Is(err, ErrDeviceExists) {
+		t.Errorf("expected ErrDeviceExists, got %v", err)
+	}
+	if _, err := client.GetDevice(ctx, "missing"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("expected ErrDeviceNotFound, got %v", err)
+	}
+
+	label := "Till 2"
+	device, err = client.UpdateDevice(ctx, "client-device", device.Version, UpdateDeviceRequest{Label: &label})
+	if err != nil || device.Label != label {
+		t.Fatalf("UpdateDevice failed: %+v, %v", device, err)
+	}
+	if _, err := client.UpdateDevice(ctx, "client-device", 1, UpdateDeviceRequest{Label: &label}); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		signature, err := client.Sign(ctx, "client-device", "receipt_with_underscores")
+		if err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		if signature.Counter != i {
+			t.Errorf("expected counter %d, got %d", i, signature.Counter)
+		}
+	}
+
+	verified, err := client.VerifyChain(ctx, "client-device")
+	if err != nil || verified != 3 {
+		t.Errorf("VerifyChain verified %d signatures: %v", verified, err)
+	}
+
+	devices, err := client.ListDevices(ctx)
+	if err != nil || len(devices) != 1 || devices[0].SignatureCounter != 3 {
+		t.Errorf("unexpected devices: %+v, %v", devices, err)
+	}
+
+	var export bytes.Buffer
+	if err := client.ExportDevice(ctx, "client-device", &export); err != nil {
+		t.Fatalf("ExportDevice failed: %v", err)
+	}
+	if header, err := tar.NewReader(&export).Next(); err != nil || header.Name != bundle.DeviceFile {
+		t.Errorf("expected the export to start with %s, got %+v, %v", bundle.DeviceFile, header, err)
+	}
+	if err := client.ExportDevice(ctx, "missing", &export); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+// TestClientVerifiesDevicesOfOneAlgorithm signs alternately with two devices of the same
+// algorithm, every signature must verify against the key of its own device.
+func TestClientVerifiesDevicesOfOneAlgorithm(t *testing.T) {
+	server := newTestServer(t, nil)
+	client := New(server.URL)
+	ctx := context.Background()
+
+	devices := []string{"till-1", "till-2"}
+	for _, deviceID := range devices {
+		if _, err := client.CreateDevice(ctx, CreateDeviceRequest{ID: deviceID, Algorithm: "ECC"}); err != nil {
+			t.Fatalf("CreateDevice failed: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		for _, deviceID := range devices {
+			if _, err := client.Sign(ctx, deviceID, "receipt"); err != nil {
+				t.Fatalf("Sign with %s failed: %v", deviceID, err)
+			}
+		}
+	}
+	for _, deviceID := range devices {
+		if verified, err := client.VerifyChain(ctx, deviceID); err != nil || verified != 3 {
+			t.Errorf("VerifyChain of %s verified %d signatures: %v", deviceID, verified, err)
+		}
+		if _, err := New(server.URL).VerifySignature(ctx, deviceID, 2); err != nil {
+			t.Errorf("VerifySignature of %s failed: %v", deviceID, err)
+		}
+	}
+}
+
+// TestClientRetry drops the first response after the server processed the request, as a
+// timeout would. The retry must replay the signature instead of signing twice.
+func TestClientRetry(t *testing.T) {
+	var dropped atomic.Bool
+	server := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/signatures") && !dropped.Swap(true) {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	client := New(server.URL, WithRetries(2, time.Millisecond))
+	ctx := context.Background()
+
+	if _, err := client.CreateDevice(ctx, CreateDeviceRequest{ID: "retried", Algorithm: "ECC"}); err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	signature, err := client.Sign(ctx, "retried", "receipt")
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !dropped.Load() || signature.Counter != 0 {
+		t.Errorf("expected the replayed first signature, got counter %d", signature.Counter)
+	}
+
+	device, err := client.GetDevice(ctx, "retried")
+	if err != nil || device.SignatureCounter != 1 {
+		t.Errorf("expected exactly one signature, got %+v, %v", device, err)
+	}
+}
+
+func TestClientDetectsTampering(t *testing.T) {
+	server := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/signatures") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			recorder := httptest.NewRecorder()
+			next.ServeHTTP(recorder, r)
+			w.WriteHeader(recorder.Code)
+			w.Write(bytes.Replace(recorder.Body.Bytes(), []byte("receipt"), []byte("forged!"), 1))
+		})
+	})
+	client := New(server.URL)
+	ctx := context.Background()
+
+	if _, err := client.CreateDevice(ctx, CreateDeviceRequest{ID: "tampered", Algorithm: "ECC"}); err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	_, err := client.Sign(ctx, "tampered", "receipt")
+	var verificationError *VerificationError
+	if !errors.As(err, &verificationError) {
+		t.Errorf("expected a VerificationError, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListDevices returns all devices ordered by ID.
+func (c *Client) ListDevices(ctx context.Context) ([]Device, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/devices"})
+	if err != nil {
+		return nil, err
+	}
+	list, err := decode[deviceList](resp)
+	return list.Devices, err
+}
+
+// CreateDevice creates a signature device with a new key pair.
+func (c *Client) CreateDevice(ctx context.Context, createDeviceRequest CreateDeviceRequest) (Device, error) {
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/devices", body: createDeviceRequest})
+	if err != nil {
+		return Device{}, err
+	}
+	return decode[Device](resp)
+}
+
+// GetDevice retrieves a single device.
+func (c *Client) GetDevice(ctx context.Context, id string) (Device, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: devicePath(id)})
+	if err != nil {
+		return Device{}, err
+	}
+	return decode[Device](resp)
+}
+
+// UpdateDevice changes label and metadata of a device. version is the device version the
+// changes are based on, the update fails with ErrVersionMismatch if the device changed since.
+func (c *Client) UpdateDevice(ctx context.Context, id string, version int, updateDeviceRequest UpdateDeviceRequest) (Device, error) {
+	header := http.Header{}
+	header.Set("If-Match", strconv.Quote(strconv.Itoa(version)))
+	resp, err := c.do(ctx, request{method: http.MethodPatch, path: devicePath(id), header: header, body: updateDeviceRequest})
+	if err != nil {
+		return Device{}, err
+	}
+	return decode[Device](resp)
+}
+
+func devicePath(id string) string {
+	return "/api/v1/devices/" + url.PathEscape(id)
+}
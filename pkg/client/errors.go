@@ -0,0 +1,55 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is an error response of the API. Compare against the exported sentinels with
+// errors.Is, which matches on the error code.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("signer API error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is reports whether target is an API error with the same code.
+func (e *Error) Is(target error) bool {
+	var apiError *Error
+	return errors.As(target, &apiError) && apiError.Code == e.Code
+}
+
+// Errors returned by the API, mirroring the server's error codes.
+var (
+	ErrInvalidRequest       = &Error{Code: "invalid_request"}
+	ErrNotFound             = &Error{Code: "not_found"}
+	ErrMethodNotAllowed     = &Error{Code: "method_not_allowed"}
+	ErrDeviceNotFound       = &Error{Code: "device_not_found"}
+	ErrDeviceExists         = &Error{Code: "device_exists"}
+	ErrDeviceDisabled       = &Error{Code: "device_disabled"}
+	ErrVersionMismatch      = &Error{Code: "version_mismatch"}
+	ErrCounterConflict      = &Error{Code: "counter_conflict"}
+	ErrLeaseExpired         = &Error{Code: "lease_expired"}
+	ErrPreconditionRequired = &Error{Code: "precondition_required"}
+	ErrSignatureNotFound    = &Error{Code: "signature_not_found"}
+	ErrIdempotencyKeyReused = &Error{Code: "idempotency_key_reused"}
+	ErrForbidden            = &Error{Code: "forbidden"}
+	ErrInvalidBackup        = &Error{Code: "invalid_backup"}
+	ErrCounterRollback      = &Error{Code: "counter_rollback"}
+	ErrInternal             = &Error{Code: "internal_error"}
+)
+
+// VerificationError is returned when a signature received from the API fails local verification.
+type VerificationError struct {
+	DeviceID string
+	Counter  int
+	Reason   string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("signature %d of device %s failed verification: %s", e.Counter, e.DeviceID, e.Reason)
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Sign signs data with a device. Unless verification is disabled, the returned signature
+// is checked against the device's public key and the previously seen signature.
+func (c *Client) Sign(ctx context.Context, deviceID, data string) (Signature, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   devicePath(deviceID) + "/signatures",
+		body:   createSignatureRequest{Data: data},
+	})
+	if err != nil {
+		return Signature{}, err
+	}
+
+	signature, err := decode[Signature](resp)
+	if err != nil {
+		return Signature{}, err
+	}
+	if c.verify {
+		if err := c.verifySigned(ctx, deviceID, data, signature); err != nil {
+			return signature, err
+		}
+	}
+	return signature, nil
+}
+
+// ListSignatures returns the signature history of a device ordered by counter.
+func (c *Client) ListSignatures(ctx context.Context, deviceID string) ([]Signature, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: devicePath(deviceID) + "/signatures"})
+	if err != nil {
+		return nil, err
+	}
+	list, err := decode[signatureList](resp)
+	return list.Signatures, err
+}
+
+// GetSignature retrieves the signature a device created with the given counter.
+func (c *Client) GetSignature(ctx context.Context, deviceID string, counter int) (Signature, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: fmt.Sprintf("%s/signatures/%d", devicePath(deviceID), counter)})
+	if err != nil {
+		return Signature{}, err
+	}
+	return decode[Signature](resp)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ExportDevice streams the export bundle of a device, a TAR archive described in
+// pkg/bundle, to w. The request is not retried, as w may already hold part of the archive
+// when it fails.
+func (c *Client) ExportDevice(ctx context.Context, id string, w io.Writer) error {
+	return c.stream(ctx, http.MethodGet, devicePath(id)+"/export", nil, w)
+}
+
+// Backup streams an encrypted backup of the whole service to w. It requires an admin key
+// of the default tenant. Like ExportDevice, it is not retried.
+func (c *Client) Backup(ctx context.Context, w io.Writer) error {
+	return c.stream(ctx, http.MethodGet, "/api/v1/backup", nil, w)
+}
+
+// Restore uploads a backup created by Backup. The service refuses backups that would roll
+// back the signature counter of a device with ErrCounterRollback.
+func (c *Client) Restore(ctx context.Context, backup io.Reader) (RestoreResult, error) {
+	var response bytes.Buffer
+	if err := c.stream(ctx, http.MethodPut, "/api/v1/backup", backup, &response); err != nil {
+		return RestoreResult{}, err
+	}
+	var result RestoreResult
+	if err := json.Unmarshal(response.Bytes(), &result); err != nil {
+		return RestoreResult{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// stream performs a single attempt of a request with a binary body and copies a
+// successful response body to w instead of buffering it.
+func (c *Client) stream(ctx context.Context, method, path string, body io.Reader, w io.Writer) error {
+	httpRequest, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header = c.header.Clone()
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	httpResponse, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= http.StatusBadRequest {
+		responseBody, err := io.ReadAll(httpResponse.Body)
+		if err != nil {
+			return err
+		}
+		return parseError(httpResponse.StatusCode, responseBody)
+	}
+	_, err = io.Copy(w, httpResponse.Body)
+	return err
+}
@@ -0,0 +1,60 @@
+package client
+
+import "time"
+
+// Device is a signature device as returned by the API.
+type Device struct {
+	ID               string            `json:"id"`
+	TenantID         string            `json:"tenantId"`
+	Algorithm        string            `json:"algorithm"`
+	Label            string            `json:"label,omitempty"`
+	PublicKey        string            `json:"publicKey"`
+	SignatureCounter int               `json:"signatureCounter"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Version          int               `json:"version"`
+	Disabled         bool              `json:"disabled"`
+}
+
+// CreateDeviceRequest describes a device to create.
+type CreateDeviceRequest struct {
+	ID        string            `json:"id"`
+	Algorithm string            `json:"algorithm"`
+	Label     string            `json:"label,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// UpdateDeviceRequest is a partial update of a device. Set a metadata value to nil to remove the key.
+type UpdateDeviceRequest struct {
+	Label    *string            `json:"label,omitempty"`
+	Metadata map[string]*string `json:"metadata,omitempty"`
+	Disabled *bool              `json:"disabled,omitempty"`
+}
+
+// Signature is a signature created by a device.
+type Signature struct {
+	DeviceID   string    `json:"deviceId"`
+	Counter    int       `json:"counter"`
+	Signature  string    `json:"signature"`
+	SignedData string    `json:"signedData"`
+	CreatedAt  time.Time `json:"createdAt,omitempty"`
+}
+
+// RestoreResult reports what restoring a backup changed.
+type RestoreResult struct {
+	Devices        int `json:"devices"`        // Devices created or brought forward
+	SkippedDevices int `json:"skippedDevices"` // Devices already at the state of the backup
+	Transactions   int `json:"transactions"`   // Signatures added
+	APIKeys        int `json:"apiKeys"`        // API keys added
+}
+
+type deviceList struct {
+	Devices []Device `json:"devices"`
+}
+
+type signatureList struct {
+	Signatures []Signature `json:"signatures"`
+}
+
+type createSignatureRequest struct {
+	Data string `json:"data"`
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ashermp9/fiskaly-test-task/pkg/crypto"
+)
+
+// VerifyChain fetches the complete signature history of a device and verifies every
+// signature and every link to its predecessor. It returns the number of verified signatures.
+func (c *Client) VerifyChain(ctx context.Context, deviceID string) (int, error) {
+	verifier, err := c.chainVerifier(ctx, deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	signatures, err := c.ListSignatures(ctx, deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, signature := range signatures {
+		raw, err := decodeSignature(deviceID, signature)
+		if err != nil {
+			return i, err
+		}
+		if err := verifier.Verify(signature.Counter, signature.SignedData, raw); err != nil {
+			return i, verificationError(deviceID, signature, err)
+		}
+	}
+	return len(signatures), nil
+}
+
+// verifySigned checks a freshly created signature: the signature itself, that it covers
+// the requested data and that it links to the last signature this client saw, if that
+// was its direct predecessor.
+func (c *Client) verifySigned(ctx context.Context, deviceID, data string, signature Signature) error {
+	verifier, err := c.chainVerifier(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	raw, err := decodeSignature(deviceID, signature)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, seen := c.lastSignatures[deviceID]
+	switch {
+	case signature.Counter == 0:
+		err = verifier.Verify(signature.Counter, signature.SignedData, raw)
+	case seen && last.Counter >= signature.Counter:
+		return &VerificationError{DeviceID: deviceID, Counter: signature.Counter,
+			Reason: fmt.Sprintf("counter did not increase, already saw counter %d", last.Counter)}
+	case seen && last.Counter == signature.Counter-1:
+		previous, _ := base64.StdEncoding.DecodeString(last.Signature)
+		verifier.ContinueAfter(last.Counter, previous)
+		err = verifier.Verify(signature.Counter, signature.SignedData, raw)
+	default:
+		// The predecessor is unknown to this client, its link cannot be checked
+		err = verifier.VerifySignature(signature.Counter, signature.SignedData, raw)
+	}
+	if err != nil {
+		return verificationError(deviceID, signature, err)
+	}
+
+	securedData, _ := crypto.ParseSecuredData(signature.SignedData)
+	if securedData.Data != data {
+		return &VerificationError{DeviceID: deviceID, Counter: signature.Counter, Reason: "signed data does not contain the requested data"}
+	}
+
+	c.lastSignatures[deviceID] = signature
+	return nil
+}
+
+// chainVerifier returns a verifier for the chain of a device, fetching its public key on
+// first use.
+func (c *Client) chainVerifier(ctx context.Context, deviceID string) (*crypto.ChainVerifier, error) {
+	c.mu.Lock()
+	publicKey, ok := c.publicKeys[deviceID]
+	c.mu.Unlock()
+	if !ok {
+		device, err := c.GetDevice(ctx, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = []byte(device.PublicKey)
+	}
+
+	verifier, err := crypto.NewChainVerifier(deviceID, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of device %s: %w", deviceID, err)
+	}
+	if !ok {
+		c.mu.Lock()
+		c.publicKeys[deviceID] = publicKey
+		c.mu.Unlock()
+	}
+	return verifier, nil
+}
+
+// decodeSignature returns the raw bytes of a signature.
+func decodeSignature(deviceID string, signature Signature) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return nil, &VerificationError{DeviceID: deviceID, Counter: signature.Counter, Reason: "signature is not base64 encoded"}
+	}
+	return raw, nil
+}
+
+func verificationError(deviceID string, signature Signature, err error) error {
+	return &VerificationError{DeviceID: deviceID, Counter: signature.Counter, Reason: err.Error()}
+}
+
+// VerifySignature fetches a single signature and verifies it against the device's public key
+// and, unless it is the first one, its link to the preceding signature.
+func (c *Client) VerifySignature(ctx context.Context, deviceID string, counter int) (Signature, error) {
+	verifier, err := c.chainVerifier(ctx, deviceID)
+	if err != nil {
+		return Signature{}, err
+	}
+	signature, err := c.GetSignature(ctx, deviceID, counter)
+	if err != nil {
+		return Signature{}, err
+	}
+	raw, err := decodeSignature(deviceID, signature)
+	if err != nil {
+		return signature, err
+	}
+
+	if counter > 0 {
+		predecessor, err := c.GetSignature(ctx, deviceID, counter-1)
+		if err != nil {
+			return signature, err
+		}
+		previous, err := decodeSignature(deviceID, predecessor)
+		if err != nil {
+			return signature, err
+		}
+		if err := verifier.VerifySignature(predecessor.Counter, predecessor.SignedData, previous); err != nil {
+			return signature, verificationError(deviceID, predecessor, err)
+		}
+		verifier.ContinueAfter(predecessor.Counter, previous)
+	}
+	if err := verifier.Verify(signature.Counter, signature.SignedData, raw); err != nil {
+		return signature, verificationError(deviceID, signature, err)
+	}
+	return signature, nil
+}
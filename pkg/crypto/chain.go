@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SecuredData is the string a device signs: <signature_counter>_<data>_<last_signature_base64>.
+// Including the counter and the previous signature chains every signature of a device to its predecessor.
+type SecuredData struct {
+	Counter       int
+	Data          string
+	LastSignature string // base64 encoded previous signature, or the base64 encoded device ID for counter 0
+}
+
+// NewSecuredData builds the secured data for a signature. lastSignature is the raw previous
+// signature and is ignored for the first signature of a device.
+func NewSecuredData(deviceID string, counter int, data string, lastSignature []byte) SecuredData {
+	return SecuredData{
+		Counter:       counter,
+		Data:          data,
+		LastSignature: ChainLink(deviceID, counter, lastSignature),
+	}
+}
+
+// ChainLink returns the base64 encoded value linking a signature to its predecessor.
+func ChainLink(deviceID string, counter int, lastSignature []byte) string {
+	if counter == 0 {
+		return base64.StdEncoding.EncodeToString([]byte(deviceID))
+	}
+	return base64.StdEncoding.EncodeToString(lastSignature)
+}
+
+func (d SecuredData) String() string {
+	return fmt.Sprintf("%d_%s_%s", d.Counter, d.Data, d.LastSignature)
+}
+
+// ParseSecuredData splits secured data into its parts. The data itself may contain
+// underscores since the base64 alphabet of the last signature does not.
+func ParseSecuredData(securedData string) (SecuredData, error) {
+	first := strings.Index(securedData, "_")
+	last := strings.LastIndex(securedData, "_")
+	if first < 0 || first == last {
+		return SecuredData{}, fmt.Errorf("malformed secured data %q", securedData)
+	}
+
+	counter, err := strconv.Atoi(securedData[:first])
+	if err != nil || counter < 0 {
+		return SecuredData{}, fmt.Errorf("malformed signature counter in %q", securedData)
+	}
+
+	return SecuredData{
+		Counter:       counter,
+		Data:          securedData[first+1 : last],
+		LastSignature: securedData[last+1:],
+	}, nil
+}
+
+// ChainVerifier checks the signatures of one device in counter order: every signature
+// against the public key, the counter it embeds, and its link to the predecessor.
+type ChainVerifier struct {
+	deviceID string
+	verifier Verifier
+	next     int
+	previous []byte
+}
+
+// NewChainVerifier starts verifying the chain of a device at counter 0.
+func NewChainVerifier(deviceID string, publicKey []byte) (*ChainVerifier, error) {
+	verifier, err := NewVerifier(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ChainVerifier{deviceID: deviceID, verifier: verifier}, nil
+}
+
+// Verify checks the next signature of the chain. A failed signature still becomes the
+// predecessor of the next one, so one tampered signature is reported once.
+func (v *ChainVerifier) Verify(counter int, signedData string, signature []byte) error {
+	expected, previous := v.next, v.previous
+	v.next, v.previous = counter+1, signature
+
+	if counter != expected {
+		return fmt.Errorf("expected counter %d, got %d", expected, counter)
+	}
+	securedData, err := v.verify(counter, signedData, signature)
+	if err != nil {
+		return err
+	}
+	if securedData.LastSignature != ChainLink(v.deviceID, counter, previous) {
+		return fmt.Errorf("chain link does not match the previous signature")
+	}
+	return nil
+}
+
+// VerifySignature checks a single signature against the public key and the counter it
+// embeds, without its link to the predecessor. The position in the chain is unchanged.
+func (v *ChainVerifier) VerifySignature(counter int, signedData string, signature []byte) error {
+	_, err := v.verify(counter, signedData, signature)
+	return err
+}
+
+// ContinueAfter makes the next Verify expect the successor of a signature verified earlier,
+// for checking a part of a chain.
+func (v *ChainVerifier) ContinueAfter(counter int, signature []byte) {
+	v.next, v.previous = counter+1, signature
+}
+
+func (v *ChainVerifier) verify(counter int, signedData string, signature []byte) (SecuredData, error) {
+	if err := v.verifier.Verify([]byte(signedData), signature); err != nil {
+		return SecuredData{}, err
+	}
+	securedData, err := ParseSecuredData(signedData)
+	if err != nil {
+		return SecuredData{}, err
+	}
+	if securedData.Counter != counter {
+		return SecuredData{}, fmt.Errorf("signed data contains counter %d", securedData.Counter)
+	}
+	return securedData, nil
+}
@@ -7,14 +7,20 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 )
 
 type KeyGenerator interface {
 	GenerateBytes() (publicKey []byte, privateKey []byte, err error)
 }
 
+// DefaultRSAKeyBits is the size of RSA keys generated by a zero RSAGenerator.
+const DefaultRSAKeyBits = 2048
+
 // RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{}
+type RSAGenerator struct {
+	Bits int // Key size, DefaultRSAKeyBits if zero
+}
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
@@ -31,12 +37,34 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 }
 
 // ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+type ECCGenerator struct {
+	Curve elliptic.Curve // P-384 if nil
+}
+
+// CurveByName returns the NIST curve with the name P-256, P-384 or P-521.
+func CurveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", name)
+	}
+}
+
+func (g *ECCGenerator) curve() elliptic.Curve {
+	if g.Curve == nil {
+		return elliptic.P384()
+	}
+	return g.Curve
+}
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	key, err := ecdsa.GenerateKey(g.curve(), rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +77,7 @@ func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 
 // GenerateBytes generates a new ECCKeyPair and returns encoded keys.
 func (g *ECCGenerator) GenerateBytes() ([]byte, []byte, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	key, err := ecdsa.GenerateKey(g.curve(), rand.Reader)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -71,7 +99,11 @@ func (g *ECCGenerator) GenerateBytes() ([]byte, []byte, error) {
 
 // GenerateBytes generates a new RSAKeyPair and returns encoded keys.
 func (g *RSAGenerator) GenerateBytes() ([]byte, []byte, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	bits := g.Bits
+	if bits == 0 {
+		bits = DefaultRSAKeyBits
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -6,7 +6,10 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
 	"math/big"
 )
 
@@ -56,3 +59,45 @@ func (signer *ECDSASigner) Sign(data []byte) ([]byte, error) {
 
 	return signature, nil
 }
+
+// NewSignerFromPEM creates a signer for a PEM encoded private key as produced by the key
+// generators or by openssl. It also returns the public key, PEM encoded for NewVerifier.
+func NewSignerFromPEM(privateKeyBytes []byte) (Signer, []byte, error) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	var privateKey any
+	var err error
+	switch block.Type {
+	case "PRIVATE_KEY", "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA_PRIVATE_KEY", "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var signer Signer
+	var publicKey any
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		signer, publicKey = NewECDSASigner(key), &key.PublicKey
+	case *rsa.PrivateKey:
+		signer, publicKey = NewRSASigner(key), &key.PublicKey
+	default:
+		return nil, nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC_KEY", Bytes: publicKeyBytes}), nil
+}
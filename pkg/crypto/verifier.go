@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidSignature is returned when a signature does not match the signed data.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Verifier defines a contract for verifying signatures created by a Signer.
+type Verifier interface {
+	Verify(signedData []byte, signature []byte) error
+}
+
+type RSAVerifier struct {
+	PublicKey *rsa.PublicKey
+}
+
+func NewRSAVerifier(publicKey *rsa.PublicKey) *RSAVerifier {
+	return &RSAVerifier{PublicKey: publicKey}
+}
+
+func (v *RSAVerifier) Verify(data []byte, signature []byte) error {
+	hashed := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(v.PublicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type ECDSAVerifier struct {
+	PublicKey *ecdsa.PublicKey
+}
+
+func NewECDSAVerifier(publicKey *ecdsa.PublicKey) *ECDSAVerifier {
+	return &ECDSAVerifier{PublicKey: publicKey}
+}
+
+func (v *ECDSAVerifier) Verify(data []byte, signature []byte) error {
+	hashed := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(v.PublicKey, hashed[:], signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// NewVerifier creates a verifier for a PEM encoded public key as produced by the key generators
+// or by openssl.
+func NewVerifier(publicKeyBytes []byte) (Verifier, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA_PUBLIC_KEY", "RSA PUBLIC KEY":
+		publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAVerifier(publicKey), nil
+	case "PUBLIC_KEY", "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := publicKey.(type) {
+		case *ecdsa.PublicKey:
+			return NewECDSAVerifier(key), nil
+		case *rsa.PublicKey:
+			return NewRSAVerifier(key), nil
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}